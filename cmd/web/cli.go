@@ -0,0 +1,227 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"snippetbox.labkita.my.id/internal/migrations"
+	"snippetbox.labkita.my.id/internal/models"
+	"snippetbox.labkita.my.id/internal/validator"
+	"strconv"
+	"strings"
+)
+
+// commands are the subcommands of the binary, "web migrate up" runs migrate
+// with the arguments after its name.
+var commands = map[string]func(args []string) error{
+	"bootstrap-admin": bootstrapAdmin,
+	"migrate":         migrate,
+	"user":            userCommand,
+	"snippet":         snippetCommand,
+	"session":         sessionCommand,
+	"seed":            seed,
+	"generate-cert":   generateCert,
+}
+
+// dbFlags are the flags of the subcommands that use the database. What they
+// leave out comes from the configuration of the server, so the subcommands
+// reach the same database and hash passwords the same way.
+type dbFlags struct {
+	config   *string
+	dbDriver *string
+	dsn      *string
+}
+
+func addDBFlags(fs *flag.FlagSet) *dbFlags {
+	return &dbFlags{
+		config:   fs.String("config", os.Getenv("SNIPPETBOX_CONFIG"), "YAML configuration file of the server"),
+		dbDriver: fs.String("db-driver", "", "Database driver, mysql, postgres or sqlite, defaults to the configuration"),
+		dsn:      fs.String("dsn", "", "Data source name, defaults to the configuration, sqlite:///path selects SQLite"),
+	}
+}
+
+// open reads the configuration and connects to its database, the caller must
+// close the returned db.
+func (f *dbFlags) open() (*sql.DB, string, *config, error) {
+	cfg, _, err := loadConfig([]string{"-config", *f.config})
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if *f.dbDriver != "" {
+		cfg.DBDriver = *f.dbDriver
+	}
+	if *f.dsn != "" {
+		cfg.DSN = *f.dsn
+	}
+
+	driver := databaseDriver(cfg.DBDriver, cfg.DSN)
+	db, err := openDB(driver, cfg.DSN)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return db, driver, cfg, nil
+}
+
+// openStores is open with the stores on top, using the password hasher of
+// the configuration.
+func (f *dbFlags) openStores() (*sql.DB, *stores, error) {
+	db, driver, cfg, err := f.open()
+	if err != nil {
+		return nil, nil, err
+	}
+	hasher, err := cfg.passwordHasher()
+	if err == nil {
+		var s *stores
+		if s, err = newStores(driver, db, hasher); err == nil {
+			return db, s, nil
+		}
+	}
+	db.Close()
+	return nil, nil, err
+}
+
+// bootstrapAdmin implements the bootstrap-admin subcommand. It promotes the
+// user with the given email to admin, creating the account first when it
+// doesn't exist yet.
+func bootstrapAdmin(args []string) error {
+	fs := flag.NewFlagSet("bootstrap-admin", flag.ExitOnError)
+	flags := addDBFlags(fs)
+	name := fs.String("name", "", "Name of the admin when the account is created")
+	username := fs.String("username", "", "Username of the admin when the account is created")
+	email := fs.String("email", "", "Email of the admin account")
+	fs.Parse(args)
+
+	if !validator.Matches(*email, validator.EmailRX) {
+		return errors.New("-email must be a valid email address")
+	}
+
+	db, stores, err := flags.openStores()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	users := stores.users
+
+	user, err := users.GetByEmail(*email)
+	if errors.Is(err, models.ErrNoRecord) {
+		// the password is read from the environment so it doesn't end up in the shell history
+		password := os.Getenv("SNIPPETBOX_ADMIN_PASSWORD")
+		*username = strings.ToLower(*username)
+		switch {
+		case !validator.IsNotBlank(*name):
+			return errors.New("-name is required to create the admin account")
+		case !validator.Matches(*username, validator.UsernameRX):
+			return errors.New("-username must be 3-30 letters, digits, '-' or '_'")
+		case !validator.MinChars(password, 8):
+			return errors.New("SNIPPETBOX_ADMIN_PASSWORD must be set to a password of at least 8 characters")
+		}
+
+		var id int
+		id, err = users.Insert(*name, *username, *email, password)
+		if err != nil {
+			return err
+		}
+		user, err = users.Get(id)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = users.SetRole(user.ID, models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	err = stores.auditLog.Insert(&models.AuditEvent{
+		Action:     models.AuditUserRole,
+		TargetType: "user",
+		TargetID:   user.ID,
+		IP:         "local",
+		UserAgent:  "bootstrap-admin",
+		Changes:    map[string]models.AuditChange{"role": {Before: user.Role, After: models.RoleAdmin}},
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("@%s (%s) is now an admin\n", user.Username, user.Email)
+	return nil
+}
+
+// migrate implements the migrate subcommand:
+//
+//	migrate up            apply all pending migrations
+//	migrate down [n]      revert the last n migrations, 1 by default
+//	migrate goto VERSION  migrate up or down to the version
+//	migrate force VERSION record the version as applied without running it
+//	migrate status        list the migrations and when they were applied
+//
+// migrate up also upgrades a MySQL database set up by hand from the scripts
+// of earlier releases, see the migrations package.
+func migrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags := addDBFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: migrate [flags] up | down [n] | goto VERSION | force VERSION | status")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("missing command")
+	}
+
+	db, driver, _, err := flags.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator := &migrations.Migrator{
+		DB:     db,
+		Driver: driver,
+		Log: func(format string, args ...interface{}) {
+			fmt.Printf(format+"\n", args...)
+		},
+	}
+
+	command, arg := fs.Arg(0), fs.Arg(1)
+	switch command {
+	case "up":
+		return migrator.Up()
+	case "down":
+		steps := 1
+		if arg != "" {
+			if steps, err = strconv.Atoi(arg); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations %q", arg)
+			}
+		}
+		return migrator.Down(steps)
+	case "goto", "force":
+		version, err := strconv.Atoi(arg)
+		if err != nil || version < 0 {
+			return fmt.Errorf("%s needs a version, got %q", command, arg)
+		}
+		if command == "force" {
+			return migrator.Force(version)
+		}
+		return migrator.Goto(version)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied != nil {
+				applied = "applied " + s.Applied.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-25s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	}
+	fs.Usage()
+	return fmt.Errorf("unknown command %q", command)
+}
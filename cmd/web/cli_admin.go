@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"snippetbox.labkita.my.id/internal/models"
+	"snippetbox.labkita.my.id/internal/validator"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The user, snippet, session and seed subcommands do the operational tasks
+// that used to need raw SQL. They print a table, or JSON with -format=json,
+// and exit with status 1 when they fail.
+
+// cliFlags are the flags every administrative subcommand takes.
+type cliFlags struct {
+	*dbFlags
+	format *string
+}
+
+func addCLIFlags(fs *flag.FlagSet) *cliFlags {
+	return &cliFlags{
+		dbFlags: addDBFlags(fs),
+		format:  fs.String("format", "table", "Output format, table or json"),
+	}
+}
+
+// open connects to the database, the caller must close the returned db.
+func (f *cliFlags) open() (*sql.DB, *stores, error) {
+	if *f.format != "table" && *f.format != "json" {
+		return nil, nil, fmt.Errorf("unknown format %q, use table or json", *f.format)
+	}
+	return f.openStores()
+}
+
+// print writes v as JSON, or the rows as a table under the header.
+func (f *cliFlags) print(v interface{}, header []string, rows [][]string) error {
+	if *f.format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// subcommand splits "user create -name ..." into the command and a flag set
+// for the rest of the arguments.
+func subcommand(name string, args []string, commands string) (string, *flag.FlagSet, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", nil, fmt.Errorf("usage: %s %s", name, commands)
+	}
+	return args[0], flag.NewFlagSet(name+" "+args[0], flag.ExitOnError), nil
+}
+
+type cliUser struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Username  string     `json:"username"`
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
+	Suspended bool       `json:"suspended"`
+	Created   time.Time  `json:"created"`
+	DeleteAt  *time.Time `json:"delete_at,omitempty"`
+}
+
+func newCLIUser(u *models.User) *cliUser {
+	return &cliUser{ID: u.ID, Name: u.Name, Username: u.Username, Email: u.Email, Role: u.Role, Suspended: u.Suspended, Created: u.Created, DeleteAt: u.DeleteAt}
+}
+
+var cliUserHeader = []string{"ID", "USERNAME", "NAME", "EMAIL", "ROLE", "SUSPENDED", "CREATED"}
+
+func (u *cliUser) row() []string {
+	return []string{strconv.Itoa(u.ID), u.Username, u.Name, u.Email, u.Role, strconv.FormatBool(u.Suspended), humanDate(u.Created)}
+}
+
+type cliSnippet struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"user_id,omitempty"`
+	Username     string    `json:"username,omitempty"`
+	Title        string    `json:"title"`
+	Content      string    `json:"content,omitempty"`
+	Language     string    `json:"language,omitempty"`
+	Visibility   string    `json:"visibility"`
+	Hidden       bool      `json:"hidden"`
+	ForkedFromID int       `json:"forked_from_id,omitempty"`
+	Tags         []string  `json:"tags,omitempty"`
+	Created      time.Time `json:"created"`
+	Expires      time.Time `json:"expires"`
+}
+
+func newCLISnippet(s *models.Snippet, withContent bool) *cliSnippet {
+	c := &cliSnippet{
+		ID: s.ID, UserID: s.UserID, Username: s.Username, Title: s.Title, Language: s.Language, Visibility: s.Visibility,
+		Hidden: s.Hidden, ForkedFromID: s.ForkedFromID, Tags: s.Tags, Created: s.Created, Expires: s.Expires,
+	}
+	if withContent {
+		c.Content = s.Content
+	}
+	return c
+}
+
+var cliSnippetHeader = []string{"ID", "TITLE", "OWNER", "VISIBILITY", "HIDDEN", "CREATED", "EXPIRES"}
+
+func (s *cliSnippet) row() []string {
+	owner := "-"
+	if s.Username != "" {
+		owner = "@" + s.Username
+	}
+	return []string{strconv.Itoa(s.ID), s.Title, owner, s.Visibility, strconv.FormatBool(s.Hidden), humanDate(s.Created), humanDate(s.Expires)}
+}
+
+// findUser looks a user up by id, @username or email.
+func findUser(users models.UserStore, ref string) (*models.User, error) {
+	var user *models.User
+	var err error
+	switch id, convErr := strconv.Atoi(ref); {
+	case convErr == nil:
+		user, err = users.Get(id)
+	case strings.HasPrefix(ref, "@"):
+		user, err = users.GetByUsername(strings.ToLower(ref[1:]))
+	case strings.Contains(ref, "@"):
+		user, err = users.GetByEmail(ref)
+	default:
+		user, err = users.GetByUsername(strings.ToLower(ref))
+	}
+	if errors.Is(err, models.ErrNoRecord) {
+		return nil, fmt.Errorf("no user %q", ref)
+	}
+	return user, err
+}
+
+// readPassword takes the password from SNIPPETBOX_PASSWORD or else the first
+// line of stdin, so it doesn't end up in the shell history.
+func readPassword() (string, error) {
+	if password := os.Getenv("SNIPPETBOX_PASSWORD"); password != "" {
+		return password, nil
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("set SNIPPETBOX_PASSWORD or pass the password on stdin")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// checkCLIPassword applies the signup password rules.
+func checkCLIPassword(password string, userInputs ...string) error {
+	var v validator.Validator
+	v.CheckField(validator.MinChars(password, 8), "password", "this field must be at least 8 char")
+	checkPasswordStrength(&v, password, userInputs...)
+	if !v.IsValid() {
+		return errors.New(v.FieldErrors["password"])
+	}
+	return nil
+}
+
+// cliAudit records an action taken from the command line.
+func cliAudit(s *stores, command string, e *models.AuditEvent) error {
+	e.IP = "local"
+	e.UserAgent = command
+	return s.auditLog.Insert(e)
+}
+
+// userCommand implements "user create|list|disable|set-password".
+func userCommand(args []string) error {
+	command, fs, err := subcommand("user", args, "create|list|disable|set-password [flags]")
+	if err != nil {
+		return err
+	}
+	flags := addCLIFlags(fs)
+
+	switch command {
+	case "create":
+		name := fs.String("name", "", "Name of the user")
+		username := fs.String("username", "", "Username")
+		email := fs.String("email", "", "Email address")
+		role := fs.String("role", models.RoleUser, "Role, user, moderator or admin")
+		fs.Parse(args[1:])
+
+		*username = strings.ToLower(strings.TrimSpace(*username))
+		switch {
+		case !validator.IsNotBlank(*name):
+			return errors.New("-name is required")
+		case !validator.Matches(*username, validator.UsernameRX):
+			return errors.New("-username must be 3-30 letters, digits, '-' or '_'")
+		case !validator.Matches(*email, validator.EmailRX):
+			return errors.New("-email must be a valid email address")
+		case !validator.PermittedValue(*role, models.RoleUser, models.RoleModerator, models.RoleAdmin):
+			return errors.New("-role must be user, moderator or admin")
+		}
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		if err = checkCLIPassword(password, *name, *username, *email); err != nil {
+			return err
+		}
+
+		db, s, err := flags.open()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		id, err := s.users.Insert(*name, *username, *email, password)
+		if err != nil {
+			return err
+		}
+		if *role != models.RoleUser {
+			if err = s.users.SetRole(id, *role); err != nil {
+				return err
+			}
+		}
+		err = cliAudit(s, "user create", &models.AuditEvent{
+			Action:     models.AuditSignup,
+			TargetType: "user",
+			TargetID:   id,
+			Changes:    map[string]models.AuditChange{"role": {After: *role}},
+		})
+		if err != nil {
+			return err
+		}
+		user, err := s.users.Get(id)
+		if err != nil {
+			return err
+		}
+		u := newCLIUser(user)
+		return flags.print(u, cliUserHeader, [][]string{u.row()})
+
+	case "list":
+		query := fs.String("q", "", "Only users whose name, username or email contains this")
+		limit := fs.Int("limit", 50, "Maximum number of users")
+		fs.Parse(args[1:])
+
+		db, s, err := flags.open()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		users, err := s.users.List(*query, *limit, 0)
+		if err != nil {
+			return err
+		}
+		list, rows := []*cliUser{}, [][]string{}
+		for _, user := range users {
+			u := newCLIUser(user)
+			list, rows = append(list, u), append(rows, u.row())
+		}
+		return flags.print(list, cliUserHeader, rows)
+
+	case "disable", "set-password":
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			return fmt.Errorf("usage: user %s [flags] ID|@username|email", command)
+		}
+
+		db, s, err := flags.open()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		user, err := findUser(s.users, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		event := &models.AuditEvent{TargetType: "user", TargetID: user.ID}
+		if command == "disable" {
+			if err = s.users.SetSuspended(user.ID, true); err != nil {
+				return err
+			}
+			event.Action = models.AuditUserSuspend
+			event.Changes = map[string]models.AuditChange{"suspended": {Before: user.Suspended, After: true}}
+			user.Suspended = true
+		} else {
+			password, err := readPassword()
+			if err != nil {
+				return err
+			}
+			if err = checkCLIPassword(password, user.Name, user.Username, user.Email); err != nil {
+				return err
+			}
+			if err = s.users.UpdatePassword(user.ID, password); err != nil {
+				return err
+			}
+			event.Action = models.AuditPasswordChange
+		}
+		// either way the sessions the user already has must not go on
+		if err = s.sessions.RevokeAll(user.ID, ""); err != nil {
+			return err
+		}
+		if err = cliAudit(s, "user "+command, event); err != nil {
+			return err
+		}
+		u := newCLIUser(user)
+		return flags.print(u, cliUserHeader, [][]string{u.row()})
+	}
+	return fmt.Errorf("unknown command user %s", command)
+}
+
+// snippetCommand implements "snippet list|show|delete|restore". Deleting
+// hides the snippet so it can be restored, -purge removes it for good.
+func snippetCommand(args []string) error {
+	command, fs, err := subcommand("snippet", args, "list|show|delete|restore [flags]")
+	if err != nil {
+		return err
+	}
+	flags := addCLIFlags(fs)
+
+	switch command {
+	case "list":
+		owner := fs.String("user", "", "Every snippet of this user (ID, @username or email), including hidden ones")
+		query := fs.String("q", "", "Only public snippets containing this")
+		tag := fs.String("tag", "", "Only public snippets with these comma separated tags")
+		limit := fs.Int("limit", 50, "Maximum number of snippets")
+		fs.Parse(args[1:])
+
+		db, s, err := flags.open()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		var snippets []*models.Snippet
+		if *owner != "" {
+			user, err := findUser(s.users, *owner)
+			if err != nil {
+				return err
+			}
+			snippets, err = s.snippets.ByUser(user.ID, true, *limit, 0)
+			if err != nil {
+				return err
+			}
+		} else {
+			snippets, err = s.snippets.Search(*query, parseTags(*tag), *limit, 0)
+			if err != nil {
+				return err
+			}
+		}
+		list, rows := []*cliSnippet{}, [][]string{}
+		for _, snippet := range snippets {
+			c := newCLISnippet(snippet, false)
+			list, rows = append(list, c), append(rows, c.row())
+		}
+		return flags.print(list, cliSnippetHeader, rows)
+
+	case "show", "delete", "restore":
+		purge := false
+		if command == "delete" {
+			fs.BoolVar(&purge, "purge", false, "Delete the snippet for good instead of hiding it")
+		}
+		fs.Parse(args[1:])
+		id, err := strconv.Atoi(fs.Arg(0))
+		if fs.NArg() != 1 || err != nil || id < 1 {
+			return fmt.Errorf("usage: snippet %s [flags] ID", command)
+		}
+
+		db, s, err := flags.open()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		snippet, err := s.snippets.Get(id)
+		if errors.Is(err, models.ErrNoRecord) {
+			return fmt.Errorf("no snippet %d", id)
+		} else if err != nil {
+			return err
+		}
+
+		event := &models.AuditEvent{TargetType: "snippet", TargetID: id}
+		switch {
+		case command == "delete" && purge:
+			err = s.snippets.Delete(id)
+			event.Action = models.AuditSnippetDelete
+			event.Details = snippet.Title
+		case command == "delete":
+			err = s.snippets.SetHidden(id, true)
+			event.Action = models.AuditSnippetHide
+			event.Changes = map[string]models.AuditChange{"hidden": {Before: snippet.Hidden, After: true}}
+			snippet.Hidden = true
+		case command == "restore":
+			err = s.snippets.SetHidden(id, false)
+			event.Action = models.AuditSnippetUnhide
+			event.Changes = map[string]models.AuditChange{"hidden": {Before: snippet.Hidden, After: false}}
+			snippet.Hidden = false
+		}
+		if err != nil {
+			return err
+		}
+		if event.Action != "" {
+			if err = cliAudit(s, "snippet "+command, event); err != nil {
+				return err
+			}
+		}
+
+		c := newCLISnippet(snippet, command == "show")
+		if command == "show" && *flags.format == "table" {
+			if err = flags.print(c, cliSnippetHeader, [][]string{c.row()}); err != nil {
+				return err
+			}
+			fmt.Printf("\n%s\n", strings.TrimRight(snippet.Content, "\n"))
+			return nil
+		}
+		return flags.print(c, cliSnippetHeader, [][]string{c.row()})
+	}
+	return fmt.Errorf("unknown command snippet %s", command)
+}
+
+// sessionCommand implements "session purge". Without flags only expired
+// sessions are removed, -user logs one user out everywhere and -all logs
+// everybody out.
+func sessionCommand(args []string) error {
+	command, fs, err := subcommand("session", args, "purge [flags]")
+	if err != nil {
+		return err
+	}
+	flags := addCLIFlags(fs)
+	if command != "purge" {
+		return fmt.Errorf("unknown command session %s", command)
+	}
+	owner := fs.String("user", "", "Only end the sessions of this user (ID, @username or email)")
+	all := fs.Bool("all", false, "End every session, not only the expired ones")
+	fs.Parse(args[1:])
+
+	db, s, err := flags.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	result := struct {
+		Deleted int `json:"deleted"`
+	}{}
+	if *owner != "" {
+		user, err := findUser(s.users, *owner)
+		if err != nil {
+			return err
+		}
+		sessions, err := s.sessions.ForUser(user.ID)
+		if err != nil {
+			return err
+		}
+		if err = s.sessions.RevokeAll(user.ID, ""); err != nil {
+			return err
+		}
+		result.Deleted = len(sessions)
+		err = cliAudit(s, "session purge", &models.AuditEvent{Action: models.AuditUserLogout, TargetType: "user", TargetID: user.ID})
+		if err != nil {
+			return err
+		}
+	} else {
+		result.Deleted, err = s.sessions.Purge(*all)
+		if err != nil {
+			return err
+		}
+		if *all {
+			err = cliAudit(s, "session purge", &models.AuditEvent{Action: models.AuditSessionPurge, Details: strconv.Itoa(result.Deleted) + " sessions"})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return flags.print(result, []string{"DELETED"}, [][]string{{strconv.Itoa(result.Deleted)}})
+}
+
+// seedSnippets are the sample snippets for a new installation.
+var seedSnippets = []models.SnippetInput{
+	{
+		Title:   "An old silent pond",
+		Content: "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.\n\n– Matsuo Bashō",
+		Expires: 365,
+	},
+	{
+		Title:   "Over the wintry forest",
+		Content: "Over the wintry\nforest, winds howl in rage\nwith no leaves to blow.\n\n– Natsume Soseki",
+		Expires: 365,
+	},
+	{
+		Title:   "First autumn morning",
+		Content: "First autumn morning\nthe mirror I stare into\nshows my father's face.\n\n– Murakami Kijo",
+		Expires: 7,
+	},
+}
+
+// seed implements the seed subcommand, it adds the sample snippets.
+func seed(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	flags := addCLIFlags(fs)
+	owner := fs.String("user", "", "Owner of the snippets (ID, @username or email), anonymous when empty")
+	fs.Parse(args)
+
+	db, s, err := flags.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	inputs := make([]models.SnippetInput, len(seedSnippets))
+	copy(inputs, seedSnippets)
+	if *owner != "" {
+		user, err := findUser(s.users, *owner)
+		if err != nil {
+			return err
+		}
+		for i := range inputs {
+			inputs[i].UserID = user.ID
+		}
+	}
+	for i := range inputs {
+		inputs[i].Visibility = models.VisibilityPublic
+	}
+
+	ids, err := s.snippets.InsertMany(inputs)
+	if err != nil {
+		return err
+	}
+	list, rows := []*cliSnippet{}, [][]string{}
+	for _, id := range ids {
+		snippet, err := s.snippets.Get(id)
+		if err != nil {
+			return err
+		}
+		c := newCLISnippet(snippet, false)
+		list, rows = append(list, c), append(rows, c.row())
+	}
+	return flags.print(list, cliSnippetHeader, rows)
+}
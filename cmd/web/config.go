@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"regexp"
+	"snippetbox.labkita.my.id/internal/logging"
+	"snippetbox.labkita.my.id/internal/models"
+	"strings"
+	"time"
+)
+
+// config is the configuration of the web server. Every setting is read from,
+// in increasing order of precedence, the defaults, the YAML file given with
+// -config or SNIPPETBOX_CONFIG, the SNIPPETBOX_* environment variables and
+// the command line flags. The YAML keys are the flag names, the variable of
+// -session-lifetime for example is SNIPPETBOX_SESSION_LIFETIME.
+type config struct {
+	Addr                string        `yaml:"addr"`
+	DBDriver            string        `yaml:"db-driver"`
+	DSN                 string        `yaml:"dsn"`
+	ReadTimeout         time.Duration `yaml:"read-timeout"`
+	WriteTimeout        time.Duration `yaml:"write-timeout"`
+	ServerIdleTimeout   time.Duration `yaml:"server-idle-timeout"`
+	ShutdownTimeout     time.Duration `yaml:"shutdown-timeout"`
+	TLSCert             string        `yaml:"tls-cert"`
+	TLSKey              string        `yaml:"tls-key"`
+	RedirectAddr        string        `yaml:"redirect-addr"`
+	TrustedProxies      stringList    `yaml:"trusted-proxies"`
+	ForceHTTPS          bool          `yaml:"force-https"`
+	SecureCookies       bool          `yaml:"secure-cookies"`
+	LogLevel            string        `yaml:"log-level"`
+	LogFormat           string        `yaml:"log-format"`
+	SessionLifetime     time.Duration `yaml:"session-lifetime"`
+	RememberLifetime    time.Duration `yaml:"remember-lifetime"`
+	IdleTimeout         time.Duration `yaml:"idle-timeout"`
+	ReauthWindow        time.Duration `yaml:"reauth-window"`
+	DeletionGrace       time.Duration `yaml:"deletion-grace"`
+	PasswordHash        string        `yaml:"password-hash"`
+	Argon2Memory        uint          `yaml:"argon2-memory"`
+	Argon2Iterations    uint          `yaml:"argon2-iterations"`
+	Argon2Parallelism   uint          `yaml:"argon2-parallelism"`
+	BcryptCost          int           `yaml:"bcrypt-cost"`
+	OIDCIssuer          string        `yaml:"oidc-issuer"`
+	OIDCClientID        string        `yaml:"oidc-client-id"`
+	OIDCClientSecret    string        `yaml:"oidc-client-secret"`
+	OIDCRedirectURL     string        `yaml:"oidc-redirect-url"`
+	TemplateDir         string        `yaml:"template-dir"`
+	StaticDir           string        `yaml:"static-dir"`
+	PurgeAccountsPeriod time.Duration `yaml:"purge-accounts-period"`
+}
+
+func defaultConfig() config {
+	return config{
+		Addr:                ":4000",
+		DBDriver:            "mysql",
+		ReadTimeout:         5 * time.Second,
+		WriteTimeout:        10 * time.Second,
+		ServerIdleTimeout:   time.Minute,
+		ShutdownTimeout:     30 * time.Second,
+		SessionLifetime:     12 * time.Hour,
+		RememberLifetime:    30 * 24 * time.Hour,
+		IdleTimeout:         7 * 24 * time.Hour,
+		ReauthWindow:        15 * time.Minute,
+		DeletionGrace:       14 * 24 * time.Hour,
+		PasswordHash:        "argon2id",
+		Argon2Memory:        64 * 1024,
+		Argon2Iterations:    3,
+		Argon2Parallelism:   2,
+		BcryptCost:          12,
+		OIDCRedirectURL:     "http://localhost:4000/user/oidc/callback",
+		TemplateDir:         "./ui/html",
+		StaticDir:           "./ui/static",
+		PurgeAccountsPeriod: time.Hour,
+		SecureCookies:       true,
+		LogLevel:            "info",
+		LogFormat:           "text",
+	}
+}
+
+// flags binds a flag to every setting of cfg.
+func (cfg *config) flags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "Http network address")
+	fs.StringVar(&cfg.DBDriver, "db-driver", cfg.DBDriver, "Database driver, mysql, postgres or sqlite")
+	fs.StringVar(&cfg.DSN, "dsn", cfg.DSN, "Data source name, defaults to a local database of the driver, sqlite:///path selects SQLite")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", cfg.ReadTimeout, "Maximum time to read a request")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", cfg.WriteTimeout, "Maximum time to write a response")
+	fs.DurationVar(&cfg.ServerIdleTimeout, "server-idle-timeout", cfg.ServerIdleTimeout, "Keep-alive connections are closed after this much inactivity")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "Time in-flight requests get to finish on SIGINT or SIGTERM")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "PEM certificate file, serves HTTPS when set, SIGHUP reloads it")
+	fs.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "PEM private key file of -tls-cert")
+	fs.StringVar(&cfg.RedirectAddr, "redirect-addr", cfg.RedirectAddr, "Http network address that redirects to HTTPS, disabled when empty")
+	fs.Var(&cfg.TrustedProxies, "trusted-proxies", "Comma separated addresses and networks of reverse proxies whose X-Forwarded-For, Forwarded and X-Forwarded-Proto headers are believed")
+	fs.BoolVar(&cfg.ForceHTTPS, "force-https", cfg.ForceHTTPS, "Redirect requests a trusted proxy received over plain HTTP to HTTPS")
+	fs.BoolVar(&cfg.SecureCookies, "secure-cookies", cfg.SecureCookies, "Mark the session and CSRF cookies Secure, turn off only to develop over plain HTTP")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "Minimum log level, debug, info or error")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "Log format, text or json")
+	fs.DurationVar(&cfg.SessionLifetime, "session-lifetime", cfg.SessionLifetime, "Lifetime of a login without remember me")
+	fs.DurationVar(&cfg.RememberLifetime, "remember-lifetime", cfg.RememberLifetime, "Lifetime of a remembered login")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout, "Logout after this much inactivity")
+	fs.DurationVar(&cfg.ReauthWindow, "reauth-window", cfg.ReauthWindow, "Ask for the password again on sensitive actions after this long")
+	fs.DurationVar(&cfg.DeletionGrace, "deletion-grace", cfg.DeletionGrace, "Time before a deleted account is purged, it can be cancelled until then")
+	fs.StringVar(&cfg.PasswordHash, "password-hash", cfg.PasswordHash, "Password hashing algorithm for new hashes, argon2id or bcrypt")
+	fs.UintVar(&cfg.Argon2Memory, "argon2-memory", cfg.Argon2Memory, "argon2id memory in KiB")
+	fs.UintVar(&cfg.Argon2Iterations, "argon2-iterations", cfg.Argon2Iterations, "argon2id iterations")
+	fs.UintVar(&cfg.Argon2Parallelism, "argon2-parallelism", cfg.Argon2Parallelism, "argon2id parallelism")
+	fs.IntVar(&cfg.BcryptCost, "bcrypt-cost", cfg.BcryptCost, "bcrypt cost")
+	fs.StringVar(&cfg.OIDCIssuer, "oidc-issuer", cfg.OIDCIssuer, "OpenID Connect issuer URL, sign in with SSO is disabled when empty")
+	fs.StringVar(&cfg.OIDCClientID, "oidc-client-id", cfg.OIDCClientID, "OpenID Connect client ID")
+	fs.StringVar(&cfg.OIDCClientSecret, "oidc-client-secret", cfg.OIDCClientSecret, "OpenID Connect client secret")
+	fs.StringVar(&cfg.OIDCRedirectURL, "oidc-redirect-url", cfg.OIDCRedirectURL, "OpenID Connect redirect URL")
+	fs.StringVar(&cfg.TemplateDir, "template-dir", cfg.TemplateDir, "Directory of the HTML templates")
+	fs.StringVar(&cfg.StaticDir, "static-dir", cfg.StaticDir, "Directory of the static files")
+	fs.DurationVar(&cfg.PurgeAccountsPeriod, "purge-accounts-period", cfg.PurgeAccountsPeriod, "How often accounts past their deletion grace are purged")
+}
+
+// stringList is a setting of comma separated values.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = stringList{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// envName is the environment variable of a flag.
+func envName(flagName string) string {
+	return "SNIPPETBOX_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadConfig builds the configuration from the command line arguments, the
+// file and the environment. printConfig is true when -print-config was given.
+func loadConfig(args []string) (cfg *config, printConfig bool, err error) {
+	cfg = &config{}
+	*cfg = defaultConfig()
+
+	fs := flag.NewFlagSet("web", flag.ExitOnError)
+	path := fs.String("config", os.Getenv("SNIPPETBOX_CONFIG"), "YAML configuration file, the flags and SNIPPETBOX_* environment variables override it")
+	fs.BoolVar(&printConfig, "print-config", false, "Print the effective configuration with the secrets redacted and exit")
+	cfg.flags(fs)
+	fs.Parse(args)
+
+	// the flags were parsed first to find the file, they are set again
+	// below so they win over the file and the environment
+	given := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = f.Value.String()
+	})
+
+	*cfg = defaultConfig()
+	if *path != "" {
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			return nil, false, err
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err = dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, false, fmt.Errorf("%s: %w", *path, err)
+		}
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			if setErr := f.Value.Set(value); setErr != nil {
+				err = fmt.Errorf("%s: %w", envName(f.Name), setErr)
+			}
+		}
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	for name, value := range given {
+		if err = fs.Set(name, value); err != nil {
+			return nil, false, fmt.Errorf("-%s: %w", name, err)
+		}
+	}
+	return cfg, printConfig, nil
+}
+
+// validate reports every invalid setting at once.
+func (cfg *config) validate() error {
+	problems := []string{}
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(cfg.Addr != "", "addr must not be empty")
+	check(cfg.DBDriver == "mysql" || cfg.DBDriver == "postgres" || cfg.DBDriver == "sqlite", "db-driver must be mysql, postgres or sqlite, not %q", cfg.DBDriver)
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read-timeout", cfg.ReadTimeout},
+		{"write-timeout", cfg.WriteTimeout},
+		{"server-idle-timeout", cfg.ServerIdleTimeout},
+		{"shutdown-timeout", cfg.ShutdownTimeout},
+		{"session-lifetime", cfg.SessionLifetime},
+		{"remember-lifetime", cfg.RememberLifetime},
+		{"idle-timeout", cfg.IdleTimeout},
+		{"reauth-window", cfg.ReauthWindow},
+		{"deletion-grace", cfg.DeletionGrace},
+		{"purge-accounts-period", cfg.PurgeAccountsPeriod},
+	}
+	for _, d := range durations {
+		check(d.value > 0, "%s must be positive", d.name)
+	}
+	check((cfg.TLSCert == "") == (cfg.TLSKey == ""), "tls-cert and tls-key must be given together")
+	check(cfg.RedirectAddr == "" || cfg.TLSCert != "", "redirect-addr needs tls-cert and tls-key")
+	check(cfg.RedirectAddr == "" || cfg.RedirectAddr != cfg.Addr, "redirect-addr must differ from addr")
+	_, err := parseCIDRs(cfg.TrustedProxies)
+	check(err == nil, "trusted-proxies: %v", err)
+	check(!cfg.ForceHTTPS || len(cfg.TrustedProxies) > 0, "force-https needs trusted-proxies")
+	check(cfg.SecureCookies || (cfg.TLSCert == "" && !cfg.ForceHTTPS), "secure-cookies can only be turned off without tls-cert and force-https")
+	_, err = logging.ParseLevel(cfg.LogLevel)
+	check(err == nil, "log-level must be debug, info or error, not %q", cfg.LogLevel)
+	check(cfg.LogFormat == "text" || cfg.LogFormat == "json", "log-format must be text or json, not %q", cfg.LogFormat)
+	check(cfg.RememberLifetime >= cfg.SessionLifetime, "remember-lifetime must not be shorter than session-lifetime")
+
+	_, err = cfg.passwordHasher()
+	check(err == nil, "%v", err)
+
+	if cfg.OIDCIssuer != "" {
+		check(cfg.OIDCClientID != "", "oidc-client-id is required with oidc-issuer")
+		check(cfg.OIDCClientSecret != "", "oidc-client-secret is required with oidc-issuer")
+		u, err := url.Parse(cfg.OIDCRedirectURL)
+		check(err == nil && u.IsAbs(), "oidc-redirect-url must be an absolute URL")
+	}
+
+	for _, dir := range [][2]string{{"template-dir", cfg.TemplateDir}, {"static-dir", cfg.StaticDir}} {
+		info, err := os.Stat(dir[1])
+		check(err == nil && info.IsDir(), "%s %q is not a directory", dir[0], dir[1])
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n\t" + strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+// passwordHasher builds the hasher for new password hashes. Stored hashes of
+// the other algorithm or with other parameters are upgraded when their user
+// logs in.
+func (cfg *config) passwordHasher() (models.PasswordHasher, error) {
+	switch cfg.PasswordHash {
+	case "argon2id":
+		switch {
+		case cfg.Argon2Iterations < 1:
+			return nil, errors.New("argon2-iterations must be at least 1")
+		case cfg.Argon2Parallelism < 1 || cfg.Argon2Parallelism > 255:
+			return nil, errors.New("argon2-parallelism must be between 1 and 255")
+		case cfg.Argon2Memory < 8*cfg.Argon2Parallelism || uint64(cfg.Argon2Memory) > math.MaxUint32:
+			return nil, errors.New("argon2-memory must be at least 8 KiB per thread of argon2-parallelism")
+		}
+		return &models.Argon2idHasher{
+			Memory:      uint32(cfg.Argon2Memory),
+			Iterations:  uint32(cfg.Argon2Iterations),
+			Parallelism: uint8(cfg.Argon2Parallelism),
+			SaltLength:  16,
+			KeyLength:   32,
+		}, nil
+	case "bcrypt":
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt-cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return &models.BcryptHasher{Cost: cfg.BcryptCost}, nil
+	}
+	return nil, fmt.Errorf("password-hash must be argon2id or bcrypt, not %q", cfg.PasswordHash)
+}
+
+const redacted = "REDACTED"
+
+var dsnPasswordRX = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+
+// redacted returns a copy of cfg that is safe to print or log.
+func (cfg *config) redacted() config {
+	c := *cfg
+	if c.OIDCClientSecret != "" {
+		c.OIDCClientSecret = redacted
+	}
+	c.DSN = redactDSN(c.DSN)
+	return c
+}
+
+// redactDSN hides the password of a MySQL DSN, a URL or a key=value
+// connection string.
+func redactDSN(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		if u, err := url.Parse(dsn); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+			}
+			return u.String()
+		}
+		return dsn
+	}
+	if strings.Contains(dsn, "=") && !strings.Contains(dsn, "@") {
+		return dsnPasswordRX.ReplaceAllString(dsn, "${1}"+redacted)
+	}
+	if mc, err := mysql.ParseDSN(dsn); err == nil {
+		if mc.Passwd != "" {
+			mc.Passwd = redacted
+		}
+		return mc.FormatDSN()
+	}
+	return dsn
+}
+
+// String formats the redacted configuration as YAML, so it can be used as a
+// starting point for a configuration file.
+func (cfg *config) String() string {
+	out, err := yaml.Marshal(cfg.redacted())
+	if err != nil {
+		return err.Error()
+	}
+	return string(out)
+}
@@ -0,0 +1,6 @@
+package main
+
+type contextKey string
+
+const authenticatedUserContextKey = contextKey("authenticatedUser")
+const requestIDContextKey = contextKey("requestID")
@@ -4,27 +4,42 @@ import (
 	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
+	"io"
 	"net/http"
+	"net/url"
 	"snippetbox.labkita.my.id/internal/models"
 	"snippetbox.labkita.my.id/internal/validator"
 	"strconv"
+	"strings"
 )
 
 func (app *application) home(resp http.ResponseWriter, req *http.Request) {
 	snippets, err := app.snippets.Latest()
 	if err != nil {
-		app.serverError(resp, err)
+		app.serverError(resp, req, err)
+		return
+	}
+	tags, err := app.tags.Popular(30)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+	popular, err := app.stars.Popular(7, 10)
+	if err != nil {
+		app.serverError(resp, req, err)
 		return
 	}
 	data := app.newTemplateData(req)
 	data.Snippets = snippets
-	app.render(resp, http.StatusOK, "home.tmpl", data)
+	data.Popular = popular
+	data.TagCloud = newTagCloud(tags)
+	app.render(resp, req, http.StatusOK, "home.tmpl", data)
 }
 
 func (app *application) snippetList(resp http.ResponseWriter, req *http.Request) {
 	snippets, err := app.snippets.Latest()
 	if err != nil {
-		app.serverError(resp, err)
+		app.serverError(resp, req, err)
 		return
 	}
 	for _, snippet := range snippets {
@@ -48,34 +63,96 @@ func (app *application) snippetView(resp http.ResponseWriter, req *http.Request)
 		if errors.Is(err, models.ErrNoRecord) {
 			app.notFound(resp)
 		} else {
-			app.serverError(resp, err)
+			app.serverError(resp, req, err)
 		}
 		return
 	}
+	if !snippet.VisibleTo(app.authenticatedUserID(req)) {
+		app.notFound(resp)
+		return
+	}
+
+	app.renderSnippetView(resp, req, http.StatusOK, snippet, commentForm{})
+}
+
+// renderSnippetView renders the snippet page, the comment form is passed in
+// so validation errors of a posted comment can be shown.
+func (app *application) renderSnippetView(resp http.ResponseWriter, req *http.Request, status int, snippet *models.Snippet, form commentForm) {
+	var err error
 
 	data := app.newTemplateData(req)
 	data.Snippet = snippet
+	data.Form = form
+	data.UserID = app.authenticatedUserID(req)
+
+	if data.IsAuthenticated {
+		data.Starred, err = app.stars.Exists(data.UserID, snippet.ID)
+		if err != nil {
+			app.serverError(resp, req, err)
+			return
+		}
+	}
 
-	app.render(resp, http.StatusOK, "view.tmpl", data)
+	data.Comments, err = app.comments.ForSnippet(snippet.ID)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	app.render(resp, req, status, "view.tmpl", data)
 }
 
 func (app *application) snippetCreateForm(resp http.ResponseWriter, req *http.Request) {
 	data := app.newTemplateData(req)
 
 	data.Form = snippetCreateForm{
-		Expires: 365,
+		Expires:    365,
+		Visibility: models.VisibilityPublic,
 	}
 
-	app.render(resp, http.StatusOK, "create.tmpl", data)
+	app.render(resp, req, http.StatusOK, "create.tmpl", data)
 }
 
 type snippetCreateForm struct {
 	Title               string `form:"title"`
 	Content             string `form:"content"`
+	Language            string `form:"language"`
 	Expires             int    `form:"expires"`
+	Visibility          string `form:"visibility"`
+	Tags                string `form:"tags"`
 	validator.Validator `form:"-"`
 }
 
+const maxSnippetTags = 5
+
+func (form *snippetCreateForm) validate() {
+	/** validation snippets: https://www.alexedwards.net/blog/validation-snippets-for-go */
+	form.CheckField(validator.IsNotBlank(form.Title), "title", "this field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.CheckField(validator.IsNotBlank(form.Content), "content", "this field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Language, 30), "language", "This field cannot be more than 30 characters long")
+	form.CheckField(validator.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	form.CheckField(validator.PermittedValue(form.Visibility, models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate), "visibility", "This field must equal public, unlisted or private")
+
+	tags := parseTags(form.Tags)
+	form.CheckField(len(tags) <= maxSnippetTags, "tags", fmt.Sprintf("a snippet cannot have more than %d tags", maxSnippetTags))
+	for _, tag := range tags {
+		form.CheckField(validator.Matches(tag, validator.TagRX), "tags", fmt.Sprintf("%q is not a valid tag, use up to 30 letters, digits, '.', '-', '_', '+' or '#'", tag))
+	}
+}
+
+func (form *snippetCreateForm) input(userID int) models.SnippetInput {
+	return models.SnippetInput{
+		UserID:     userID,
+		Title:      form.Title,
+		Content:    form.Content,
+		Language:   strings.TrimSpace(form.Language),
+		Visibility: form.Visibility,
+		Expires:    form.Expires,
+		Tags:       parseTags(form.Tags),
+	}
+}
+
 func (app *application) snippetCreate(resp http.ResponseWriter, req *http.Request) {
 	// cek bad request
 	var form snippetCreateForm
@@ -85,26 +162,35 @@ func (app *application) snippetCreate(resp http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	/** validation snippets: https://www.alexedwards.net/blog/validation-snippets-for-go */
-	form.CheckField(validator.IsNotBlank(form.Title), "title", "this field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.IsNotBlank(form.Content), "content", "this field cannot be blank")
-	form.CheckField(validator.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	form.validate()
 
 	if !form.IsValid() {
 		data := app.newTemplateData(req)
 		data.Form = form
-		app.render(resp, http.StatusUnprocessableEntity, "create.tmpl", data)
+		app.render(resp, req, http.StatusUnprocessableEntity, "create.tmpl", data)
 		return
 	}
 
 	// create data
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	input := form.input(app.authenticatedUserID(req))
+	id, err := app.snippets.Insert(input)
 	if err != nil {
-		app.serverError(resp, err)
+		app.serverError(resp, req, err)
 		return
 	}
 
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditSnippetCreate,
+		TargetType: "snippet",
+		TargetID:   id,
+		Changes: map[string]models.AuditChange{
+			"title":      {After: input.Title},
+			"visibility": {After: input.Visibility},
+			"expires":    {After: input.Expires},
+			"tags":       {After: input.Tags},
+		},
+	})
+
 	// flash message
 	app.sessionManager.Put(req.Context(), "flash", "Snippet successfully created!")
 
@@ -112,8 +198,479 @@ func (app *application) snippetCreate(resp http.ResponseWriter, req *http.Reques
 	http.Redirect(resp, req, fmt.Sprintf("/snippets/view/%d", id), http.StatusSeeOther)
 }
 
+func (app *application) snippetFork(resp http.ResponseWriter, req *http.Request) {
+	// forking must not leak snippets the user isn't allowed to see
+	snippet, ok := app.readVisibleSnippet(resp, req)
+	if !ok {
+		return
+	}
+	// nor bring back a copy of a snippet hidden by a moderator
+	if snippet.Hidden {
+		app.clientError(resp, http.StatusForbidden)
+		return
+	}
+
+	forkID, err := app.snippets.Fork(snippet.ID, app.authenticatedUserID(req))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(resp)
+		} else {
+			app.serverError(resp, req, err)
+		}
+		return
+	}
+
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditSnippetFork,
+		TargetType: "snippet",
+		TargetID:   forkID,
+		Details:    fmt.Sprintf("forked from #%d", snippet.ID),
+	})
+
+	app.sessionManager.Put(req.Context(), "flash", fmt.Sprintf("Snippet forked from #%d", snippet.ID))
+
+	http.Redirect(resp, req, fmt.Sprintf("/snippets/view/%d", forkID), http.StatusSeeOther)
+}
+
+func (app *application) snippetStar(resp http.ResponseWriter, req *http.Request) {
+	snippet, ok := app.readVisibleSnippet(resp, req)
+	if !ok {
+		return
+	}
+
+	err := app.stars.Add(app.authenticatedUserID(req), snippet.ID)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	http.Redirect(resp, req, fmt.Sprintf("/snippets/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+func (app *application) snippetUnstar(resp http.ResponseWriter, req *http.Request) {
+	params := httprouter.ParamsFromContext(req.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(resp)
+		return
+	}
+
+	// unstarring is always allowed, even when the snippet has become private
+	err = app.stars.Remove(app.authenticatedUserID(req), id)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	http.Redirect(resp, req, fmt.Sprintf("/snippets/view/%d", id), http.StatusSeeOther)
+}
+
+type commentForm struct {
+	Body                string `form:"body"`
+	ParentID            int    `form:"parent_id"`
+	validator.Validator `form:"-"`
+}
+
+func (form *commentForm) validate() {
+	form.CheckField(validator.IsNotBlank(form.Body), "body", "this field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Body, 2000), "body", "This field cannot be more than 2000 characters long")
+}
+
+func (app *application) commentCreate(resp http.ResponseWriter, req *http.Request) {
+	snippet, ok := app.readVisibleSnippet(resp, req)
+	if !ok {
+		return
+	}
+
+	var form commentForm
+	err := app.decodePostForm(req, &form)
+	if err != nil {
+		app.clientError(resp, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	// replies only nest one level deep, a reply to a reply goes to its parent
+	if form.ParentID != 0 {
+		parent, err := app.comments.Get(form.ParentID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.clientError(resp, http.StatusBadRequest)
+			} else {
+				app.serverError(resp, req, err)
+			}
+			return
+		}
+		if parent.SnippetID != snippet.ID {
+			app.clientError(resp, http.StatusBadRequest)
+			return
+		}
+		if parent.ParentID != 0 {
+			form.ParentID = parent.ParentID
+		}
+	}
+
+	if !form.IsValid() {
+		app.renderSnippetView(resp, req, http.StatusUnprocessableEntity, snippet, form)
+		return
+	}
+
+	id, err := app.comments.Insert(snippet.ID, app.authenticatedUserID(req), form.ParentID, form.Body)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	http.Redirect(resp, req, fmt.Sprintf("/snippets/view/%d#comment-%d", snippet.ID, id), http.StatusSeeOther)
+}
+
+// readComment loads the comment named by the :id route parameter together
+// with its snippet. Comments on snippets the current user may not see are not
+// found, like the snippets themselves.
+func (app *application) readComment(resp http.ResponseWriter, req *http.Request) (*models.Comment, *models.Snippet, bool) {
+	params := httprouter.ParamsFromContext(req.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(resp)
+		return nil, nil, false
+	}
+
+	comment, err := app.comments.Get(id)
+	if err == nil {
+		var snippet *models.Snippet
+		snippet, err = app.snippets.Get(comment.SnippetID)
+		if err == nil && !snippet.VisibleTo(app.authenticatedUserID(req)) {
+			err = models.ErrNoRecord
+		}
+		if err == nil {
+			return comment, snippet, true
+		}
+	}
+
+	if errors.Is(err, models.ErrNoRecord) {
+		app.notFound(resp)
+	} else {
+		app.serverError(resp, req, err)
+	}
+	return nil, nil, false
+}
+
+func (app *application) commentEditForm(resp http.ResponseWriter, req *http.Request) {
+	comment, snippet, ok := app.readComment(resp, req)
+	if !ok {
+		return
+	}
+	if comment.UserID != app.authenticatedUserID(req) {
+		app.clientError(resp, http.StatusForbidden)
+		return
+	}
+
+	data := app.newTemplateData(req)
+	data.Snippet = snippet
+	data.Comment = comment
+	data.Form = commentForm{Body: comment.Body}
+	app.render(resp, req, http.StatusOK, "comment.tmpl", data)
+}
+
+func (app *application) commentEdit(resp http.ResponseWriter, req *http.Request) {
+	comment, snippet, ok := app.readComment(resp, req)
+	if !ok {
+		return
+	}
+	if comment.UserID != app.authenticatedUserID(req) {
+		app.clientError(resp, http.StatusForbidden)
+		return
+	}
+
+	var form commentForm
+	err := app.decodePostForm(req, &form)
+	if err != nil {
+		app.clientError(resp, http.StatusBadRequest)
+		return
+	}
+
+	form.validate()
+
+	if !form.IsValid() {
+		data := app.newTemplateData(req)
+		data.Snippet = snippet
+		data.Comment = comment
+		data.Form = form
+		app.render(resp, req, http.StatusUnprocessableEntity, "comment.tmpl", data)
+		return
+	}
+
+	err = app.comments.Update(comment.ID, form.Body)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditCommentEdit,
+		TargetType: "comment",
+		TargetID:   comment.ID,
+		Changes:    map[string]models.AuditChange{"body": {Before: comment.Body, After: form.Body}},
+	})
+
+	http.Redirect(resp, req, fmt.Sprintf("/snippets/view/%d#comment-%d", snippet.ID, comment.ID), http.StatusSeeOther)
+}
+
+func (app *application) commentDelete(resp http.ResponseWriter, req *http.Request) {
+	comment, snippet, ok := app.readComment(resp, req)
+	if !ok {
+		return
+	}
+
+	// authors can delete their own comments, snippet owners moderate all of them
+	userID := app.authenticatedUserID(req)
+	if comment.UserID != userID && snippet.UserID != userID {
+		app.clientError(resp, http.StatusForbidden)
+		return
+	}
+
+	err := app.comments.Delete(comment.ID)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditCommentDelete,
+		TargetType: "comment",
+		TargetID:   comment.ID,
+		Details:    fmt.Sprintf("comment by @%s on snippet #%d", comment.Username, snippet.ID),
+		Changes:    map[string]models.AuditChange{"body": {Before: comment.Body}},
+	})
+
+	app.sessionManager.Put(req.Context(), "flash", "Comment deleted")
+
+	http.Redirect(resp, req, fmt.Sprintf("/snippets/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+type snippetReportForm struct {
+	Reason              string `form:"reason"`
+	Details             string `form:"details"`
+	validator.Validator `form:"-"`
+}
+
+var reportReasons = []string{"spam", "abuse", "illegal", "other"}
+
+func (app *application) snippetReportForm(resp http.ResponseWriter, req *http.Request) {
+	snippet, ok := app.readVisibleSnippet(resp, req)
+	if !ok {
+		return
+	}
+
+	data := app.newTemplateData(req)
+	data.Snippet = snippet
+	data.Form = snippetReportForm{}
+	app.render(resp, req, http.StatusOK, "report.tmpl", data)
+}
+
+func (app *application) snippetReport(resp http.ResponseWriter, req *http.Request) {
+	snippet, ok := app.readVisibleSnippet(resp, req)
+	if !ok {
+		return
+	}
+
+	var form snippetReportForm
+	err := app.decodePostForm(req, &form)
+	if err != nil {
+		app.clientError(resp, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.PermittedValue(form.Reason, reportReasons...), "reason", "please choose a reason")
+	form.CheckField(validator.MaxChars(form.Details, 500), "details", "This field cannot be more than 500 characters long")
+	form.CheckField(form.Reason != "other" || validator.IsNotBlank(form.Details), "details", "please describe the problem")
+
+	if !form.IsValid() {
+		data := app.newTemplateData(req)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(resp, req, http.StatusUnprocessableEntity, "report.tmpl", data)
+		return
+	}
+
+	reportID, err := app.reports.Insert(snippet.ID, app.authenticatedUserID(req), form.Reason, form.Details)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditSnippetReport,
+		TargetType: "report",
+		TargetID:   reportID,
+		Details:    fmt.Sprintf("snippet #%d reported for %s", snippet.ID, form.Reason),
+	})
+
+	app.sessionManager.Put(req.Context(), "flash", "Thank you, an administrator will review your report.")
+
+	http.Redirect(resp, req, fmt.Sprintf("/snippets/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+func (app *application) tagView(resp http.ResponseWriter, req *http.Request) {
+	params := httprouter.ParamsFromContext(req.Context())
+	tag := strings.ToLower(params.ByName("name"))
+	if !validator.Matches(tag, validator.TagRX) {
+		app.notFound(resp)
+		return
+	}
+
+	page := app.readPage(req)
+	snippets, err := app.snippets.ByTag(tag, pageSize+1, (page-1)*pageSize)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	data := app.newTemplateData(req)
+	data.Tag = tag
+	data.Snippets, data.Pagination = paginate(snippets, page, req.URL.Path+"?")
+	app.render(resp, req, http.StatusOK, "tag.tmpl", data)
+}
+
+func (app *application) snippetSearch(resp http.ResponseWriter, req *http.Request) {
+	query := strings.TrimSpace(req.URL.Query().Get("q"))
+	text, tags := parseSearchQuery(query)
+
+	// every tag filter must match, so a search for more tags than a snippet
+	// can have finds nothing and only costs a query per tag
+	var form validator.Validator
+	form.CheckField(len(tags) <= maxSnippetTags, "q", fmt.Sprintf("a search cannot filter by more than %d tags", maxSnippetTags))
+	if !form.IsValid() {
+		data := app.newTemplateData(req)
+		data.Query = query
+		data.Form = form
+		app.render(resp, req, http.StatusUnprocessableEntity, "search.tmpl", data)
+		return
+	}
+
+	page := app.readPage(req)
+	snippets := []*models.Snippet{}
+	if text != "" || len(tags) > 0 {
+		var err error
+		snippets, err = app.snippets.Search(text, tags, pageSize+1, (page-1)*pageSize)
+		if err != nil {
+			app.serverError(resp, req, err)
+			return
+		}
+	}
+
+	data := app.newTemplateData(req)
+	data.Query = query
+	data.Snippets, data.Pagination = paginate(snippets, page, "/search?"+url.Values{"q": {query}}.Encode()+"&")
+	app.render(resp, req, http.StatusOK, "search.tmpl", data)
+}
+
+type snippetImportForm struct {
+	Expires             int `form:"expires"`
+	Report              *importReport
+	validator.Validator `form:"-"`
+}
+
+func (app *application) snippetImportForm(resp http.ResponseWriter, req *http.Request) {
+	data := app.newTemplateData(req)
+	data.Form = snippetImportForm{
+		Expires: 365,
+	}
+	app.render(resp, req, http.StatusOK, "import.tmpl", data)
+}
+
+func (app *application) snippetImport(resp http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(resp, req.Body, maxImportSize)
+	err := req.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		app.clientError(resp, http.StatusBadRequest)
+		return
+	}
+	// parts beyond the memory limit are spooled to temporary files
+	defer req.MultipartForm.RemoveAll()
+
+	var form snippetImportForm
+	err = app.formDecoder.Decode(&form, req.PostForm)
+	if err != nil {
+		app.clientError(resp, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.PermittedInt(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+
+	var items []*importItem
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		form.AddFieldError("file", "please choose a file to import")
+	} else {
+		defer file.Close()
+		content, err := io.ReadAll(file)
+		if err != nil {
+			app.clientError(resp, http.StatusBadRequest)
+			return
+		}
+		items, err = parseImport(content)
+		if err != nil {
+			form.AddFieldError("file", err.Error())
+		}
+	}
+
+	if !form.IsValid() {
+		data := app.newTemplateData(req)
+		data.Form = form
+		app.render(resp, req, http.StatusUnprocessableEntity, "import.tmpl", data)
+		return
+	}
+
+	report, err := app.importSnippets(req, items, form.Expires)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	form.Report = report
+	data := app.newTemplateData(req)
+	data.Form = form
+	data.Flash = fmt.Sprintf("%d snippets imported, %d failed", report.Created, report.Failed)
+	app.render(resp, req, http.StatusOK, "import.tmpl", data)
+}
+
+func (app *application) apiSnippetImport(resp http.ResponseWriter, req *http.Request) {
+	expires := 365
+	if value := req.URL.Query().Get("expires"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || !validator.PermittedInt(n, 1, 7, 365) {
+			app.writeJSON(resp, req, http.StatusUnprocessableEntity, map[string]string{"error": "expires must equal 1, 7 or 365"})
+			return
+		}
+		expires = n
+	}
+
+	content, err := io.ReadAll(http.MaxBytesReader(resp, req.Body, maxImportSize))
+	if err != nil {
+		app.writeJSON(resp, req, http.StatusRequestEntityTooLarge, map[string]string{"error": "request body is too large"})
+		return
+	}
+
+	items, err := parseImport(content)
+	if err != nil {
+		app.writeJSON(resp, req, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+		return
+	}
+
+	report, err := app.importSnippets(req, items, expires)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	app.writeJSON(resp, req, http.StatusOK, report)
+}
+
 type userSignupForm struct {
 	Name                string `form:"name"`
+	Username            string `form:"username"`
 	Email               string `form:"email"`
 	Password            string `form:"password"`
 	validator.Validator `form:"-"`
@@ -122,7 +679,7 @@ type userSignupForm struct {
 func (app *application) userSignupForm(resp http.ResponseWriter, req *http.Request) {
 	data := app.newTemplateData(req)
 	data.Form = userSignupForm{}
-	app.render(resp, http.StatusOK, "signup.tmpl", data)
+	app.render(resp, req, http.StatusOK, "signup.tmpl", data)
 }
 func (app *application) userSignup(resp http.ResponseWriter, req *http.Request) {
 	var form userSignupForm
@@ -132,32 +689,54 @@ func (app *application) userSignup(resp http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	form.Username = strings.ToLower(strings.TrimSpace(form.Username))
+
 	form.CheckField(validator.IsNotBlank(form.Name), "name", "this field cannot be blank")
+	form.CheckField(validator.IsNotBlank(form.Username), "username", "this field cannot be blank")
+	form.CheckField(validator.Matches(form.Username, validator.UsernameRX), "username", "this field must be 3-30 letters, digits, '-' or '_' and start and end with a letter or digit")
 	form.CheckField(validator.IsNotBlank(form.Email), "email", "this field cannot be blank")
 	form.CheckField(validator.IsNotBlank(form.Password), "password", "this field cannot be blank")
 	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "this field must be a valid email address")
 	form.CheckField(validator.MinChars(form.Password, 8), "password", "this field must be at least 8 char")
+	checkPasswordStrength(&form.Validator, form.Password, form.Name, form.Username, form.Email)
 
 	if !form.IsValid() {
 		data := app.newTemplateData(req)
 		data.Form = form
-		app.render(resp, http.StatusUnprocessableEntity, "signup.tmpl", data)
+		app.render(resp, req, http.StatusUnprocessableEntity, "signup.tmpl", data)
 		return
 	}
 
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	id, err := app.users.Insert(form.Name, form.Username, form.Email, form.Password)
 	if err != nil {
-		if errors.Is(err, models.ErrDuplicateEmail) {
+		switch {
+		case errors.Is(err, models.ErrDuplicateEmail):
 			form.AddFieldError("email", "Email address is already in use")
-			data := app.newTemplateData(req)
-			data.Form = form
-			app.render(resp, http.StatusUnprocessableEntity, "signup.tmpl", data)
-		} else {
-			app.serverError(resp, err)
+		case errors.Is(err, models.ErrDuplicateUsername):
+			form.AddFieldError("username", "Username is already taken")
+		default:
+			app.serverError(resp, req, err)
+			return
 		}
+		data := app.newTemplateData(req)
+		data.Form = form
+		app.render(resp, req, http.StatusUnprocessableEntity, "signup.tmpl", data)
 		return
 	}
 
+	app.audit(req, &models.AuditEvent{
+		ActorID:       id,
+		ActorUsername: form.Username,
+		Action:        models.AuditSignup,
+		TargetType:    "user",
+		TargetID:      id,
+		Changes: map[string]models.AuditChange{
+			"name":     {After: form.Name},
+			"username": {After: form.Username},
+			"email":    {After: form.Email},
+		},
+	})
+
 	app.sessionManager.Put(req.Context(), "flash", "Your signup was successful. Please log in.")
 
 	http.Redirect(resp, req, "/user/login", http.StatusSeeOther)
@@ -166,13 +745,14 @@ func (app *application) userSignup(resp http.ResponseWriter, req *http.Request)
 type userLoginForm struct {
 	Email               string `form:"email"`
 	Password            string `form:"password"`
+	RememberMe          bool   `form:"remember_me"`
 	validator.Validator `form:"-"`
 }
 
 func (app *application) userLoginForm(resp http.ResponseWriter, req *http.Request) {
 	data := app.newTemplateData(req)
 	data.Form = userLoginForm{}
-	app.render(resp, http.StatusOK, "login.tmpl", data)
+	app.render(resp, req, http.StatusOK, "login.tmpl", data)
 }
 
 func (app *application) userLogin(resp http.ResponseWriter, req *http.Request) {
@@ -190,42 +770,140 @@ func (app *application) userLogin(resp http.ResponseWriter, req *http.Request) {
 	if !form.IsValid() {
 		data := app.newTemplateData(req)
 		data.Form = form
-		app.render(resp, http.StatusUnprocessableEntity, "login.tmpl", data)
+		app.render(resp, req, http.StatusUnprocessableEntity, "login.tmpl", data)
 		return
 	}
 
 	id, err := app.users.Authenticate(form.Email, form.Password)
+	if errors.Is(err, models.ErrRehashFailed) {
+		app.requestLogger(req).Error("upgrade password hash", "user_id", id, "error", err)
+		err = nil
+	}
 	if err != nil {
-		if errors.Is(err, models.ErrInvalidCredentials) {
+		switch {
+		case errors.Is(err, models.ErrInvalidCredentials):
 			form.AddNonFieldError("Email or password is incorrect")
-			data := app.newTemplateData(req)
-			data.Form = form
-			app.render(resp, http.StatusUnprocessableEntity, "login.tmpl", data)
-		} else {
-			app.serverError(resp, err)
+		case errors.Is(err, models.ErrAccountSuspended):
+			form.AddNonFieldError("Your account has been suspended")
+		default:
+			app.serverError(resp, req, err)
+			return
+		}
+		event := &models.AuditEvent{
+			Action:  models.AuditLoginFailed,
+			Details: fmt.Sprintf("email=%s: %s", form.Email, strings.TrimPrefix(err.Error(), "models: ")),
 		}
+		// the attempt targets the account of the email so it shows up in its
+		// login history, there is no actor yet
+		if target, err := app.users.GetByEmail(form.Email); err == nil {
+			event.TargetType, event.TargetID = "user", target.ID
+		}
+		app.audit(req, event)
+		data := app.newTemplateData(req)
+		data.Form = form
+		app.render(resp, req, http.StatusUnprocessableEntity, "login.tmpl", data)
 		return
 	}
 
-	err = app.sessionManager.RenewToken(req.Context())
+	user, err := app.users.Get(id)
 	if err != nil {
-		app.serverError(resp, err)
+		app.serverError(resp, req, err)
 		return
 	}
 
-	app.sessionManager.Put(req.Context(), "authenticatedUserID", id)
-	app.sessionManager.Put(req.Context(), "flash", "login success")
+	err = app.startSession(req, user, form.RememberMe, "password")
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
 
 	http.Redirect(resp, req, "/snippets/create", http.StatusSeeOther)
 }
 
 func (app *application) userLogout(resp http.ResponseWriter, req *http.Request) {
-	err := app.sessionManager.RenewToken(req.Context())
+	if app.isAuthenticated(req) {
+		app.audit(req, &models.AuditEvent{
+			Action:     models.AuditLogout,
+			TargetType: "user",
+			TargetID:   app.authenticatedUserID(req),
+		})
+	}
+
+	err := app.sessions.Forget(app.sessionManager.Token(req.Context()))
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(req.Context())
 	if err != nil {
-		app.serverError(resp, err)
+		app.serverError(resp, req, err)
 		return
 	}
 	app.sessionManager.Remove(req.Context(), "authenticatedUserID")
 	app.sessionManager.Put(req.Context(), "flash", "You've been logged out successfully!")
 	http.Redirect(resp, req, "/", http.StatusSeeOther)
 }
+
+func (app *application) userProfile(resp http.ResponseWriter, req *http.Request) {
+	params := httprouter.ParamsFromContext(req.Context())
+	user, err := app.users.GetByUsername(strings.ToLower(params.ByName("username")))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(resp)
+		} else {
+			app.serverError(resp, req, err)
+		}
+		return
+	}
+
+	page := app.readPage(req)
+	snippets, err := app.snippets.ByUser(user.ID, false, pageSize+1, (page-1)*pageSize)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	data := app.newTemplateData(req)
+	data.User = user
+	data.Snippets, data.Pagination = paginate(snippets, page, req.URL.Path+"?")
+	app.render(resp, req, http.StatusOK, "profile.tmpl", data)
+}
+
+func (app *application) userStarred(resp http.ResponseWriter, req *http.Request) {
+	params := httprouter.ParamsFromContext(req.Context())
+	user, err := app.users.GetByUsername(strings.ToLower(params.ByName("username")))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(resp)
+		} else {
+			app.serverError(resp, req, err)
+		}
+		return
+	}
+
+	page := app.readPage(req)
+	snippets, err := app.stars.StarredBy(user.ID, pageSize+1, (page-1)*pageSize)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	data := app.newTemplateData(req)
+	data.User = user
+	data.Snippets, data.Pagination = paginate(snippets, page, req.URL.Path+"?")
+	app.render(resp, req, http.StatusOK, "starred.tmpl", data)
+}
+
+func (app *application) userSnippets(resp http.ResponseWriter, req *http.Request) {
+	page := app.readPage(req)
+	snippets, err := app.snippets.ByUser(app.authenticatedUserID(req), true, pageSize+1, (page-1)*pageSize)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	data := app.newTemplateData(req)
+	data.Snippets, data.Pagination = paginate(snippets, page, req.URL.Path+"?")
+	app.render(resp, req, http.StatusOK, "dashboard.tmpl", data)
+}
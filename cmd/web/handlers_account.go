@@ -0,0 +1,489 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"snippetbox.labkita.my.id/internal/models"
+	"snippetbox.labkita.my.id/internal/validator"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// accountSession is a session shown on the account page.
+type accountSession struct {
+	*models.UserSession
+	Current bool
+}
+
+func (app *application) account(resp http.ResponseWriter, req *http.Request) {
+	sessions, err := app.sessions.ForUser(app.authenticatedUserID(req))
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	identities, err := app.identities.ForUser(app.authenticatedUserID(req))
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	current := app.sessionManager.Token(req.Context())
+	data := app.newTemplateData(req)
+	data.User = app.authenticatedUser(req)
+	data.Identities = identities
+	for _, s := range sessions {
+		data.Sessions = append(data.Sessions, &accountSession{UserSession: s, Current: s.Token == current})
+	}
+	app.render(resp, req, http.StatusOK, "account.tmpl", data)
+}
+
+func (app *application) accountSessionRevoke(resp http.ResponseWriter, req *http.Request) {
+	params := httprouter.ParamsFromContext(req.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(resp)
+		return
+	}
+
+	token, err := app.sessions.Revoke(app.authenticatedUserID(req), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(resp)
+		} else {
+			app.serverError(resp, req, err)
+		}
+		return
+	}
+
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditSessionRevoke,
+		TargetType: "session",
+		TargetID:   id,
+	})
+
+	// revoking the current session is the same as logging out, the session
+	// must not be saved again at the end of the request
+	if token == app.sessionManager.Token(req.Context()) {
+		err = app.sessionManager.RenewToken(req.Context())
+		if err != nil {
+			app.serverError(resp, req, err)
+			return
+		}
+		app.sessionManager.Remove(req.Context(), "authenticatedUserID")
+		app.sessionManager.Put(req.Context(), "flash", "You've been logged out successfully!")
+		http.Redirect(resp, req, "/", http.StatusSeeOther)
+		return
+	}
+
+	app.sessionManager.Put(req.Context(), "flash", "The session has been logged out.")
+	http.Redirect(resp, req, "/account", http.StatusSeeOther)
+}
+
+func (app *application) accountSessionRevokeOthers(resp http.ResponseWriter, req *http.Request) {
+	err := app.sessions.RevokeAll(app.authenticatedUserID(req), app.sessionManager.Token(req.Context()))
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditSessionRevokeOthers,
+		TargetType: "user",
+		TargetID:   app.authenticatedUserID(req),
+	})
+
+	app.sessionManager.Put(req.Context(), "flash", "All your other sessions have been logged out.")
+	http.Redirect(resp, req, "/account", http.StatusSeeOther)
+}
+
+type reauthForm struct {
+	Password            string `form:"password"`
+	Next                string `form:"next"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountReauthForm(resp http.ResponseWriter, req *http.Request) {
+	data := app.newTemplateData(req)
+	data.Form = reauthForm{Next: safeRedirect(req.URL.Query().Get("next"))}
+	app.render(resp, req, http.StatusOK, "reauth.tmpl", data)
+}
+
+func (app *application) accountReauth(resp http.ResponseWriter, req *http.Request) {
+	var form reauthForm
+	err := app.decodePostForm(req, &form)
+	if err != nil {
+		app.clientError(resp, http.StatusBadRequest)
+		return
+	}
+	form.Next = safeRedirect(form.Next)
+
+	form.CheckField(validator.IsNotBlank(form.Password), "password", "this field cannot be blank")
+	if form.IsValid() {
+		ok, err := app.users.PasswordMatches(app.authenticatedUserID(req), form.Password)
+		if err != nil {
+			app.serverError(resp, req, err)
+			return
+		}
+		if !ok {
+			app.audit(req, &models.AuditEvent{Action: models.AuditReauthFailed})
+			form.AddFieldError("password", "the password is incorrect")
+		}
+	}
+
+	if !form.IsValid() {
+		data := app.newTemplateData(req)
+		data.Form = form
+		app.render(resp, req, http.StatusUnprocessableEntity, "reauth.tmpl", data)
+		return
+	}
+
+	app.sessionManager.Put(req.Context(), "authTime", time.Now())
+	http.Redirect(resp, req, form.Next, http.StatusSeeOther)
+}
+
+type passwordChangeForm struct {
+	Password             string `form:"password"`
+	PasswordConfirmation string `form:"password_confirmation"`
+	validator.Validator  `form:"-"`
+}
+
+func (app *application) accountPasswordForm(resp http.ResponseWriter, req *http.Request) {
+	data := app.newTemplateData(req)
+	data.Form = passwordChangeForm{}
+	app.render(resp, req, http.StatusOK, "password.tmpl", data)
+}
+
+func (app *application) accountPassword(resp http.ResponseWriter, req *http.Request) {
+	var form passwordChangeForm
+	err := app.decodePostForm(req, &form)
+	if err != nil {
+		app.clientError(resp, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.IsNotBlank(form.Password), "password", "this field cannot be blank")
+	form.CheckField(validator.MinChars(form.Password, 8), "password", "this field must be at least 8 char")
+	user := app.authenticatedUser(req)
+	checkPasswordStrength(&form.Validator, form.Password, user.Name, user.Username, user.Email)
+	form.CheckField(form.Password == form.PasswordConfirmation, "password_confirmation", "the passwords don't match")
+
+	if !form.IsValid() {
+		data := app.newTemplateData(req)
+		data.Form = form
+		app.render(resp, req, http.StatusUnprocessableEntity, "password.tmpl", data)
+		return
+	}
+
+	id := user.ID
+	err = app.users.UpdatePassword(id, form.Password)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	// every other session is ended and this one gets a fresh token
+	err = app.sessionManager.RenewToken(req.Context())
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+	err = app.sessions.RevokeAll(id, "")
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+	err = app.trackSession(req, id)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditPasswordChange,
+		TargetType: "user",
+		TargetID:   id,
+	})
+
+	app.sessionManager.Put(req.Context(), "flash", "Your password has been changed, other sessions were logged out.")
+	http.Redirect(resp, req, "/account", http.StatusSeeOther)
+}
+
+// safeRedirect only allows local paths so the next parameter can't send users
+// to another site.
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/account"
+	}
+	return next
+}
+
+type accountDeleteForm struct {
+	Password            string `form:"password"`
+	Policy              string `form:"policy"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountDeleteForm(resp http.ResponseWriter, req *http.Request) {
+	data := app.newTemplateData(req)
+	data.Form = accountDeleteForm{Policy: models.DeletionPolicyAnonymize}
+	data.DeletionGrace = app.deletionGrace
+	app.render(resp, req, http.StatusOK, "delete.tmpl", data)
+}
+
+func (app *application) accountDelete(resp http.ResponseWriter, req *http.Request) {
+	var form accountDeleteForm
+	err := app.decodePostForm(req, &form)
+	if err != nil {
+		app.clientError(resp, http.StatusBadRequest)
+		return
+	}
+
+	user := app.authenticatedUser(req)
+	form.CheckField(validator.PermittedValue(form.Policy, models.DeletionPolicyAnonymize, models.DeletionPolicyDelete), "policy", "this field is invalid")
+	form.CheckField(validator.IsNotBlank(form.Password), "password", "this field cannot be blank")
+	if form.IsValid() {
+		ok, err := app.users.PasswordMatches(user.ID, form.Password)
+		if err != nil {
+			app.serverError(resp, req, err)
+			return
+		}
+		if !ok {
+			app.audit(req, &models.AuditEvent{Action: models.AuditReauthFailed, Details: "account deletion"})
+			form.AddFieldError("password", "the password is incorrect")
+		}
+	}
+
+	if !form.IsValid() {
+		data := app.newTemplateData(req)
+		data.Form = form
+		data.DeletionGrace = app.deletionGrace
+		app.render(resp, req, http.StatusUnprocessableEntity, "delete.tmpl", data)
+		return
+	}
+
+	deleteAt := time.Now().Add(app.deletionGrace)
+	err = app.users.ScheduleDeletion(user.ID, deleteAt, form.Policy)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	// only this session is left to cancel the deletion from
+	err = app.sessions.RevokeAll(user.ID, app.sessionManager.Token(req.Context()))
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditDeleteRequest,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Details:    fmt.Sprintf("policy=%s delete_at=%s", form.Policy, deleteAt.UTC().Format(time.RFC3339)),
+	})
+
+	app.sessionManager.Put(req.Context(), "flash", fmt.Sprintf("Your account will be deleted on %s.", humanDate(deleteAt)))
+	http.Redirect(resp, req, "/account", http.StatusSeeOther)
+}
+
+func (app *application) accountDeleteCancel(resp http.ResponseWriter, req *http.Request) {
+	user := app.authenticatedUser(req)
+	if user.DeleteAt == nil {
+		http.Redirect(resp, req, "/account", http.StatusSeeOther)
+		return
+	}
+
+	err := app.users.CancelDeletion(user.ID)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditDeleteCancel,
+		TargetType: "user",
+		TargetID:   user.ID,
+	})
+
+	app.sessionManager.Put(req.Context(), "flash", "Your account will not be deleted.")
+	http.Redirect(resp, req, "/account", http.StatusSeeOther)
+}
+
+// accountExport is the personal data of a user as handed out by the data
+// export.
+type accountExport struct {
+	Exported     time.Time            `json:"exported"`
+	Profile      exportProfile        `json:"profile"`
+	Snippets     []exportSnippet      `json:"snippets"`
+	Comments     []exportComment      `json:"comments"`
+	Starred      []int                `json:"starred_snippet_ids"`
+	Identities   []exportIdentity     `json:"sso_identities"`
+	Sessions     []exportSession      `json:"active_sessions"`
+	LoginHistory []*models.AuditEvent `json:"login_history"`
+}
+
+type exportProfile struct {
+	ID       int       `json:"id"`
+	Name     string    `json:"name"`
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	Created  time.Time `json:"created"`
+}
+
+type exportSnippet struct {
+	ID           int       `json:"id"`
+	Title        string    `json:"title"`
+	Content      string    `json:"content"`
+	Language     string    `json:"language,omitempty"`
+	Visibility   string    `json:"visibility"`
+	ForkedFromID int       `json:"forked_from_id,omitempty"`
+	Created      time.Time `json:"created"`
+	Expires      time.Time `json:"expires"`
+}
+
+type exportComment struct {
+	ID        int       `json:"id"`
+	SnippetID int       `json:"snippet_id"`
+	ParentID  int       `json:"parent_id,omitempty"`
+	Body      string    `json:"body"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+}
+
+type exportIdentity struct {
+	Issuer  string    `json:"issuer"`
+	Subject string    `json:"subject"`
+	Email   string    `json:"email,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+type exportSession struct {
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// exportBatch is the page size used to read every row of a listing.
+const exportBatch = 500
+
+func (app *application) accountExport(resp http.ResponseWriter, req *http.Request) {
+	user := app.authenticatedUser(req)
+	export := &accountExport{
+		Exported: time.Now().UTC(),
+		Profile: exportProfile{
+			ID:       user.ID,
+			Name:     user.Name,
+			Username: user.Username,
+			Email:    user.Email,
+			Role:     user.Role,
+			Created:  user.Created,
+		},
+		Snippets:     []exportSnippet{},
+		Starred:      []int{},
+		Identities:   []exportIdentity{},
+		Sessions:     []exportSession{},
+		LoginHistory: []*models.AuditEvent{},
+	}
+
+	for offset := 0; ; offset += exportBatch {
+		snippets, err := app.snippets.ByUser(user.ID, true, exportBatch, offset)
+		if err != nil {
+			app.serverError(resp, req, err)
+			return
+		}
+		for _, s := range snippets {
+			export.Snippets = append(export.Snippets, exportSnippet{
+				ID: s.ID, Title: s.Title, Content: s.Content, Language: s.Language, Visibility: s.Visibility,
+				ForkedFromID: s.ForkedFromID, Created: s.Created, Expires: s.Expires,
+			})
+		}
+		if len(snippets) < exportBatch {
+			break
+		}
+	}
+
+	for offset := 0; ; offset += exportBatch {
+		starred, err := app.stars.StarredBy(user.ID, exportBatch, offset)
+		if err != nil {
+			app.serverError(resp, req, err)
+			return
+		}
+		for _, s := range starred {
+			export.Starred = append(export.Starred, s.ID)
+		}
+		if len(starred) < exportBatch {
+			break
+		}
+	}
+
+	comments, err := app.comments.ByUser(user.ID)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+	export.Comments = make([]exportComment, 0, len(comments))
+	for _, c := range comments {
+		export.Comments = append(export.Comments, exportComment{
+			ID: c.ID, SnippetID: c.SnippetID, ParentID: c.ParentID, Body: c.Body, Created: c.Created, Updated: c.Updated,
+		})
+	}
+
+	identities, err := app.identities.ForUser(user.ID)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+	for _, i := range identities {
+		export.Identities = append(export.Identities, exportIdentity{Issuer: i.Issuer, Subject: i.Subject, Email: i.Email, Created: i.Created})
+	}
+
+	sessions, err := app.sessions.ForUser(user.ID)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+	for _, s := range sessions {
+		export.Sessions = append(export.Sessions, exportSession{IP: s.IP, UserAgent: s.UserAgent, Created: s.Created, LastSeen: s.LastSeen})
+	}
+
+	err = app.auditLog.Each(models.AuditFilter{ActorID: user.ID}, func(e *models.AuditEvent) error {
+		if strings.HasPrefix(e.Action, "user.") || strings.HasPrefix(e.Action, "session.") {
+			export.LoginHistory = append(export.LoginHistory, e)
+		}
+		return nil
+	})
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+	// failed logins have no actor, they target the account instead
+	failed := models.AuditFilter{Action: models.AuditLoginFailed, TargetType: "user", TargetID: user.ID}
+	err = app.auditLog.Each(failed, func(e *models.AuditEvent) error {
+		export.LoginHistory = append(export.LoginHistory, e)
+		return nil
+	})
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+	sort.Slice(export.LoginHistory, func(i, j int) bool {
+		return export.LoginHistory[i].ID < export.LoginHistory[j].ID
+	})
+
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditDataExport,
+		TargetType: "user",
+		TargetID:   user.ID,
+	})
+
+	filename := fmt.Sprintf("snippetbox-%s-%s.json", user.Username, export.Exported.Format("20060102"))
+	resp.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	app.writeJSON(resp, req, http.StatusOK, export)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"net/url"
+	"snippetbox.labkita.my.id/internal/models"
+	"snippetbox.labkita.my.id/internal/validator"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (app *application) adminReports(resp http.ResponseWriter, req *http.Request) {
+	page := app.readPage(req)
+	reports, err := app.reports.Open(pageSize+1, (page-1)*pageSize)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	actions, err := app.reports.RecentActions(20)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	data := app.newTemplateData(req)
+	data.Pagination = newPagination(page, len(reports), req.URL.Path+"?")
+	if data.Pagination.HasNext {
+		reports = reports[:pageSize]
+	}
+	data.Reports = reports
+	data.Actions = actions
+	app.render(resp, req, http.StatusOK, "admin_reports.tmpl", data)
+}
+
+func (app *application) adminReportResolve(resp http.ResponseWriter, req *http.Request) {
+	params := httprouter.ParamsFromContext(req.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(resp)
+		return
+	}
+
+	err = req.ParseForm()
+	if err != nil {
+		app.clientError(resp, http.StatusBadRequest)
+		return
+	}
+
+	action := req.PostForm.Get("action")
+	if !validator.PermittedValue(action, models.ReportActionHide, models.ReportActionDelete, models.ReportActionSuspend, models.ReportActionDismiss) {
+		app.clientError(resp, http.StatusBadRequest)
+		return
+	}
+	// moderators only hide snippets, deleting them and suspending their
+	// authors, who may be admins, is up to an admin
+	if (action == models.ReportActionDelete || action == models.ReportActionSuspend) && !app.hasRole(req, models.RoleAdmin) {
+		app.clientError(resp, http.StatusForbidden)
+		return
+	}
+
+	err = app.reports.Resolve(id, app.authenticatedUserID(req), action)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(resp)
+		} else {
+			app.serverError(resp, req, err)
+		}
+		return
+	}
+
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditReportResolve,
+		TargetType: "report",
+		TargetID:   id,
+		Details:    action,
+	})
+
+	app.sessionManager.Put(req.Context(), "flash", fmt.Sprintf("Report #%d resolved: %s", id, action))
+
+	http.Redirect(resp, req, "/admin/reports", http.StatusSeeOther)
+}
+
+func (app *application) adminDashboard(resp http.ResponseWriter, req *http.Request) {
+	stats, err := app.stats.Get()
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	data := app.newTemplateData(req)
+	data.Stats = stats
+	app.render(resp, req, http.StatusOK, "admin.tmpl", data)
+}
+
+func (app *application) adminUsers(resp http.ResponseWriter, req *http.Request) {
+	query := strings.TrimSpace(req.URL.Query().Get("q"))
+
+	page := app.readPage(req)
+	users, err := app.users.List(query, pageSize+1, (page-1)*pageSize)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	data := app.newTemplateData(req)
+	data.Query = query
+	data.Pagination = newPagination(page, len(users), "/admin/users?"+url.Values{"q": {query}}.Encode()+"&")
+	if data.Pagination.HasNext {
+		users = users[:pageSize]
+	}
+	data.Users = users
+	app.render(resp, req, http.StatusOK, "admin_users.tmpl", data)
+}
+
+// readUser loads the user named by the :id route parameter.
+func (app *application) readUser(resp http.ResponseWriter, req *http.Request) (*models.User, bool) {
+	params := httprouter.ParamsFromContext(req.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(resp)
+		return nil, false
+	}
+
+	user, err := app.users.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(resp)
+		} else {
+			app.serverError(resp, req, err)
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+func (app *application) adminUserSuspend(resp http.ResponseWriter, req *http.Request) {
+	user, ok := app.readUser(resp, req)
+	if !ok {
+		return
+	}
+	if user.ID == app.authenticatedUserID(req) {
+		app.sessionManager.Put(req.Context(), "flash", "You cannot suspend your own account")
+		http.Redirect(resp, req, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	err := app.users.SetSuspended(user.ID, true)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditUserSuspend,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Changes:    map[string]models.AuditChange{"suspended": {Before: user.Suspended, After: true}},
+	})
+	// authenticate already rejects suspended users, this just frees the rows
+	err = app.logoutUser(user.ID)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	app.sessionManager.Put(req.Context(), "flash", fmt.Sprintf("@%s has been suspended", user.Username))
+	http.Redirect(resp, req, "/admin/users", http.StatusSeeOther)
+}
+
+func (app *application) adminUserUnsuspend(resp http.ResponseWriter, req *http.Request) {
+	user, ok := app.readUser(resp, req)
+	if !ok {
+		return
+	}
+
+	err := app.users.SetSuspended(user.ID, false)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditUserUnsuspend,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Changes:    map[string]models.AuditChange{"suspended": {Before: user.Suspended, After: false}},
+	})
+
+	app.sessionManager.Put(req.Context(), "flash", fmt.Sprintf("@%s has been unsuspended", user.Username))
+	http.Redirect(resp, req, "/admin/users", http.StatusSeeOther)
+}
+
+func (app *application) adminUserLogout(resp http.ResponseWriter, req *http.Request) {
+	user, ok := app.readUser(resp, req)
+	if !ok {
+		return
+	}
+
+	err := app.logoutUser(user.ID)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditUserLogout,
+		TargetType: "user",
+		TargetID:   user.ID,
+	})
+
+	app.sessionManager.Put(req.Context(), "flash", fmt.Sprintf("@%s has been logged out everywhere", user.Username))
+	http.Redirect(resp, req, "/admin/users", http.StatusSeeOther)
+}
+
+type auditFilterForm struct {
+	Action              string `form:"action"`
+	Actor               string `form:"actor"`
+	TargetType          string `form:"target_type"`
+	TargetID            string `form:"target_id"`
+	IP                  string `form:"ip"`
+	Since               string `form:"since"`
+	Until               string `form:"until"`
+	validator.Validator `form:"-"`
+}
+
+// readAuditFilter reads the filters from the query string, since and until
+// are whole days and until is inclusive.
+func (app *application) readAuditFilter(req *http.Request) (*auditFilterForm, models.AuditFilter) {
+	query := req.URL.Query()
+	form := &auditFilterForm{
+		Action:     strings.TrimSpace(query.Get("action")),
+		Actor:      strings.TrimPrefix(strings.TrimSpace(query.Get("actor")), "@"),
+		TargetType: strings.TrimSpace(query.Get("target_type")),
+		TargetID:   strings.TrimSpace(query.Get("target_id")),
+		IP:         strings.TrimSpace(query.Get("ip")),
+		Since:      strings.TrimSpace(query.Get("since")),
+		Until:      strings.TrimSpace(query.Get("until")),
+	}
+	filter := models.AuditFilter{
+		Action:        form.Action,
+		ActorUsername: form.Actor,
+		TargetType:    form.TargetType,
+		IP:            form.IP,
+	}
+
+	if form.TargetID != "" {
+		id, err := strconv.Atoi(form.TargetID)
+		form.CheckField(err == nil && id > 0, "target_id", "this field must be a positive number")
+		filter.TargetID = id
+	}
+	if form.Since != "" {
+		since, err := time.Parse("2006-01-02", form.Since)
+		form.CheckField(err == nil, "since", "this field must be a date like 2006-01-02")
+		filter.Since = since
+	}
+	if form.Until != "" {
+		until, err := time.Parse("2006-01-02", form.Until)
+		form.CheckField(err == nil, "until", "this field must be a date like 2006-01-02")
+		filter.Until = until.AddDate(0, 0, 1)
+	}
+	return form, filter
+}
+
+func (f *auditFilterForm) query() url.Values {
+	values := url.Values{}
+	for key, value := range map[string]string{
+		"action": f.Action, "actor": f.Actor, "target_type": f.TargetType, "target_id": f.TargetID,
+		"ip": f.IP, "since": f.Since, "until": f.Until,
+	} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	return values
+}
+
+func (app *application) adminAudit(resp http.ResponseWriter, req *http.Request) {
+	form, filter := app.readAuditFilter(req)
+
+	data := app.newTemplateData(req)
+	data.Form = form
+	data.Query = form.query().Encode()
+	if !form.IsValid() {
+		app.render(resp, req, http.StatusUnprocessableEntity, "admin_audit.tmpl", data)
+		return
+	}
+
+	page := app.readPage(req)
+	events, err := app.auditLog.List(filter, pageSize+1, (page-1)*pageSize)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	baseURL := "/admin/audit?"
+	if data.Query != "" {
+		baseURL += data.Query + "&"
+	}
+	data.Pagination = newPagination(page, len(events), baseURL)
+	if data.Pagination.HasNext {
+		events = events[:pageSize]
+	}
+	data.Audit = events
+	app.render(resp, req, http.StatusOK, "admin_audit.tmpl", data)
+}
+
+// auditExportTimeout is how long the audit export may take to be written.
+const auditExportTimeout = 5 * time.Minute
+
+// adminAuditExport sends the matching events as JSON lines, oldest first.
+func (app *application) adminAuditExport(resp http.ResponseWriter, req *http.Request) {
+	form, filter := app.readAuditFilter(req)
+	if !form.IsValid() {
+		app.clientError(resp, http.StatusBadRequest)
+		return
+	}
+
+	// the whole export is read before anything is sent, so a failing read
+	// ends in an error page instead of a cut off file
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	err := app.auditLog.Each(filter, func(e *models.AuditEvent) error {
+		return enc.Encode(e)
+	})
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	filename := fmt.Sprintf("audit-%s.jsonl", time.Now().UTC().Format("20060102-150405"))
+	resp.Header().Set("Content-Type", "application/x-ndjson")
+	resp.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	resp.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(resp)
+}
@@ -0,0 +1,987 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"snippetbox.labkita.my.id/internal/models"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errStoreDown = errors.New("store is down")
+
+func TestPublicPages(t *testing.T) {
+	app, m := newTestApplication(t)
+	private := m.snippets.Add(&models.Snippet{UserID: aliceID, Title: "Private notes", Visibility: models.VisibilityPrivate, Expires: time.Now().Add(time.Hour)})
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"home", "/", http.StatusOK, "An old silent pond"},
+		{"snippet list", "/snippets", http.StatusOK, "An old silent pond"},
+		{"snippet", "/snippets/view/1", http.StatusOK, "An old silent pond..."},
+		{"missing snippet", "/snippets/view/99", http.StatusNotFound, ""},
+		{"negative id", "/snippets/view/-1", http.StatusNotFound, ""},
+		{"string id", "/snippets/view/foo", http.StatusNotFound, ""},
+		{"private snippet", "/snippets/view/" + itoa(private), http.StatusNotFound, ""},
+		{"tag", "/tags/haiku", http.StatusOK, "An old silent pond"},
+		{"invalid tag", "/tags/no%20tag", http.StatusNotFound, ""},
+		{"search", "/search?q=pond", http.StatusOK, "An old silent pond"},
+		{"search by tag", "/search?q=tag:haiku", http.StatusOK, "An old silent pond"},
+		{"empty search", "/search", http.StatusOK, ""},
+		{"repeated tag filters", "/search?q=tag:haiku+tag:haiku+tag:haiku+tag:haiku+tag:haiku+tag:HAIKU", http.StatusOK, "An old silent pond"},
+		{"too many tag filters", "/search?q=tag:a+tag:b+tag:c+tag:d+tag:e+tag:f", http.StatusUnprocessableEntity, "cannot filter by more than 5 tags"},
+		{"profile", "/u/alice", http.StatusOK, "An old silent pond"},
+		{"missing profile", "/u/nobody", http.StatusNotFound, ""},
+		{"starred", "/u/alice/starred", http.StatusOK, ""},
+		{"missing starred", "/u/nobody/starred", http.StatusNotFound, ""},
+		{"signup", "/user/signup", http.StatusOK, "<form"},
+		{"login", "/user/login", http.StatusOK, "<form"},
+		{"static", "/static/css/main.css", http.StatusOK, ""},
+		{"unknown", "/missing", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.path)
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body doesn't contain %q", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestProtectedRoutesRequireLogin(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/snippets/create"},
+		{http.MethodPost, "/snippets/create"},
+		{http.MethodPost, "/snippets/fork/1"},
+		{http.MethodPost, "/snippets/star/1"},
+		{http.MethodPost, "/snippets/unstar/1"},
+		{http.MethodPost, "/snippets/comment/1"},
+		{http.MethodGet, "/comments/edit/1"},
+		{http.MethodPost, "/comments/edit/1"},
+		{http.MethodPost, "/comments/delete/1"},
+		{http.MethodGet, "/snippets/report/1"},
+		{http.MethodPost, "/snippets/report/1"},
+		{http.MethodGet, "/snippets/import"},
+		{http.MethodPost, "/snippets/import"},
+		{http.MethodGet, "/user/snippets"},
+		{http.MethodGet, "/account"},
+		{http.MethodPost, "/account/sessions/revoke/1"},
+		{http.MethodPost, "/account/sessions/revoke-others"},
+		{http.MethodGet, "/account/reauth"},
+		{http.MethodPost, "/account/reauth"},
+		{http.MethodPost, "/account/reauth/oidc"},
+		{http.MethodPost, "/account/identities/link"},
+		{http.MethodGet, "/account/delete"},
+		{http.MethodPost, "/account/delete"},
+		{http.MethodPost, "/account/delete/cancel"},
+		{http.MethodGet, "/account/password"},
+		{http.MethodPost, "/account/password"},
+		{http.MethodGet, "/account/export"},
+		{http.MethodGet, "/admin/reports"},
+		{http.MethodPost, "/admin/reports/resolve/1"},
+		{http.MethodGet, "/admin"},
+		{http.MethodGet, "/admin/users"},
+		{http.MethodPost, "/admin/users/suspend/2"},
+		{http.MethodPost, "/admin/users/unsuspend/2"},
+		{http.MethodPost, "/admin/users/logout/2"},
+		{http.MethodGet, "/admin/audit"},
+		{http.MethodGet, "/admin/audit/export"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			var code int
+			var header http.Header
+			if tt.method == http.MethodGet {
+				code, header, _ = ts.get(t, tt.path)
+			} else {
+				code, header, _ = ts.postForm(t, tt.path, nil)
+			}
+			if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+				t.Errorf("got status %d to %q; want a redirect to /user/login", code, header.Get("Location"))
+			}
+		})
+	}
+}
+
+func TestRoles(t *testing.T) {
+	tests := []struct {
+		user     string
+		path     string
+		wantCode int
+	}{
+		{"alice", "/admin/reports", http.StatusForbidden},
+		{"alice", "/admin", http.StatusForbidden},
+		{"alice", "/admin/users", http.StatusForbidden},
+		{"alice", "/admin/audit", http.StatusForbidden},
+		{"alice", "/admin/audit/export", http.StatusForbidden},
+		{"molly", "/admin/reports", http.StatusOK},
+		{"molly", "/admin", http.StatusForbidden},
+		{"molly", "/admin/users", http.StatusForbidden},
+		{"molly", "/admin/audit", http.StatusForbidden},
+		{"adam", "/admin/reports", http.StatusOK},
+		{"adam", "/admin", http.StatusOK},
+		{"adam", "/admin/users", http.StatusOK},
+		{"adam", "/admin/audit", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.user+" "+tt.path, func(t *testing.T) {
+			app, _ := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+			ts.login(t, tt.user)
+
+			code, _, _ := ts.get(t, tt.path)
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	t.Run("alice POST /admin/users/suspend/2", func(t *testing.T) {
+		app, m := newTestApplication(t)
+		ts := newTestServer(t, app.routes())
+		ts.login(t, "alice")
+
+		code, _, _ := ts.postForm(t, "/admin/users/suspend/2", nil)
+		if code != http.StatusForbidden {
+			t.Errorf("got status %d; want %d", code, http.StatusForbidden)
+		}
+		if bob, _ := m.users.Get(bobID); bob.Suspended {
+			t.Error("bob was suspended")
+		}
+	})
+}
+
+func TestStoreErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   string
+		method string
+		path   string
+		form   url.Values
+		breaks func(m *testMocks)
+	}{
+		{"home snippets", "", http.MethodGet, "/", nil, func(m *testMocks) { m.snippets.Err = errStoreDown }},
+		{"home tags", "", http.MethodGet, "/", nil, func(m *testMocks) { m.tags.Err = errStoreDown }},
+		{"home stars", "", http.MethodGet, "/", nil, func(m *testMocks) { m.stars.Err = errStoreDown }},
+		{"snippet list", "", http.MethodGet, "/snippets", nil, func(m *testMocks) { m.snippets.Err = errStoreDown }},
+		{"snippet", "", http.MethodGet, "/snippets/view/1", nil, func(m *testMocks) { m.snippets.Err = errStoreDown }},
+		{"snippet comments", "", http.MethodGet, "/snippets/view/1", nil, func(m *testMocks) { m.comments.Err = errStoreDown }},
+		{"snippet star", "alice", http.MethodGet, "/snippets/view/1", nil, func(m *testMocks) { m.stars.Err = errStoreDown }},
+		{"tag", "", http.MethodGet, "/tags/haiku", nil, func(m *testMocks) { m.snippets.Err = errStoreDown }},
+		{"search", "", http.MethodGet, "/search?q=pond", nil, func(m *testMocks) { m.snippets.Err = errStoreDown }},
+		{"profile user", "", http.MethodGet, "/u/alice", nil, func(m *testMocks) { m.users.Err = errStoreDown }},
+		{"profile snippets", "", http.MethodGet, "/u/alice", nil, func(m *testMocks) { m.snippets.Err = errStoreDown }},
+		{"starred", "", http.MethodGet, "/u/alice/starred", nil, func(m *testMocks) { m.stars.Err = errStoreDown }},
+		{"signup", "", http.MethodPost, "/user/signup", url.Values{
+			"name": {"Zed"}, "username": {"zed"}, "email": {"zed@example.com"}, "password": {"Correct-Horse-77-Battery"},
+		}, func(m *testMocks) { m.users.Err = errStoreDown }},
+		{"login", "", http.MethodPost, "/user/login", url.Values{"email": {"alice@example.com"}, "password": {"pa$$word"}}, func(m *testMocks) { m.users.Err = errStoreDown }},
+		{"login session", "", http.MethodPost, "/user/login", url.Values{"email": {"alice@example.com"}, "password": {"pa$$word"}}, func(m *testMocks) { m.sessions.Err = errStoreDown }},
+		{"authenticate", "alice", http.MethodGet, "/", nil, func(m *testMocks) { m.users.Err = errStoreDown }},
+		{"dashboard", "alice", http.MethodGet, "/user/snippets", nil, func(m *testMocks) { m.snippets.Err = errStoreDown }},
+		{"create", "alice", http.MethodPost, "/snippets/create", url.Values{
+			"title": {"Title"}, "content": {"Content"}, "expires": {"7"}, "visibility": {"public"},
+		}, func(m *testMocks) { m.snippets.Err = errStoreDown }},
+		{"fork", "alice", http.MethodPost, "/snippets/fork/1", nil, func(m *testMocks) { m.snippets.Err = errStoreDown }},
+		{"star", "alice", http.MethodPost, "/snippets/star/1", nil, func(m *testMocks) { m.stars.Err = errStoreDown }},
+		{"unstar", "alice", http.MethodPost, "/snippets/unstar/1", nil, func(m *testMocks) { m.stars.Err = errStoreDown }},
+		{"comment", "alice", http.MethodPost, "/snippets/comment/1", url.Values{"body": {"Nice"}}, func(m *testMocks) { m.comments.Err = errStoreDown }},
+		{"comment edit", "alice", http.MethodGet, "/comments/edit/1", nil, func(m *testMocks) { m.comments.Err = errStoreDown }},
+		{"comment delete", "alice", http.MethodPost, "/comments/delete/1", nil, func(m *testMocks) { m.comments.Err = errStoreDown }},
+		{"report", "alice", http.MethodPost, "/snippets/report/1", url.Values{"reason": {"spam"}}, func(m *testMocks) { m.reports.Err = errStoreDown }},
+		{"account sessions", "alice", http.MethodGet, "/account", nil, func(m *testMocks) { m.sessions.Err = errStoreDown }},
+		{"account identities", "alice", http.MethodGet, "/account", nil, func(m *testMocks) { m.identities.Err = errStoreDown }},
+		{"revoke", "alice", http.MethodPost, "/account/sessions/revoke/1", nil, func(m *testMocks) { m.sessions.Err = errStoreDown }},
+		{"revoke others", "alice", http.MethodPost, "/account/sessions/revoke-others", nil, func(m *testMocks) { m.sessions.Err = errStoreDown }},
+		{"export snippets", "alice", http.MethodGet, "/account/export", nil, func(m *testMocks) { m.snippets.Err = errStoreDown }},
+		{"export comments", "alice", http.MethodGet, "/account/export", nil, func(m *testMocks) { m.comments.Err = errStoreDown }},
+		{"export audit", "alice", http.MethodGet, "/account/export", nil, func(m *testMocks) { m.auditLog.Err = errStoreDown }},
+		{"delete cancel", "alice", http.MethodPost, "/account/delete", url.Values{"policy": {"anonymize"}, "password": {"pa$$word"}}, func(m *testMocks) { m.sessions.Err = errStoreDown }},
+		{"logout", "alice", http.MethodPost, "/user/logout", nil, func(m *testMocks) { m.sessions.Err = errStoreDown }},
+		{"admin dashboard", "adam", http.MethodGet, "/admin", nil, func(m *testMocks) { m.stats.Err = errStoreDown }},
+		{"admin audit", "adam", http.MethodGet, "/admin/audit", nil, func(m *testMocks) { m.auditLog.Err = errStoreDown }},
+		{"admin audit export", "adam", http.MethodGet, "/admin/audit/export", nil, func(m *testMocks) { m.auditLog.Err = errStoreDown }},
+		{"admin logout user", "adam", http.MethodPost, "/admin/users/logout/2", nil, func(m *testMocks) { m.sessions.Err = errStoreDown }},
+		{"admin reports", "molly", http.MethodGet, "/admin/reports", nil, func(m *testMocks) { m.reports.Err = errStoreDown }},
+		{"admin resolve", "molly", http.MethodPost, "/admin/reports/resolve/1", url.Values{"action": {"dismiss"}}, func(m *testMocks) { m.reports.Err = errStoreDown }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, m := newTestApplication(t)
+			if _, err := m.comments.Insert(1, aliceID, 0, "First"); err != nil {
+				t.Fatal(err)
+			}
+			ts := newTestServer(t, app.routes())
+			if tt.user != "" {
+				ts.login(t, tt.user)
+			}
+
+			form := url.Values{}
+			for key, values := range tt.form {
+				form[key] = values
+			}
+			if tt.method == http.MethodPost {
+				form.Set("csrf_token", ts.csrfToken(t))
+			}
+
+			tt.breaks(m)
+			var code int
+			if tt.method == http.MethodGet {
+				code, _, _ = ts.get(t, tt.path)
+			} else {
+				code, _, _ = ts.postForm(t, tt.path, form)
+			}
+			if code != http.StatusInternalServerError {
+				t.Errorf("got status %d; want %d", code, http.StatusInternalServerError)
+			}
+		})
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	form := url.Values{"email": {"alice@example.com"}, "password": {"pa$$word"}, "csrf_token": {"wrong"}}
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusBadRequest {
+		t.Errorf("got status %d; want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestUserSignup(t *testing.T) {
+	tests := []struct {
+		name         string
+		username     string
+		email        string
+		password     string
+		wantCode     int
+		wantLocation string
+		wantBody     string
+	}{
+		{"valid", "zed", "zed@example.com", "Correct-Horse-77-Battery", http.StatusSeeOther, "/user/login", ""},
+		{"blank username", "", "zed@example.com", "Correct-Horse-77-Battery", http.StatusUnprocessableEntity, "", "this field cannot be blank"},
+		{"invalid email", "zed", "zed@", "Correct-Horse-77-Battery", http.StatusUnprocessableEntity, "", "valid email address"},
+		{"common password", "zed", "zed@example.com", "password", http.StatusUnprocessableEntity, "", "too common"},
+		{"every failed password rule", "zed", "zed@example.com", "password", http.StatusUnprocessableEntity, "", "too common, it appears in lists of breached passwords; this password is too easy to guess"},
+		{"duplicate email", "zed", "alice@example.com", "Correct-Horse-77-Battery", http.StatusUnprocessableEntity, "", "Email address is already in use"},
+		{"duplicate username", "alice", "zed@example.com", "Correct-Horse-77-Battery", http.StatusUnprocessableEntity, "", "Username is already taken"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := newTestApplication(t)
+			ts := newTestServer(t, app.routes())
+
+			form := url.Values{"name": {"Zed Zero"}, "username": {tt.username}, "email": {tt.email}, "password": {tt.password}}
+			code, header, body := ts.postForm(t, "/user/signup", form)
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			if header.Get("Location") != tt.wantLocation {
+				t.Errorf("got location %q; want %q", header.Get("Location"), tt.wantLocation)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body doesn't contain %q", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUserLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantCode int
+		wantBody string
+	}{
+		{"valid", "alice@example.com", "pa$$word", http.StatusSeeOther, ""},
+		{"wrong password", "alice@example.com", "wrong", http.StatusUnprocessableEntity, "Email or password is incorrect"},
+		{"unknown email", "nobody@example.com", "pa$$word", http.StatusUnprocessableEntity, "Email or password is incorrect"},
+		{"blank", "", "", http.StatusUnprocessableEntity, "this field cannot be blank"},
+		{"suspended", "bob@example.com", "pa$$word", http.StatusUnprocessableEntity, "Your account has been suspended"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, m := newTestApplication(t)
+			m.users.SetSuspended(bobID, true)
+			ts := newTestServer(t, app.routes())
+
+			code, _, body := ts.postForm(t, "/user/login", url.Values{"email": {tt.email}, "password": {tt.password}})
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body doesn't contain %q", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestUserLogout(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, "alice")
+
+	code, header, _ := ts.postForm(t, "/user/logout", nil)
+	if code != http.StatusSeeOther || header.Get("Location") != "/" {
+		t.Fatalf("got status %d to %q; want a redirect to /", code, header.Get("Location"))
+	}
+	if code, _, _ = ts.get(t, "/account"); code != http.StatusSeeOther {
+		t.Errorf("got status %d after logout; want %d", code, http.StatusSeeOther)
+	}
+	if sessions, _ := m.sessions.ForUser(aliceID); len(sessions) != 0 {
+		t.Errorf("got %d tracked sessions after logout", len(sessions))
+	}
+}
+
+func TestSnippetCreate(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, "alice")
+
+	if code, _, body := ts.get(t, "/snippets/create"); code != http.StatusOK || !strings.Contains(body, "<form") {
+		t.Errorf("got status %d for the form", code)
+	}
+
+	form := url.Values{"title": {"New"}, "content": {"Content"}, "expires": {"7"}, "visibility": {"unlisted"}, "tags": {"go, test"}}
+	code, header, _ := ts.postForm(t, "/snippets/create", form)
+	if code != http.StatusSeeOther || header.Get("Location") != "/snippets/view/2" {
+		t.Fatalf("got status %d to %q", code, header.Get("Location"))
+	}
+	snippet, err := m.snippets.Get(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snippet.UserID != aliceID || snippet.Visibility != models.VisibilityUnlisted || strings.Join(snippet.Tags, ",") != "go,test" {
+		t.Errorf("got snippet %+v", snippet)
+	}
+
+	form.Set("expires", "2")
+	if code, _, _ = ts.postForm(t, "/snippets/create", form); code != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d for an invalid form; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	if code, _, body := ts.get(t, "/user/snippets"); code != http.StatusOK || !strings.Contains(body, "New") {
+		t.Errorf("got status %d for the dashboard", code)
+	}
+}
+
+func TestSnippetFork(t *testing.T) {
+	app, m := newTestApplication(t)
+	hidden := m.snippets.Add(&models.Snippet{UserID: aliceID, Title: "Hidden", Visibility: models.VisibilityPublic, Hidden: true, Expires: time.Now().Add(time.Hour)})
+	private := m.snippets.Add(&models.Snippet{UserID: bobID, Title: "Private", Visibility: models.VisibilityPrivate, Expires: time.Now().Add(time.Hour)})
+	ts := newTestServer(t, app.routes())
+	ts.login(t, "alice")
+
+	tests := []struct {
+		name         string
+		path         string
+		wantCode     int
+		wantLocation string
+	}{
+		{"public", "/snippets/fork/1", http.StatusSeeOther, "/snippets/view/4"},
+		{"hidden", "/snippets/fork/" + itoa(hidden), http.StatusForbidden, ""},
+		{"private of another user", "/snippets/fork/" + itoa(private), http.StatusNotFound, ""},
+		{"missing", "/snippets/fork/99", http.StatusNotFound, ""},
+		{"invalid id", "/snippets/fork/x", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, _ := ts.postForm(t, tt.path, nil)
+			if code != tt.wantCode || header.Get("Location") != tt.wantLocation {
+				t.Errorf("got status %d to %q; want %d to %q", code, header.Get("Location"), tt.wantCode, tt.wantLocation)
+			}
+		})
+	}
+
+	fork, err := m.snippets.Get(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.ForkedFromID != 1 || fork.UserID != aliceID {
+		t.Errorf("got fork %+v", fork)
+	}
+}
+
+func TestSnippetStar(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, "bob")
+
+	code, header, _ := ts.postForm(t, "/snippets/star/1", nil)
+	if code != http.StatusSeeOther || header.Get("Location") != "/snippets/view/1" {
+		t.Fatalf("got status %d to %q", code, header.Get("Location"))
+	}
+	if starred, _ := m.stars.Exists(bobID, 1); !starred {
+		t.Error("the snippet wasn't starred")
+	}
+	if _, _, body := ts.get(t, "/u/bob/starred"); !strings.Contains(body, "An old silent pond") {
+		t.Error("the starred page doesn't list the snippet")
+	}
+
+	if code, _, _ = ts.postForm(t, "/snippets/unstar/1", nil); code != http.StatusSeeOther {
+		t.Errorf("got status %d for unstar", code)
+	}
+	if starred, _ := m.stars.Exists(bobID, 1); starred {
+		t.Error("the snippet is still starred")
+	}
+
+	if code, _, _ = ts.postForm(t, "/snippets/star/99", nil); code != http.StatusNotFound {
+		t.Errorf("got status %d for a missing snippet; want %d", code, http.StatusNotFound)
+	}
+	if code, _, _ = ts.postForm(t, "/snippets/unstar/x", nil); code != http.StatusNotFound {
+		t.Errorf("got status %d for an invalid id; want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestComments(t *testing.T) {
+	app, m := newTestApplication(t)
+	handler := app.routes()
+	alice := newTestServer(t, handler)
+	alice.login(t, "alice")
+	bob := newTestServer(t, handler)
+	bob.login(t, "bob")
+
+	code, header, _ := alice.postForm(t, "/snippets/comment/1", url.Values{"body": {"First"}})
+	if code != http.StatusSeeOther || header.Get("Location") != "/snippets/view/1#comment-1" {
+		t.Fatalf("got status %d to %q", code, header.Get("Location"))
+	}
+	code, header, _ = bob.postForm(t, "/snippets/comment/1", url.Values{"body": {"Reply"}, "parent_id": {"1"}})
+	if code != http.StatusSeeOther || header.Get("Location") != "/snippets/view/1#comment-2" {
+		t.Fatalf("got status %d to %q", code, header.Get("Location"))
+	}
+	if _, _, body := bob.get(t, "/snippets/view/1"); !strings.Contains(body, "First") || !strings.Contains(body, "Reply") {
+		t.Error("the snippet page doesn't show the comments")
+	}
+
+	// bob's comment on a snippet of alice that a moderator hides afterwards
+	hidden := m.snippets.Add(&models.Snippet{UserID: aliceID, Title: "Hidden later", Visibility: models.VisibilityPublic, Expires: time.Now().Add(time.Hour)})
+	hiddenComment, err := m.comments.Insert(hidden, bobID, 0, "Gone soon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.snippets.SetHidden(hidden, true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		ts       *testServer
+		method   string
+		path     string
+		form     url.Values
+		wantCode int
+	}{
+		{"blank", bob, http.MethodPost, "/snippets/comment/1", url.Values{"body": {""}}, http.StatusUnprocessableEntity},
+		{"missing parent", bob, http.MethodPost, "/snippets/comment/1", url.Values{"body": {"Hi"}, "parent_id": {"99"}}, http.StatusBadRequest},
+		{"missing snippet", bob, http.MethodPost, "/snippets/comment/99", url.Values{"body": {"Hi"}}, http.StatusNotFound},
+		{"edit form", alice, http.MethodGet, "/comments/edit/1", nil, http.StatusOK},
+		{"edit form of another user", bob, http.MethodGet, "/comments/edit/1", nil, http.StatusForbidden},
+		{"edit form of a missing comment", alice, http.MethodGet, "/comments/edit/99", nil, http.StatusNotFound},
+		{"edit", alice, http.MethodPost, "/comments/edit/1", url.Values{"body": {"First, edited"}}, http.StatusSeeOther},
+		{"edit blank", alice, http.MethodPost, "/comments/edit/1", url.Values{"body": {""}}, http.StatusUnprocessableEntity},
+		{"edit of another user", bob, http.MethodPost, "/comments/edit/1", url.Values{"body": {"Mine now"}}, http.StatusForbidden},
+		{"delete of another user", bob, http.MethodPost, "/comments/delete/1", nil, http.StatusForbidden},
+		{"delete missing", alice, http.MethodPost, "/comments/delete/99", nil, http.StatusNotFound},
+		{"delete on own snippet", alice, http.MethodPost, "/comments/delete/2", nil, http.StatusSeeOther},
+		{"edit form on a hidden snippet", bob, http.MethodGet, "/comments/edit/" + itoa(hiddenComment), nil, http.StatusNotFound},
+		{"edit on a hidden snippet", bob, http.MethodPost, "/comments/edit/" + itoa(hiddenComment), url.Values{"body": {"Still here"}}, http.StatusNotFound},
+		{"delete on a hidden snippet", bob, http.MethodPost, "/comments/delete/" + itoa(hiddenComment), nil, http.StatusNotFound},
+		{"delete on own hidden snippet", alice, http.MethodPost, "/comments/delete/" + itoa(hiddenComment), nil, http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var code int
+			if tt.method == http.MethodGet {
+				code, _, _ = tt.ts.get(t, tt.path)
+			} else {
+				code, _, _ = tt.ts.postForm(t, tt.path, tt.form)
+			}
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	comments, err := m.comments.ForSnippet(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 1 || comments[0].Body != "First, edited" || len(comments[0].Replies) != 0 {
+		t.Errorf("got comments %+v", comments)
+	}
+}
+
+func TestSnippetReport(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, "bob")
+
+	if code, _, _ := ts.get(t, "/snippets/report/1"); code != http.StatusOK {
+		t.Errorf("got status %d for the form", code)
+	}
+	if code, _, _ := ts.get(t, "/snippets/report/99"); code != http.StatusNotFound {
+		t.Errorf("got status %d for a missing snippet", code)
+	}
+	if code, _, _ := ts.postForm(t, "/snippets/report/1", url.Values{"reason": {"other"}}); code != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d without details; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	code, header, _ := ts.postForm(t, "/snippets/report/1", url.Values{"reason": {"spam"}})
+	if code != http.StatusSeeOther || header.Get("Location") != "/snippets/view/1" {
+		t.Fatalf("got status %d to %q", code, header.Get("Location"))
+	}
+	reports, _ := m.reports.Open(10, 0)
+	if len(reports) != 1 || reports[0].Reason != "spam" || reports[0].ReporterUsername != "bob" {
+		t.Errorf("got reports %+v", reports)
+	}
+}
+
+func TestSnippetImport(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, "alice")
+
+	if code, _, _ := ts.get(t, "/snippets/import"); code != http.StatusOK {
+		t.Errorf("got status %d for the form", code)
+	}
+
+	upload := func(file string) (int, string) {
+		body := &bytes.Buffer{}
+		w := multipart.NewWriter(body)
+		w.WriteField("expires", "7")
+		if file != "" {
+			part, err := w.CreateFormFile("file", "snippets.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write([]byte(file))
+		}
+		w.Close()
+
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/snippets/import", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		req.Header.Set("X-CSRF-Token", ts.csrfToken(t))
+		code, _, respBody := ts.do(t, req)
+		return code, respBody
+	}
+
+	code, body := upload(`[{"title": "Imported", "content": "Hello"}, {"title": "", "content": "No title"}]`)
+	if code != http.StatusOK || !strings.Contains(body, "1 snippets imported, 1 failed") {
+		t.Errorf("got status %d", code)
+	}
+	if snippets, _ := m.snippets.ByUser(aliceID, true, 10, 0); len(snippets) != 2 {
+		t.Errorf("got %d snippets; want 2", len(snippets))
+	}
+
+	if code, _ = upload(""); code != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d without a file; want %d", code, http.StatusUnprocessableEntity)
+	}
+	if code, _ = upload("not json"); code != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d for an invalid file; want %d", code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestAPISnippetImport(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	items := []byte(`[{"title": "Imported", "content": "Hello"}]`)
+
+	code, _, body := ts.post(t, "/api/snippets/import", "application/json", items)
+	if code != http.StatusUnauthorized || !strings.Contains(body, "authentication required") {
+		t.Errorf("got status %d anonymously; want %d", code, http.StatusUnauthorized)
+	}
+
+	ts.login(t, "alice")
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        []byte
+		wantCode    int
+		wantBody    string
+	}{
+		{"valid", "/api/snippets/import", "application/json", items, http.StatusOK, `"created":1`},
+		{"form content type", "/api/snippets/import", "application/x-www-form-urlencoded", items, http.StatusUnsupportedMediaType, ""},
+		{"invalid expires", "/api/snippets/import?expires=2", "application/json", items, http.StatusUnprocessableEntity, "expires must equal"},
+		{"invalid body", "/api/snippets/import", "application/json", []byte("nope"), http.StatusUnprocessableEntity, "unsupported import format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.post(t, tt.path, tt.contentType, tt.body)
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body %q doesn't contain %q", body, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("store error", func(t *testing.T) {
+		m.snippets.Err = errStoreDown
+		defer func() { m.snippets.Err = nil }()
+		if code, _, _ := ts.post(t, "/api/snippets/import", "application/json", items); code != http.StatusInternalServerError {
+			t.Errorf("got status %d; want %d", code, http.StatusInternalServerError)
+		}
+	})
+}
+
+func TestAccountSessions(t *testing.T) {
+	app, m := newTestApplication(t)
+	handler := app.routes()
+	first := newTestServer(t, handler)
+	first.login(t, "alice")
+	second := newTestServer(t, handler)
+	second.login(t, "alice")
+
+	if code, _, body := first.get(t, "/account"); code != http.StatusOK || !strings.Contains(body, "alice@example.com") {
+		t.Errorf("got status %d for the account page", code)
+	}
+
+	if code, _, _ := first.postForm(t, "/account/sessions/revoke/99", nil); code != http.StatusNotFound {
+		t.Errorf("got status %d for a missing session; want %d", code, http.StatusNotFound)
+	}
+
+	// the second login is session 2
+	code, header, _ := first.postForm(t, "/account/sessions/revoke/2", nil)
+	if code != http.StatusSeeOther || header.Get("Location") != "/account" {
+		t.Fatalf("got status %d to %q", code, header.Get("Location"))
+	}
+	if code, _, _ = second.get(t, "/account"); code != http.StatusSeeOther {
+		t.Errorf("got status %d on the revoked session; want %d", code, http.StatusSeeOther)
+	}
+
+	second.login(t, "alice")
+	if code, _, _ = first.postForm(t, "/account/sessions/revoke-others", nil); code != http.StatusSeeOther {
+		t.Errorf("got status %d for revoke others", code)
+	}
+	if code, _, _ = second.get(t, "/account"); code != http.StatusSeeOther {
+		t.Errorf("got status %d on a revoked session; want %d", code, http.StatusSeeOther)
+	}
+	if code, _, _ = first.get(t, "/account"); code != http.StatusOK {
+		t.Errorf("got status %d on the current session; want %d", code, http.StatusOK)
+	}
+
+	// revoking the current session logs out
+	code, header, _ = first.postForm(t, "/account/sessions/revoke/1", nil)
+	if code != http.StatusSeeOther || header.Get("Location") != "/" {
+		t.Fatalf("got status %d to %q", code, header.Get("Location"))
+	}
+	if sessions, _ := m.sessions.ForUser(aliceID); len(sessions) != 0 {
+		t.Errorf("got %d sessions left", len(sessions))
+	}
+}
+
+func TestAccountReauth(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.reauthWindow = -time.Second
+	ts := newTestServer(t, app.routes())
+	ts.login(t, "alice")
+
+	for _, path := range []string{"/account/password", "/account/export"} {
+		code, header, _ := ts.get(t, path)
+		if code != http.StatusSeeOther || header.Get("Location") != "/account/reauth?next="+url.QueryEscape(path) {
+			t.Errorf("%s: got status %d to %q", path, code, header.Get("Location"))
+		}
+	}
+
+	if code, _, _ := ts.get(t, "/account/reauth?next=/account/password"); code != http.StatusOK {
+		t.Errorf("got status %d for the form", code)
+	}
+
+	tests := []struct {
+		name         string
+		password     string
+		next         string
+		wantCode     int
+		wantLocation string
+	}{
+		{"wrong password", "wrong", "/account/password", http.StatusUnprocessableEntity, ""},
+		{"blank", "", "/account/password", http.StatusUnprocessableEntity, ""},
+		{"valid", "pa$$word", "/account/password", http.StatusSeeOther, "/account/password"},
+		{"other site", "pa$$word", "//example.com/", http.StatusSeeOther, "/account"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, _ := ts.postForm(t, "/account/reauth", url.Values{"password": {tt.password}, "next": {tt.next}})
+			if code != tt.wantCode || header.Get("Location") != tt.wantLocation {
+				t.Errorf("got status %d to %q; want %d to %q", code, header.Get("Location"), tt.wantCode, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestAccountPassword(t *testing.T) {
+	app, m := newTestApplication(t)
+	handler := app.routes()
+	ts := newTestServer(t, handler)
+	ts.login(t, "alice")
+	other := newTestServer(t, handler)
+	other.login(t, "alice")
+
+	if code, _, _ := ts.get(t, "/account/password"); code != http.StatusOK {
+		t.Errorf("got status %d for the form", code)
+	}
+
+	form := url.Values{"password": {"Correct-Horse-77-Battery"}, "password_confirmation": {"Correct-Horse-88-Battery"}}
+	if code, _, _ := ts.postForm(t, "/account/password", form); code != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d for a mismatch; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	form.Set("password_confirmation", "Correct-Horse-77-Battery")
+	code, header, _ := ts.postForm(t, "/account/password", form)
+	if code != http.StatusSeeOther || header.Get("Location") != "/account" {
+		t.Fatalf("got status %d to %q", code, header.Get("Location"))
+	}
+	if ok, _ := m.users.PasswordMatches(aliceID, "Correct-Horse-77-Battery"); !ok {
+		t.Error("the password wasn't changed")
+	}
+	if code, _, _ = ts.get(t, "/account"); code != http.StatusOK {
+		t.Errorf("got status %d on the current session; want %d", code, http.StatusOK)
+	}
+	if code, _, _ = other.get(t, "/account"); code != http.StatusSeeOther {
+		t.Errorf("got status %d on the other session; want %d", code, http.StatusSeeOther)
+	}
+}
+
+func TestAccountExport(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	form := url.Values{"email": {"alice@example.com"}, "password": {"wrong"}}
+	if code, _, _ := ts.postForm(t, "/user/login", form); code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d for a wrong password; want %d", code, http.StatusUnprocessableEntity)
+	}
+	ts.login(t, "alice")
+
+	code, header, body := ts.get(t, "/account/export")
+	if code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+	if !strings.HasPrefix(header.Get("Content-Disposition"), `attachment; filename="snippetbox-alice-`) {
+		t.Errorf("got content disposition %q", header.Get("Content-Disposition"))
+	}
+	for _, want := range []string{`"username":"alice"`, `"title":"An old silent pond"`, `"action":"user.login"`, `"action":"user.login_failed"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("export doesn't contain %s", want)
+		}
+	}
+	if strings.Index(body, `"action":"user.login_failed"`) > strings.Index(body, `"action":"user.login"`) {
+		t.Error("the login history isn't in the order the events happened")
+	}
+}
+
+func TestAccountDelete(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, "alice")
+
+	if code, _, _ := ts.get(t, "/account/delete"); code != http.StatusOK {
+		t.Errorf("got status %d for the form", code)
+	}
+	if code, _, _ := ts.postForm(t, "/account/delete", url.Values{"policy": {"anonymize"}, "password": {"wrong"}}); code != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d for a wrong password; want %d", code, http.StatusUnprocessableEntity)
+	}
+	if code, _, _ := ts.postForm(t, "/account/delete", url.Values{"policy": {"keep"}, "password": {"pa$$word"}}); code != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d for an invalid policy; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	code, header, _ := ts.postForm(t, "/account/delete", url.Values{"policy": {"anonymize"}, "password": {"pa$$word"}})
+	if code != http.StatusSeeOther || header.Get("Location") != "/account" {
+		t.Fatalf("got status %d to %q", code, header.Get("Location"))
+	}
+	user, _ := m.users.Get(aliceID)
+	if user.DeleteAt == nil || user.DeletePolicy != models.DeletionPolicyAnonymize {
+		t.Fatalf("the deletion wasn't scheduled: %+v", user)
+	}
+
+	if code, _, _ = ts.postForm(t, "/account/delete/cancel", nil); code != http.StatusSeeOther {
+		t.Errorf("got status %d for cancel", code)
+	}
+	if user, _ = m.users.Get(aliceID); user.DeleteAt != nil {
+		t.Error("the deletion wasn't cancelled")
+	}
+}
+
+func TestOIDCDisabled(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+
+	for _, path := range []string{"/user/oidc/login", "/user/oidc/callback"} {
+		if code, _, _ := ts.get(t, path); code != http.StatusNotFound {
+			t.Errorf("%s: got status %d; want %d", path, code, http.StatusNotFound)
+		}
+	}
+
+	ts.login(t, "alice")
+	for _, path := range []string{"/account/reauth/oidc", "/account/identities/link"} {
+		if code, _, _ := ts.postForm(t, path, nil); code != http.StatusNotFound {
+			t.Errorf("%s: got status %d; want %d", path, code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestAdminUsers(t *testing.T) {
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, "adam")
+
+	if code, _, body := ts.get(t, "/admin/users?q=bob"); code != http.StatusOK || !strings.Contains(body, "bob@example.com") || strings.Contains(body, "alice@example.com") {
+		t.Errorf("got status %d for the user search", code)
+	}
+
+	tests := []struct {
+		name          string
+		path          string
+		wantCode      int
+		wantSuspended bool
+	}{
+		{"suspend", "/admin/users/suspend/2", http.StatusSeeOther, true},
+		{"unsuspend", "/admin/users/unsuspend/2", http.StatusSeeOther, false},
+		{"suspend self", "/admin/users/suspend/4", http.StatusSeeOther, false},
+		{"logout", "/admin/users/logout/2", http.StatusSeeOther, false},
+		{"missing user", "/admin/users/suspend/99", http.StatusNotFound, false},
+		{"invalid id", "/admin/users/unsuspend/x", http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, _ := ts.postForm(t, tt.path, nil)
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			for _, id := range []int{bobID, adamID} {
+				if user, _ := m.users.Get(id); user.Suspended && !tt.wantSuspended {
+					t.Errorf("%s is suspended", user.Username)
+				}
+			}
+			if user, _ := m.users.Get(bobID); user.Suspended != tt.wantSuspended {
+				t.Errorf("got bob suspended %t; want %t", user.Suspended, tt.wantSuspended)
+			}
+		})
+	}
+}
+
+func TestAdminAudit(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	ts.login(t, "adam")
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"list", "/admin/audit", http.StatusOK, "user.login"},
+		{"filter", "/admin/audit?action=user.login&actor=@adam&since=2020-01-01", http.StatusOK, "user.login"},
+		{"invalid filter", "/admin/audit?target_id=x", http.StatusUnprocessableEntity, "positive number"},
+		{"export", "/admin/audit/export?actor=adam", http.StatusOK, `"action":"user.login"`},
+		{"invalid export", "/admin/audit/export?since=yesterday", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.path)
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body doesn't contain %q", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAdminReports(t *testing.T) {
+	app, m := newTestApplication(t)
+	bobs := m.snippets.Add(&models.Snippet{UserID: bobID, Username: "bob", Title: "Spam", Visibility: models.VisibilityPublic, Expires: time.Now().Add(time.Hour)})
+	m.reports.Insert(1, bobID, "spam", "")
+	m.reports.Insert(bobs, aliceID, "spam", "")
+	handler := app.routes()
+	molly := newTestServer(t, handler)
+	molly.login(t, "molly")
+	adam := newTestServer(t, handler)
+	adam.login(t, "adam")
+
+	if code, _, body := molly.get(t, "/admin/reports"); code != http.StatusOK || !strings.Contains(body, "An old silent pond") || strings.Contains(body, "Delete snippet") {
+		t.Errorf("got status %d for the moderator's report list", code)
+	}
+	if _, _, body := adam.get(t, "/admin/reports"); !strings.Contains(body, "Delete snippet") {
+		t.Error("the admin can't choose to delete")
+	}
+
+	tests := []struct {
+		name     string
+		ts       *testServer
+		path     string
+		action   string
+		wantCode int
+	}{
+		{"moderator delete", molly, "/admin/reports/resolve/1", "delete", http.StatusForbidden},
+		{"moderator suspend", molly, "/admin/reports/resolve/1", "suspend", http.StatusForbidden},
+		{"unknown action", molly, "/admin/reports/resolve/1", "ban", http.StatusBadRequest},
+		{"missing report", molly, "/admin/reports/resolve/99", "hide", http.StatusNotFound},
+		{"invalid id", molly, "/admin/reports/resolve/x", "hide", http.StatusNotFound},
+		{"moderator hide", molly, "/admin/reports/resolve/1", "hide", http.StatusSeeOther},
+		{"resolved report", molly, "/admin/reports/resolve/1", "dismiss", http.StatusNotFound},
+		{"admin suspend", adam, "/admin/reports/resolve/2", "suspend", http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, _ := tt.ts.postForm(t, tt.path, url.Values{"action": {tt.action}})
+			if code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	if snippet, _ := m.snippets.Get(1); !snippet.Hidden {
+		t.Error("the snippet wasn't hidden")
+	}
+	if user, _ := m.users.Get(bobID); !user.Suspended {
+		t.Error("the author wasn't suspended")
+	}
+	if actions, _ := m.reports.RecentActions(10); len(actions) != 2 || actions[1].AdminUsername != "molly" {
+		t.Errorf("got actions %+v", actions)
+	}
+}
+
+func itoa(n int) string {
+	return strconv.Itoa(n)
+}
@@ -2,23 +2,38 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/go-playground/form/v4"
+	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/nosurf"
 	"net/http"
-	"runtime/debug"
+	"path/filepath"
+	"runtime"
+	"snippetbox.labkita.my.id/internal/logging"
+	"snippetbox.labkita.my.id/internal/models"
+	"snippetbox.labkita.my.id/internal/validator"
+	"strconv"
 	"time"
 )
 
-func (app *application) serverError(resp http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-
-	app.errorLog.Print(trace)
+// serverError logs err with the place it was reported from and sends a 500.
+func (app *application) serverError(resp http.ResponseWriter, req *http.Request, err error) {
+	_, file, line, _ := runtime.Caller(1)
+	app.requestLogger(req).Error("server error", "error", err, "source", fmt.Sprintf("%s:%d", filepath.Base(file), line))
 
 	http.Error(resp, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
+// requestLogger returns the logger that adds the request ID to every line.
+func (app *application) requestLogger(req *http.Request) *logging.Logger {
+	if id, ok := req.Context().Value(requestIDContextKey).(string); ok {
+		return app.logger.With("request_id", id)
+	}
+	return app.logger
+}
+
 func (app *application) clientError(resp http.ResponseWriter, status int) {
 	http.Error(resp, http.StatusText(status), status)
 }
@@ -27,11 +42,11 @@ func (app *application) notFound(resp http.ResponseWriter) {
 	app.clientError(resp, http.StatusNotFound)
 }
 
-func (app *application) render(resp http.ResponseWriter, status int, page string, data *templateData) {
+func (app *application) render(resp http.ResponseWriter, req *http.Request, status int, page string, data *templateData) {
 	ts, ok := app.templateCache[page]
 	if !ok {
 		err := fmt.Errorf("the template %s does not exist", page)
-		app.serverError(resp, err)
+		app.serverError(resp, req, err)
 		return
 	}
 
@@ -39,7 +54,7 @@ func (app *application) render(resp http.ResponseWriter, status int, page string
 
 	err := ts.ExecuteTemplate(buf, "base", data)
 	if err != nil {
-		app.serverError(resp, err)
+		app.serverError(resp, req, err)
 		return
 	}
 
@@ -48,11 +63,26 @@ func (app *application) render(resp http.ResponseWriter, status int, page string
 	buf.WriteTo(resp)
 }
 
+func (app *application) writeJSON(resp http.ResponseWriter, req *http.Request, status int, data any) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(status)
+	resp.Write(js)
+}
+
 func (app *application) newTemplateData(req *http.Request) *templateData {
 	return &templateData{
 		CurrentYear:     time.Now().Year(),
 		Flash:           app.sessionManager.PopString(req.Context(), "flash"),
 		IsAuthenticated: app.isAuthenticated(req),
+		IsModerator:     app.hasRole(req, models.RoleModerator, models.RoleAdmin),
+		IsAdmin:         app.hasRole(req, models.RoleAdmin),
+		OIDCEnabled:     app.oidc != nil,
 		CSRFToken:       nosurf.Token(req),
 	}
 }
@@ -75,5 +105,145 @@ func (app *application) decodePostForm(req *http.Request, dst any) error {
 }
 
 func (app *application) isAuthenticated(r *http.Request) bool {
-	return app.sessionManager.Exists(r.Context(), "authenticatedUserID")
+	return app.authenticatedUser(r) != nil
+}
+
+// authenticatedUser returns the user loaded by the authenticate middleware,
+// or nil for anonymous visitors.
+func (app *application) authenticatedUser(r *http.Request) *models.User {
+	user, ok := r.Context().Value(authenticatedUserContextKey).(*models.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+func (app *application) hasRole(r *http.Request, roles ...string) bool {
+	user := app.authenticatedUser(r)
+	return user != nil && user.HasRole(roles...)
+}
+
+// authenticatedUserID returns 0 for anonymous visitors.
+func (app *application) authenticatedUserID(r *http.Request) int {
+	if user := app.authenticatedUser(r); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// readVisibleSnippet loads the snippet named by the :id route parameter. When
+// it doesn't exist or the current user may not see it the response has already
+// been written and ok is false.
+func (app *application) readVisibleSnippet(resp http.ResponseWriter, req *http.Request) (*models.Snippet, bool) {
+	params := httprouter.ParamsFromContext(req.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
+	if err != nil || id < 1 {
+		app.notFound(resp)
+		return nil, false
+	}
+
+	snippet, err := app.snippets.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(resp)
+		} else {
+			app.serverError(resp, req, err)
+		}
+		return nil, false
+	}
+	if !snippet.VisibleTo(app.authenticatedUserID(req)) {
+		app.notFound(resp)
+		return nil, false
+	}
+	return snippet, true
+}
+
+func (app *application) readPage(req *http.Request) int {
+	page, err := strconv.Atoi(req.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+// logoutUser ends every session that belongs to the user.
+func (app *application) logoutUser(userID int) error {
+	return app.sessions.RevokeAll(userID, "")
+}
+
+// checkPasswordStrength rejects common passwords, passwords built from the
+// user's own details and passwords that are easy to guess. Every rule the
+// password fails is added to the error of the password field, a blank
+// password is left to the blank check of the form.
+func checkPasswordStrength(v *validator.Validator, password string, userInputs ...string) {
+	if password == "" {
+		return
+	}
+	if validator.IsCommonPassword(password) {
+		v.AppendFieldError("password", "this password is too common, it appears in lists of breached passwords")
+	}
+	if validator.ContainsUserInput(password, userInputs...) {
+		v.AppendFieldError("password", "this password must not contain your name, username or email address")
+	}
+	if validator.PasswordEntropy(password) < validator.MinPasswordEntropy {
+		v.AppendFieldError("password", "this password is too easy to guess, make it longer or mix in upper case letters, digits or symbols")
+	}
+}
+
+// startSession logs the user in on a fresh session token.
+func (app *application) startSession(req *http.Request, user *models.User, rememberMe bool, method string) error {
+	err := app.sessionManager.RenewToken(req.Context())
+	if err != nil {
+		return err
+	}
+
+	app.sessionManager.RememberMe(req.Context(), rememberMe)
+	app.sessionManager.Put(req.Context(), "authenticatedUserID", user.ID)
+	app.sessionManager.Put(req.Context(), "rememberMe", rememberMe)
+	app.sessionManager.Put(req.Context(), "loginTime", time.Now())
+	app.sessionManager.Put(req.Context(), "flash", "login success")
+
+	err = app.trackSession(req, user.ID)
+	if err != nil {
+		return err
+	}
+
+	app.audit(req, &models.AuditEvent{
+		ActorID:       user.ID,
+		ActorUsername: user.Username,
+		Action:        models.AuditLogin,
+		TargetType:    "user",
+		TargetID:      user.ID,
+		Details:       "via " + method,
+	})
+	return nil
+}
+
+// trackSession links the current session token to the user, it must be
+// called after the token was renewed.
+func (app *application) trackSession(req *http.Request, userID int) error {
+	app.sessionManager.Put(req.Context(), "lastSeen", time.Now())
+	app.sessionManager.Put(req.Context(), "authTime", time.Now())
+	return app.sessions.Track(app.sessionManager.Token(req.Context()), userID, clientIP(req), req.UserAgent())
+}
+
+// audit records a security relevant event for the current request. Failing to
+// write the event is logged but doesn't fail the request that triggered it.
+func (app *application) audit(req *http.Request, event *models.AuditEvent) {
+	if user := app.authenticatedUser(req); user != nil && event.ActorID == 0 {
+		event.ActorID = user.ID
+		event.ActorUsername = user.Username
+	}
+	event.IP = clientIP(req)
+	event.UserAgent = req.UserAgent()
+
+	err := app.auditLog.Insert(event)
+	if err != nil {
+		app.requestLogger(req).Error("audit", "action", event.Action, "error", err)
+	}
+}
+
+// clientIP is the address of the client, resolved through trusted proxies.
+func clientIP(req *http.Request) string {
+	return requestClient(req).IP
 }
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"snippetbox.labkita.my.id/internal/models"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxImportSize     = 10 << 20
+	maxImportItems    = 500
+	maxImportFileSize = 1 << 20
+)
+
+var errImportFormat = errors.New("unsupported import format, expected a JSON array, a gist export or a zip archive")
+
+// importItem is a single snippet found in an uploaded import file.
+type importItem struct {
+	Source     string
+	Title      string
+	Content    string
+	Language   string
+	Expires    int
+	Visibility string
+	Tags       []string
+}
+
+// importResult is the per-item report returned after an import.
+type importResult struct {
+	Index  int               `json:"index"`
+	Source string            `json:"source"`
+	Title  string            `json:"title"`
+	ID     int               `json:"id,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+type importReport struct {
+	Created int             `json:"created"`
+	Failed  int             `json:"failed"`
+	Results []*importResult `json:"results"`
+}
+
+// jsonImportEntry accepts both the plain snippet format and a gist export,
+// gists are recognized by the presence of the files object.
+type jsonImportEntry struct {
+	Title       string                    `json:"title"`
+	Content     string                    `json:"content"`
+	Language    string                    `json:"language"`
+	Expires     int                       `json:"expires"`
+	Visibility  string                    `json:"visibility"`
+	Tags        []string                  `json:"tags"`
+	Description string                    `json:"description"`
+	Files       map[string]gistImportFile `json:"files"`
+}
+
+type gistImportFile struct {
+	Filename string `json:"filename"`
+	Language string `json:"language"`
+	Content  string `json:"content"`
+}
+
+func parseImport(data []byte) ([]*importItem, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return parseZipImport(data)
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, errImportFormat
+	}
+
+	var entries []jsonImportEntry
+	switch trimmed[0] {
+	case '[':
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	case '{':
+		var entry jsonImportEntry
+		if err := json.Unmarshal(trimmed, &entry); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		entries = append(entries, entry)
+	default:
+		return nil, errImportFormat
+	}
+
+	items := []*importItem{}
+	for i, entry := range entries {
+		if entry.Files == nil {
+			items = append(items, &importItem{
+				Source:     fmt.Sprintf("item %d", i+1),
+				Title:      entry.Title,
+				Content:    entry.Content,
+				Language:   entry.Language,
+				Expires:    entry.Expires,
+				Visibility: entry.Visibility,
+				Tags:       entry.Tags,
+			})
+			continue
+		}
+
+		names := make([]string, 0, len(entry.Files))
+		for name := range entry.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			file := entry.Files[name]
+			if file.Filename != "" {
+				name = file.Filename
+			}
+			title := name
+			if len(entry.Files) == 1 && strings.TrimSpace(entry.Description) != "" {
+				title = entry.Description
+			}
+			items = append(items, &importItem{
+				Source:   fmt.Sprintf("gist %d: %s", i+1, name),
+				Title:    title,
+				Content:  file.Content,
+				Language: file.Language,
+			})
+		}
+	}
+
+	return items, checkImportCount(items)
+}
+
+func parseZipImport(data []byte) ([]*importItem, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %w", err)
+	}
+
+	items := []*importItem{}
+	for _, file := range archive.File {
+		name := file.Name
+		base := path.Base(name)
+		if file.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(base, ".") {
+			continue
+		}
+
+		if file.UncompressedSize64 > maxImportFileSize {
+			return nil, fmt.Errorf("%s is larger than %d bytes", name, maxImportFileSize)
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %w", name, err)
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, maxImportFileSize+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %w", name, err)
+		}
+		if len(content) > maxImportFileSize {
+			return nil, fmt.Errorf("%s is larger than %d bytes", name, maxImportFileSize)
+		}
+
+		items = append(items, &importItem{
+			Source:  name,
+			Title:   base,
+			Content: string(content),
+		})
+
+		if err = checkImportCount(items); err != nil {
+			return nil, err
+		}
+	}
+
+	return items, nil
+}
+
+func checkImportCount(items []*importItem) error {
+	if len(items) > maxImportItems {
+		return fmt.Errorf("an import cannot contain more than %d snippets", maxImportItems)
+	}
+	return nil
+}
+
+// importSnippets validates every item with the same rules as the create form
+// and inserts the valid ones in a single transaction.
+func (app *application) importSnippets(req *http.Request, items []*importItem, defaultExpires int) (*importReport, error) {
+	userID := app.authenticatedUserID(req)
+	report := &importReport{Results: make([]*importResult, len(items))}
+
+	valid := []*importResult{}
+	inputs := []models.SnippetInput{}
+	for i, item := range items {
+		expires := item.Expires
+		if expires == 0 {
+			expires = defaultExpires
+		}
+
+		visibility := item.Visibility
+		if visibility == "" {
+			visibility = models.VisibilityPublic
+		}
+
+		form := snippetCreateForm{
+			Title:      item.Title,
+			Content:    item.Content,
+			Language:   item.Language,
+			Expires:    expires,
+			Visibility: visibility,
+			Tags:       strings.Join(item.Tags, ","),
+		}
+		form.validate()
+		form.CheckField(utf8.ValidString(item.Content), "content", "this field must be valid UTF-8 text")
+
+		result := &importResult{Index: i + 1, Source: item.Source, Title: item.Title}
+		report.Results[i] = result
+
+		if !form.IsValid() {
+			result.Errors = form.FieldErrors
+			report.Failed++
+			continue
+		}
+
+		valid = append(valid, result)
+		inputs = append(inputs, form.input(userID))
+	}
+
+	if len(inputs) == 0 {
+		return report, nil
+	}
+
+	ids, err := app.snippets.InsertMany(inputs)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range valid {
+		result.ID = ids[i]
+	}
+	report.Created = len(ids)
+
+	app.audit(req, &models.AuditEvent{
+		Action:  models.AuditSnippetImport,
+		Details: fmt.Sprintf("%d snippets created, %d failed", report.Created, report.Failed),
+	})
+
+	return report, nil
+}
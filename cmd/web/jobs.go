@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"snippetbox.labkita.my.id/internal/models"
+	"time"
+)
+
+// background runs job in a goroutine that stopBackground waits for. The job
+// must return soon after its context is done.
+func (app *application) background(job func(ctx context.Context)) {
+	app.jobs.Add(1)
+	go func() {
+		defer app.jobs.Done()
+		job(app.jobsCtx)
+	}()
+}
+
+// stopBackground cancels the background jobs and waits until they returned.
+func (app *application) stopBackground() {
+	app.stopJobs()
+	app.jobs.Wait()
+}
+
+// purgeAccounts deletes the accounts whose deletion grace period is over,
+// every interval until ctx is done.
+func (app *application) purgeAccounts(ctx context.Context, interval time.Duration) {
+	for {
+		users, err := app.users.DueForDeletion()
+		if err != nil {
+			app.logger.Error("purge accounts", "error", err)
+		}
+
+		for _, user := range users {
+			if ctx.Err() != nil {
+				return
+			}
+			err = app.users.Delete(user.ID, user.DeletePolicy)
+			if err != nil {
+				app.logger.Error("purge account", "user_id", user.ID, "error", err)
+				continue
+			}
+
+			err = app.auditLog.Insert(&models.AuditEvent{
+				Action:     models.AuditDelete,
+				TargetType: "user",
+				TargetID:   user.ID,
+				Details:    fmt.Sprintf("username=%s policy=%s", user.Username, user.DeletePolicy),
+			})
+			if err != nil {
+				app.logger.Error("audit", "action", models.AuditDelete, "error", err)
+			}
+			app.logger.Info("deleted account", "user_id", user.ID, "username", user.Username)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
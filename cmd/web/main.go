@@ -1,52 +1,124 @@
 package main
 
 import (
-	"database/sql"
-	"flag"
-	"github.com/alexedwards/scs/mysqlstore"
+	"context"
+	"encoding/gob"
+	"fmt"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"snippetbox.labkita.my.id/internal/logging"
+	"snippetbox.labkita.my.id/internal/migrations"
 	"snippetbox.labkita.my.id/internal/models"
+	"sync"
 	"time"
-
-	_ "github.com/go-sql-driver/mysql"
 )
 
 type application struct {
-	errorLog       *log.Logger
-	infoLog        *log.Logger
-	snippets       *models.SnippetModel
-	users          *models.UserModel
-	templateCache  map[string]*template.Template
-	formDecoder    *form.Decoder
-	sessionManager *scs.SessionManager
+	logger          *logging.Logger
+	snippets        models.SnippetStore
+	users           models.UserStore
+	tags            models.TagStore
+	stars           models.StarStore
+	comments        models.CommentStore
+	reports         models.ReportStore
+	sessions        models.SessionStore
+	identities      models.IdentityStore
+	stats           models.StatsStore
+	auditLog        models.AuditStore
+	sessionLifetime time.Duration
+	reauthWindow    time.Duration
+	deletionGrace   time.Duration
+	staticDir       string
+	trustedProxies  []*net.IPNet
+	forceHTTPS      bool
+	secureCookies   bool
+	oidc            *oidcProvider
+	templateCache   map[string]*template.Template
+	formDecoder     *form.Decoder
+	sessionManager  *scs.SessionManager
+	jobsCtx         context.Context
+	stopJobs        context.CancelFunc
+	jobs            sync.WaitGroup
+}
+
+// sessions hold the login, auth and last seen times, gob only encodes the
+// concrete types registered with it inside the session values
+func init() {
+	gob.Register(time.Time{})
 }
 
 func main() {
-	// argument options
-	addr := flag.String("addr", ":4000", "Http network address")
-	dsn := flag.String("dsn", "root:secret@tcp(127.0.0.1:3306)/snippetbox?parseTime=true", "Mysql data source name")
-	flag.Parse()
+	// subcommands
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 
-	// setup logging
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	// configuration
+	cfg, printConfig, err := loadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if printConfig {
+		fmt.Print(cfg)
+		return
+	}
+	if err = cfg.validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// validate already checked the networks
+	trustedProxies, _ := parseCIDRs(cfg.TrustedProxies)
+
+	// setup logging, validate already checked the level and format
+	logLevel, _ := logging.ParseLevel(cfg.LogLevel)
+	logger, _ := logging.New(os.Stdout, logLevel, cfg.LogFormat)
+
+	// validate already checked the password hash settings
+	hasher, _ := cfg.passwordHasher()
 
 	// database setup
-	db, err := openDB(*dsn)
+	driver := databaseDriver(cfg.DBDriver, cfg.DSN)
+	db, err := openDB(driver, cfg.DSN)
 	if err != nil {
-		errorLog.Fatal(err)
+		logger.Fatal("open database", "error", err)
+	}
+
+	// refuse to serve on a schema this build doesn't know about yet
+	migrator := &migrations.Migrator{DB: db, Driver: driver}
+	version, err := migrator.Version()
+	if err != nil {
+		logger.Fatal("read schema version", "error", err)
+	}
+	latest, err := migrator.Latest()
+	if err != nil {
+		logger.Fatal("read migrations", "error", err)
+	}
+	if version < latest {
+		logger.Fatal("database schema is outdated, run migrate up", "version", version, "needed", latest)
+	}
+
+	stores, err := newStores(driver, db, hasher)
+	if err != nil {
+		logger.Fatal("create stores", "error", err)
 	}
-	defer db.Close()
 
 	// Initialize a new template cache...
-	templateCache, err := newTemplateCache()
+	templateCache, err := newTemplateCache(cfg.TemplateDir)
 	if err != nil {
-		errorLog.Fatal(err)
+		logger.Fatal("load templates", "error", err)
 	}
 
 	// init form decoder
@@ -54,41 +126,93 @@ func main() {
 
 	// init session
 	sessionManager := scs.New()
-	sessionManager.Store = mysqlstore.New(db)
-	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Store = stores.sessionStore
+	sessionManager.Lifetime = cfg.RememberLifetime
+	sessionManager.IdleTimeout = cfg.IdleTimeout
+	// cookies only outlive the browser when remember me was checked
+	sessionManager.Cookie.Persist = false
+	sessionManager.Cookie.Secure = cfg.SecureCookies
 
 	// setup application DI
 	app := &application{
-		errorLog:       errorLog,
-		infoLog:        infoLog,
-		snippets:       &models.SnippetModel{DB: db},
-		users:          &models.UserModel{DB: db},
-		templateCache:  templateCache,
-		formDecoder:    formDecoder,
-		sessionManager: sessionManager,
+		logger:          logger,
+		snippets:        stores.snippets,
+		users:           stores.users,
+		tags:            stores.tags,
+		stars:           stores.stars,
+		comments:        stores.comments,
+		reports:         stores.reports,
+		sessions:        stores.sessions,
+		identities:      stores.identities,
+		stats:           stores.stats,
+		auditLog:        stores.auditLog,
+		sessionLifetime: cfg.SessionLifetime,
+		reauthWindow:    cfg.ReauthWindow,
+		deletionGrace:   cfg.DeletionGrace,
+		staticDir:       cfg.StaticDir,
+		trustedProxies:  trustedProxies,
+		forceHTTPS:      cfg.ForceHTTPS,
+		secureCookies:   cfg.SecureCookies,
+		templateCache:   templateCache,
+		formDecoder:     formDecoder,
+		sessionManager:  sessionManager,
+	}
+	app.jobsCtx, app.stopJobs = context.WithCancel(context.Background())
+
+	if cfg.OIDCIssuer != "" {
+		app.oidc, err = newOIDCProvider(context.Background(), cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCClientSecret, cfg.OIDCRedirectURL)
+		if err != nil {
+			logger.Fatal("oidc discovery", "error", err)
+		}
 	}
 
+	// background jobs
+	app.background(func(ctx context.Context) {
+		app.purgeAccounts(ctx, cfg.PurgeAccountsPeriod)
+	})
+
 	// Server Listen
 	srv := &http.Server{
-		Addr:         *addr,
-		ErrorLog:     errorLog,
+		Addr:         cfg.Addr,
+		ErrorLog:     log.New(logger, "", 0),
 		Handler:      app.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  cfg.ServerIdleTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+	}
+	var certs *certReloader
+	var redirect *http.Server
+	if cfg.TLSCert != "" {
+		certs, err = newCertReloader(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			logger.Fatal("load certificate", "error", err)
+		}
+		srv.TLSConfig = newTLSConfig(certs)
+		if cfg.RedirectAddr != "" {
+			redirect = &http.Server{
+				Addr:         cfg.RedirectAddr,
+				ErrorLog:     log.New(logger, "", 0),
+				Handler:      redirectToHTTPS(cfg.Addr),
+				IdleTimeout:  cfg.ServerIdleTimeout,
+				ReadTimeout:  cfg.ReadTimeout,
+				WriteTimeout: cfg.WriteTimeout,
+			}
+		}
 	}
-	infoLog.Printf("starting server on port %s", *addr)
-	err = srv.ListenAndServe()
-	errorLog.Fatal(err)
-}
 
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, err
+	if err = app.serve(srv, redirect, certs, cfg.ShutdownTimeout); err != nil {
+		logger.Fatal("serve", "error", err)
 	}
-	if err = db.Ping(); err != nil {
-		return nil, err
+
+	// the session stores clean up expired sessions in a goroutine of their own
+	if cleaner, ok := stores.sessionStore.(interface{ StopCleanup() }); ok {
+		logger.Info("stopping session cleanup")
+		cleaner.StopCleanup()
+	}
+
+	logger.Info("closing database")
+	if err = db.Close(); err != nil {
+		logger.Fatal("close database", "error", err)
 	}
-	return db, nil
+	logger.Info("stopped")
 }
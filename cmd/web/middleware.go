@@ -1,9 +1,20 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/justinas/alice"
 	"github.com/justinas/nosurf"
+	"mime"
 	"net/http"
+	"net/url"
+	"regexp"
+	"runtime/debug"
+	"snippetbox.labkita.my.id/internal/models"
+	"time"
 )
 
 func secureHeaders(next http.Handler) http.Handler {
@@ -17,10 +28,68 @@ func secureHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// requestIDRX is what an X-Request-ID from the client may look like.
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestID takes the request ID from X-Request-ID, or generates one, and
+// echoes it in the response so both sides can find the request in the logs.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get("X-Request-ID")
+		if !requestIDRX.MatchString(id) {
+			b := make([]byte, 16)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		resp.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(req.Context(), requestIDContextKey, id)
+		next.ServeHTTP(resp, req.WithContext(ctx))
+	})
+}
+
+// statusRecorder remembers the status and size of a response for the access
+// log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = code, true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// logRequest writes the access log line once the response is done.
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
-		app.infoLog.Printf("%s - %s %s %s", req.RemoteAddr, req.Proto, req.Method, req.URL.RequestURI())
-		next.ServeHTTP(resp, req)
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: resp, status: http.StatusOK}
+		next.ServeHTTP(rec, req)
+
+		app.requestLogger(req).Info("request",
+			"ip", clientIP(req),
+			"proto", req.Proto,
+			"method", req.Method,
+			"uri", req.URL.RequestURI(),
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+		)
 	})
 }
 
@@ -30,7 +99,9 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 		defer func() {
 			if err := recover(); err != nil {
 				resp.Header().Set("Connection", "close")
-				app.serverError(resp, fmt.Errorf("%s", err))
+				// the stack is a single field, so the line stays parseable
+				app.requestLogger(req).Error("panic", "error", fmt.Sprint(err), "stack", string(debug.Stack()))
+				http.Error(resp, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
 		}()
 
@@ -38,6 +109,57 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// sessionTouchInterval is how often the last seen time of a session is written.
+const sessionTouchInterval = 5 * time.Minute
+
+// authenticate loads the logged in user into the request context. Sessions of
+// deleted or suspended users are logged out.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		id := app.sessionManager.GetInt(req.Context(), "authenticatedUserID")
+		if id == 0 {
+			next.ServeHTTP(resp, req)
+			return
+		}
+
+		user, err := app.users.Get(id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(resp, req, err)
+			return
+		}
+		if user == nil || user.Suspended {
+			app.sessionManager.Remove(req.Context(), "authenticatedUserID")
+			next.ServeHTTP(resp, req)
+			return
+		}
+
+		// logins without remember me still end after the normal lifetime
+		if !app.sessionManager.GetBool(req.Context(), "rememberMe") && time.Since(app.sessionManager.GetTime(req.Context(), "loginTime")) > app.sessionLifetime {
+			app.sessionManager.Remove(req.Context(), "authenticatedUserID")
+			next.ServeHTTP(resp, req)
+			return
+		}
+
+		// refresh the last seen time now and then, a session without a
+		// mapping was revoked or predates the mapping and is logged out
+		if time.Since(app.sessionManager.GetTime(req.Context(), "lastSeen")) > sessionTouchInterval {
+			err = app.sessions.Touch(app.sessionManager.Token(req.Context()), clientIP(req))
+			if errors.Is(err, models.ErrNoRecord) {
+				app.sessionManager.Remove(req.Context(), "authenticatedUserID")
+				next.ServeHTTP(resp, req)
+				return
+			} else if err != nil {
+				app.serverError(resp, req, err)
+				return
+			}
+			app.sessionManager.Put(req.Context(), "lastSeen", time.Now())
+		}
+
+		ctx := context.WithValue(req.Context(), authenticatedUserContextKey, user)
+		next.ServeHTTP(resp, req.WithContext(ctx))
+	})
+}
+
 func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
 		if !app.isAuthenticated(req) {
@@ -49,10 +171,94 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
-func noSurf(next http.Handler) http.Handler {
+// requireRecentAuth sends users that logged in or confirmed their password
+// too long ago to the password confirmation page first.
+func (app *application) requireRecentAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if time.Since(app.sessionManager.GetTime(req.Context(), "authTime")) > app.reauthWindow {
+			http.Redirect(resp, req, "/account/reauth?next="+url.QueryEscape(req.URL.Path), http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(resp, req)
+	})
+}
+
+// requireRole only lets users with one of the roles through, it must come
+// after requireAuthentication in the chain.
+func (app *application) requireRole(roles ...string) alice.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			if !app.hasRole(req, roles...) {
+				app.clientError(resp, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
+
+// requireAPIAuthentication is the JSON counterpart of requireAuthentication,
+// api clients get a 401 instead of a redirect to the login page.
+func (app *application) requireAPIAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if !app.isAuthenticated(req) {
+			app.writeJSON(resp, req, http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+			return
+		}
+		resp.Header().Add("Cache-Control", "no-store")
+		next.ServeHTTP(resp, req)
+	})
+}
+
+// extendWriteDeadline gives the response d to be written instead of the
+// write-timeout of the server. It has to run outside LoadAndSave, whose
+// buffered writer hides the connection, and it looks through the writers that
+// can be unwrapped like statusRecorder.
+func (app *application) extendWriteDeadline(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			w := resp
+			for {
+				if dw, ok := w.(interface{ SetWriteDeadline(time.Time) error }); ok {
+					if err := dw.SetWriteDeadline(time.Now().Add(d)); err != nil {
+						app.requestLogger(req).Error("extend write deadline", "error", err)
+					}
+					break
+				}
+				uw, ok := w.(interface{ Unwrap() http.ResponseWriter })
+				if !ok {
+					app.requestLogger(req).Error("extend write deadline", "error", "the response writer has no write deadline")
+					break
+				}
+				w = uw.Unwrap()
+			}
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
+
+// requireContentType rejects requests whose body isn't one of the given media
+// types. Browsers can't send these cross-site without a CORS preflight, which
+// is what protects the api routes that skip noSurf.
+func requireContentType(types ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+			for _, t := range types {
+				if mediaType == t {
+					next.ServeHTTP(resp, req)
+					return
+				}
+			}
+			http.Error(resp, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		})
+	}
+}
+
+func (app *application) noSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 	csrfHandler.SetBaseCookie(http.Cookie{
-		HttpOnly: true, Path: "/", Secure: true,
+		HttpOnly: true, Path: "/", Secure: app.secureCookies,
 	})
 	return csrfHandler
 }
\ No newline at end of file
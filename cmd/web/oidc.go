@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"net/http"
+	"regexp"
+	"snippetbox.labkita.my.id/internal/models"
+	"snippetbox.labkita.my.id/internal/validator"
+	"strings"
+	"time"
+)
+
+// oidcProvider signs users in with the authorization code flow and PKCE.
+type oidcProvider struct {
+	issuer   string
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// oidcClaims are the claims read from the ID token.
+type oidcClaims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+}
+
+const (
+	oidcModeLogin  = "login"
+	oidcModeLink   = "link"
+	oidcModeReauth = "reauth"
+)
+
+func newOIDCProvider(ctx context.Context, issuer, clientID, clientSecret, redirectURL string) (*oidcProvider, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oidcProvider{
+		issuer: issuer,
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+	}, nil
+}
+
+// oidcRedirect sends the user to the provider, state, nonce and the PKCE
+// verifier are kept in the session until the callback.
+func (app *application) oidcRedirect(resp http.ResponseWriter, req *http.Request, mode, next string) {
+	state, nonce, verifier := randomToken(), randomToken(), randomToken()
+	app.sessionManager.Put(req.Context(), "oidcState", state)
+	app.sessionManager.Put(req.Context(), "oidcNonce", nonce)
+	app.sessionManager.Put(req.Context(), "oidcVerifier", verifier)
+	app.sessionManager.Put(req.Context(), "oidcMode", mode)
+	app.sessionManager.Put(req.Context(), "oidcNext", next)
+
+	challenge := sha256.Sum256([]byte(verifier))
+	opts := []oauth2.AuthCodeOption{
+		oidc.Nonce(nonce),
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+	if mode == oidcModeReauth {
+		opts = append(opts, oauth2.SetAuthURLParam("prompt", "login"))
+	}
+	http.Redirect(resp, req, app.oidc.config.AuthCodeURL(state, opts...), http.StatusFound)
+}
+
+func (app *application) oidcLogin(resp http.ResponseWriter, req *http.Request) {
+	if app.oidc == nil {
+		app.notFound(resp)
+		return
+	}
+	app.oidcRedirect(resp, req, oidcModeLogin, "/snippets/create")
+}
+
+func (app *application) oidcLink(resp http.ResponseWriter, req *http.Request) {
+	if app.oidc == nil {
+		app.notFound(resp)
+		return
+	}
+	app.oidcRedirect(resp, req, oidcModeLink, "/account")
+}
+
+func (app *application) oidcReauth(resp http.ResponseWriter, req *http.Request) {
+	if app.oidc == nil {
+		app.notFound(resp)
+		return
+	}
+	err := req.ParseForm()
+	if err != nil {
+		app.clientError(resp, http.StatusBadRequest)
+		return
+	}
+	app.oidcRedirect(resp, req, oidcModeReauth, safeRedirect(req.PostForm.Get("next")))
+}
+
+func (app *application) oidcCallback(resp http.ResponseWriter, req *http.Request) {
+	if app.oidc == nil {
+		app.notFound(resp)
+		return
+	}
+
+	ctx := req.Context()
+	state := app.sessionManager.PopString(ctx, "oidcState")
+	nonce := app.sessionManager.PopString(ctx, "oidcNonce")
+	verifier := app.sessionManager.PopString(ctx, "oidcVerifier")
+	mode := app.sessionManager.PopString(ctx, "oidcMode")
+	next := app.sessionManager.PopString(ctx, "oidcNext")
+
+	query := req.URL.Query()
+	if state == "" || query.Get("state") != state {
+		app.clientError(resp, http.StatusBadRequest)
+		return
+	}
+	if query.Get("error") != "" {
+		app.oidcFail(resp, req, mode, "Sign in with SSO was cancelled.")
+		return
+	}
+
+	exchangeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	token, err := app.oidc.config.Exchange(exchangeCtx, query.Get("code"), oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		app.requestLogger(req).Error("oidc exchange", "error", err)
+		app.oidcFail(resp, req, mode, "Sign in with SSO failed, please try again.")
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		app.oidcFail(resp, req, mode, "Sign in with SSO failed, please try again.")
+		return
+	}
+	idToken, err := app.oidc.verifier.Verify(exchangeCtx, rawIDToken)
+	if err != nil {
+		app.requestLogger(req).Error("oidc verify", "error", err)
+		app.oidcFail(resp, req, mode, "Sign in with SSO failed, please try again.")
+		return
+	}
+
+	var claims oidcClaims
+	if err = idToken.Claims(&claims); err != nil || claims.Nonce != nonce {
+		app.oidcFail(resp, req, mode, "Sign in with SSO failed, please try again.")
+		return
+	}
+
+	switch mode {
+	case oidcModeLink, oidcModeReauth:
+		if !app.isAuthenticated(req) {
+			http.Redirect(resp, req, "/user/login", http.StatusSeeOther)
+			return
+		}
+		app.oidcLinkCallback(resp, req, mode, next, &claims)
+	default:
+		app.oidcLoginCallback(resp, req, next, &claims)
+	}
+}
+
+func (app *application) oidcLoginCallback(resp http.ResponseWriter, req *http.Request, next string, claims *oidcClaims) {
+	identity, err := app.identities.Get(app.oidc.issuer, claims.Subject)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	var user *models.User
+	if identity != nil {
+		user, err = app.users.Get(identity.UserID)
+	} else {
+		user, err = app.oidcFirstLogin(req, claims)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrDuplicateEmail):
+			app.oidcFail(resp, req, oidcModeLogin, "An account with your email address already exists, log in with your password and link SSO from your account page.")
+		case errors.Is(err, errOIDCNoEmail):
+			app.oidcFail(resp, req, oidcModeLogin, "Your SSO account has no email address.")
+		default:
+			app.serverError(resp, req, err)
+		}
+		return
+	}
+
+	if user.Suspended {
+		app.audit(req, &models.AuditEvent{
+			Action:     models.AuditLoginFailed,
+			TargetType: "user",
+			TargetID:   user.ID,
+			Details:    fmt.Sprintf("sso subject=%s: account suspended", claims.Subject),
+		})
+		app.oidcFail(resp, req, oidcModeLogin, "Your account has been suspended")
+		return
+	}
+
+	err = app.startSession(req, user, false, "sso")
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+	http.Redirect(resp, req, next, http.StatusSeeOther)
+}
+
+var errOIDCNoEmail = errors.New("oidc: no email claim")
+
+// oidcFirstLogin links a new identity to the account with the same verified
+// email address, or creates a new account for it.
+func (app *application) oidcFirstLogin(req *http.Request, claims *oidcClaims) (*models.User, error) {
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	if email == "" {
+		return nil, errOIDCNoEmail
+	}
+
+	user, err := app.users.GetByEmail(email)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		return nil, err
+	}
+	if user != nil && !claims.EmailVerified {
+		// an unverified address could belong to someone else
+		return nil, models.ErrDuplicateEmail
+	}
+
+	if user == nil {
+		name := strings.TrimSpace(claims.Name)
+		if name == "" {
+			name = strings.SplitN(email, "@", 2)[0]
+		}
+		id, err := app.insertOIDCUser(name, oidcUsername(claims), email)
+		if err != nil {
+			return nil, err
+		}
+		if user, err = app.users.Get(id); err != nil {
+			return nil, err
+		}
+		app.audit(req, &models.AuditEvent{
+			ActorID:       user.ID,
+			ActorUsername: user.Username,
+			Action:        models.AuditSignup,
+			TargetType:    "user",
+			TargetID:      user.ID,
+			Details:       "via sso",
+			Changes: map[string]models.AuditChange{
+				"name":     {After: user.Name},
+				"username": {After: user.Username},
+				"email":    {After: user.Email},
+			},
+		})
+	}
+
+	err = app.identities.Insert(user.ID, app.oidc.issuer, claims.Subject, email)
+	if err != nil {
+		return nil, err
+	}
+	app.audit(req, &models.AuditEvent{
+		ActorID:       user.ID,
+		ActorUsername: user.Username,
+		Action:        models.AuditIdentityLink,
+		TargetType:    "user",
+		TargetID:      user.ID,
+		Details:       fmt.Sprintf("issuer=%s subject=%s", app.oidc.issuer, claims.Subject),
+	})
+	return user, nil
+}
+
+// insertOIDCUser creates an account with a random password, the user can set
+// a real one later from the account page.
+func (app *application) insertOIDCUser(name, username, email string) (int, error) {
+	candidate := username
+	for i := 2; ; i++ {
+		id, err := app.users.Insert(name, candidate, email, randomToken())
+		if !errors.Is(err, models.ErrDuplicateUsername) || i > 20 {
+			return id, err
+		}
+		suffix := fmt.Sprintf("-%d", i)
+		if len(username)+len(suffix) > 30 {
+			candidate = username[:30-len(suffix)] + suffix
+		} else {
+			candidate = username + suffix
+		}
+	}
+}
+
+func (app *application) oidcLinkCallback(resp http.ResponseWriter, req *http.Request, mode, next string, claims *oidcClaims) {
+	userID := app.authenticatedUserID(req)
+	identity, err := app.identities.Get(app.oidc.issuer, claims.Subject)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(resp, req, err)
+		return
+	}
+
+	if mode == oidcModeReauth {
+		if identity == nil || identity.UserID != userID {
+			app.audit(req, &models.AuditEvent{Action: models.AuditReauthFailed, Details: "sso identity doesn't belong to the user"})
+			app.oidcFail(resp, req, mode, "That SSO account isn't linked to your account.")
+			return
+		}
+		app.sessionManager.Put(req.Context(), "authTime", time.Now())
+		http.Redirect(resp, req, next, http.StatusSeeOther)
+		return
+	}
+
+	if identity != nil {
+		if identity.UserID == userID {
+			app.sessionManager.Put(req.Context(), "flash", "That SSO account is already linked.")
+		} else {
+			app.sessionManager.Put(req.Context(), "flash", "That SSO account is linked to another user.")
+		}
+		http.Redirect(resp, req, next, http.StatusSeeOther)
+		return
+	}
+
+	err = app.identities.Insert(userID, app.oidc.issuer, claims.Subject, claims.Email)
+	if err != nil {
+		app.serverError(resp, req, err)
+		return
+	}
+	app.audit(req, &models.AuditEvent{
+		Action:     models.AuditIdentityLink,
+		TargetType: "user",
+		TargetID:   userID,
+		Details:    fmt.Sprintf("issuer=%s subject=%s", app.oidc.issuer, claims.Subject),
+	})
+
+	app.sessionManager.Put(req.Context(), "flash", "Your SSO account has been linked.")
+	http.Redirect(resp, req, next, http.StatusSeeOther)
+}
+
+func (app *application) oidcFail(resp http.ResponseWriter, req *http.Request, mode, message string) {
+	app.sessionManager.Put(req.Context(), "flash", message)
+	if mode == oidcModeLogin || !app.isAuthenticated(req) {
+		http.Redirect(resp, req, "/user/login", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(resp, req, "/account", http.StatusSeeOther)
+}
+
+var usernameInvalidRX = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// oidcUsername derives a valid username from the preferred username or the
+// email address of the identity.
+func oidcUsername(claims *oidcClaims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" || strings.Contains(candidate, "@") {
+		candidate = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	candidate = usernameInvalidRX.ReplaceAllString(strings.ToLower(candidate), "-")
+	candidate = strings.Trim(candidate, "_-")
+	if len(candidate) > 30 {
+		candidate = strings.Trim(candidate[:30], "_-")
+	}
+	for len(candidate) < 3 {
+		candidate += "0"
+	}
+	if !validator.Matches(candidate, validator.UsernameRX) {
+		return "user"
+	}
+	return candidate
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,675 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"snippetbox.labkita.my.id/internal/models"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	oidcTestClientID     = "snippetbox"
+	oidcTestClientSecret = "client-secret"
+)
+
+// fakeOIDCProvider is an in-process OpenID provider, the authorize endpoint
+// signs in as whoever User is and redirects straight back with a code.
+type fakeOIDCProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu sync.Mutex
+	// User holds the claims of the next sign in.
+	User oidcClaims
+	// Nonce replaces the nonce of the ID token when set.
+	Nonce string
+	// Challenges are the PKCE methods of the authorize requests.
+	Challenges []string
+	codes      map[string]fakeOIDCCode
+}
+
+type fakeOIDCCode struct {
+	challenge   string
+	redirectURI string
+	nonce       string
+	claims      oidcClaims
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeOIDCProvider{key: key, codes: map[string]fakeOIDCCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *fakeOIDCProvider) signIn(claims oidcClaims) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.User = claims
+}
+
+func (p *fakeOIDCProvider) discovery(resp http.ResponseWriter, req *http.Request) {
+	json.NewEncoder(resp).Encode(map[string]interface{}{
+		"issuer":                                p.URL,
+		"authorization_endpoint":                p.URL + "/authorize",
+		"token_endpoint":                        p.URL + "/token",
+		"jwks_uri":                              p.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *fakeOIDCProvider) jwks(resp http.ResponseWriter, req *http.Request) {
+	json.NewEncoder(resp).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *fakeOIDCProvider) authorize(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if query.Get("client_id") != oidcTestClientID || query.Get("response_type") != "code" {
+		http.Error(resp, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	p.Challenges = append(p.Challenges, query.Get("code_challenge_method"))
+	code := randomToken()
+	p.codes[code] = fakeOIDCCode{
+		challenge:   query.Get("code_challenge"),
+		redirectURI: query.Get("redirect_uri"),
+		nonce:       query.Get("nonce"),
+		claims:      p.User,
+	}
+	p.mu.Unlock()
+
+	redirect := query.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(resp, req, redirect, http.StatusFound)
+}
+
+func (p *fakeOIDCProvider) token(resp http.ResponseWriter, req *http.Request) {
+	clientID, clientSecret, ok := req.BasicAuth()
+	if !ok {
+		clientID, clientSecret = req.PostFormValue("client_id"), req.PostFormValue("client_secret")
+	}
+	if clientID != oidcTestClientID || clientSecret != oidcTestClientSecret {
+		p.tokenError(resp, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	p.mu.Lock()
+	code, ok := p.codes[req.PostFormValue("code")]
+	delete(p.codes, req.PostFormValue("code"))
+	nonce := p.Nonce
+	p.mu.Unlock()
+	if !ok || code.redirectURI != req.PostFormValue("redirect_uri") {
+		p.tokenError(resp, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	// the S256 challenge is the hash of the verifier
+	verifier := sha256.Sum256([]byte(req.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(verifier[:]) != code.challenge {
+		p.tokenError(resp, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	if nonce == "" {
+		nonce = code.nonce
+	}
+	now := time.Now()
+	idToken, err := p.sign(map[string]interface{}{
+		"iss":                p.URL,
+		"aud":                oidcTestClientID,
+		"sub":                code.claims.Subject,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+		"nonce":              nonce,
+		"email":              code.claims.Email,
+		"email_verified":     code.claims.EmailVerified,
+		"name":               code.claims.Name,
+		"preferred_username": code.claims.PreferredUsername,
+	})
+	if err != nil {
+		p.tokenError(resp, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(resp).Encode(map[string]interface{}{
+		"access_token": randomToken(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (p *fakeOIDCProvider) tokenError(resp http.ResponseWriter, status int, code string) {
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(status)
+	json.NewEncoder(resp).Encode(map[string]string{"error": code})
+}
+
+// sign returns the claims as an RS256 JWT.
+func (p *fakeOIDCProvider) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// newOIDCTestServer returns a test server of an application that signs in
+// with the fake provider.
+func newOIDCTestServer(t *testing.T) (*testServer, *testMocks, *fakeOIDCProvider) {
+	t.Helper()
+
+	app, m := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	provider := newFakeOIDCProvider(t)
+
+	var err error
+	app.oidc, err = newOIDCProvider(context.Background(), provider.URL, oidcTestClientID, oidcTestClientSecret, ts.URL+"/user/oidc/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts, m, provider
+}
+
+// authorize starts a sign in with the request and returns the callback URL
+// the provider sends the browser back to.
+func (ts *testServer) authorize(t *testing.T, req *http.Request) string {
+	t.Helper()
+
+	code, header, _ := ts.do(t, req)
+	if code != http.StatusFound {
+		t.Fatalf("got status %d; want a redirect to the provider", code)
+	}
+	resp, err := ts.Client().Get(header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("the provider returned status %d", resp.StatusCode)
+	}
+	return resp.Header.Get("Location")
+}
+
+// oidcLogin starts a sign in with SSO and returns the callback URL.
+func (ts *testServer) oidcLogin(t *testing.T) string {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/user/oidc/login", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts.authorize(t, req)
+}
+
+// oidcPost starts a link or reauth from the account pages and returns the
+// callback URL.
+func (ts *testServer) oidcPost(t *testing.T, urlPath string, form url.Values) string {
+	t.Helper()
+
+	if form == nil {
+		form = url.Values{}
+	}
+	form.Set("csrf_token", ts.csrfToken(t))
+	req, err := http.NewRequest(http.MethodPost, ts.URL+urlPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return ts.authorize(t, req)
+}
+
+// callback returns the response of the application to the callback URL.
+func (ts *testServer) callback(t *testing.T, callbackURL string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, callbackURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, header, _ := ts.do(t, req)
+	return code, header.Get("Location")
+}
+
+// flash returns the body of the page the callback redirected to, where the
+// flash message is shown.
+func (ts *testServer) flash(t *testing.T, location string) string {
+	t.Helper()
+
+	_, _, body := ts.get(t, location)
+	return body
+}
+
+func TestOIDCProviderPKCE(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	provider.signIn(oidcClaims{Subject: "sub-zed", Email: "zed@example.com", EmailVerified: true, Name: "Zed"})
+	p, err := newOIDCProvider(context.Background(), provider.URL, oidcTestClientID, oidcTestClientSecret, "https://snippetbox.example/user/oidc/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := provider.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	verifier := randomToken()
+	challenge := sha256.Sum256([]byte(verifier))
+	authURL := p.config.AuthCodeURL("state", oidc.Nonce("nonce"),
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+
+	tests := []struct {
+		name     string
+		verifier string
+		wantErr  bool
+	}{
+		{"matching verifier", verifier, false},
+		{"other verifier", randomToken(), true},
+		{"no verifier", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Get(authURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			callbackURL, err := url.Parse(resp.Header.Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := p.config.Exchange(context.Background(), callbackURL.Query().Get("code"), oauth2.SetAuthURLParam("code_verifier", tt.verifier))
+			if tt.wantErr {
+				if err == nil {
+					t.Error("got a token; want the exchange to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rawIDToken, _ := token.Extra("id_token").(string)
+			idToken, err := p.verifier.Verify(context.Background(), rawIDToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var claims oidcClaims
+			if err = idToken.Claims(&claims); err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "sub-zed" || claims.Email != "zed@example.com" || !claims.EmailVerified || claims.Nonce != "nonce" {
+				t.Errorf("got claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginPKCE(t *testing.T) {
+	ts, _, provider := newOIDCTestServer(t)
+	provider.signIn(oidcClaims{Subject: "sub-zed", Email: "zed@example.com", EmailVerified: true, Name: "Zed"})
+
+	code, location := ts.callback(t, ts.oidcLogin(t))
+	if code != http.StatusSeeOther || location != "/snippets/create" {
+		t.Fatalf("got status %d to %q; want a redirect to /snippets/create", code, location)
+	}
+	if len(provider.Challenges) != 1 || provider.Challenges[0] != "S256" {
+		t.Errorf("got challenge methods %v; want [S256]", provider.Challenges)
+	}
+
+	// a second sign in replaces the verifier in the session, so the code of
+	// the first no longer matches it
+	other := newTestServer(t, ts.Config.Handler)
+	first, err := url.Parse(other.oidcLogin(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := url.Parse(other.oidcLogin(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := first.Query()
+	query.Set("state", second.Query().Get("state"))
+	first.RawQuery = query.Encode()
+
+	code, location = other.callback(t, first.String())
+	if code != http.StatusSeeOther || location != "/user/login" {
+		t.Fatalf("got status %d to %q; want a redirect to /user/login", code, location)
+	}
+	if !strings.Contains(other.flash(t, location), "Sign in with SSO failed") {
+		t.Error("the login page doesn't show the failure")
+	}
+	if code, _, _ = other.get(t, "/account"); code != http.StatusSeeOther {
+		t.Errorf("got status %d for the account page; want %d", code, http.StatusSeeOther)
+	}
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	ts, m, provider := newOIDCTestServer(t)
+	provider.signIn(oidcClaims{Subject: "sub-zed", Email: "zed@example.com", EmailVerified: true, Name: "Zed"})
+
+	if code, _ := ts.callback(t, ts.URL+"/user/oidc/callback?code=x&state=y"); code != http.StatusBadRequest {
+		t.Errorf("got status %d without a sign in; want %d", code, http.StatusBadRequest)
+	}
+
+	callbackURL, err := url.Parse(ts.oidcLogin(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := callbackURL.Query()
+	query.Set("state", "forged")
+	callbackURL.RawQuery = query.Encode()
+
+	if code, _ := ts.callback(t, callbackURL.String()); code != http.StatusBadRequest {
+		t.Errorf("got status %d for a forged state; want %d", code, http.StatusBadRequest)
+	}
+	if _, err := m.users.GetByEmail("zed@example.com"); err != models.ErrNoRecord {
+		t.Errorf("got error %v for the user; want %v", err, models.ErrNoRecord)
+	}
+}
+
+func TestOIDCCallbackNonce(t *testing.T) {
+	ts, m, provider := newOIDCTestServer(t)
+	provider.signIn(oidcClaims{Subject: "sub-zed", Email: "zed@example.com", EmailVerified: true, Name: "Zed"})
+	provider.Nonce = "replayed"
+
+	code, location := ts.callback(t, ts.oidcLogin(t))
+	if code != http.StatusSeeOther || location != "/user/login" {
+		t.Fatalf("got status %d to %q; want a redirect to /user/login", code, location)
+	}
+	if !strings.Contains(ts.flash(t, location), "Sign in with SSO failed") {
+		t.Error("the login page doesn't show the failure")
+	}
+	if _, err := m.users.GetByEmail("zed@example.com"); err != models.ErrNoRecord {
+		t.Errorf("got error %v for the user; want %v", err, models.ErrNoRecord)
+	}
+}
+
+func TestOIDCFirstLogin(t *testing.T) {
+	tests := []struct {
+		name         string
+		claims       oidcClaims
+		wantLocation string
+		wantFlash    string
+		wantUserID   int
+		wantUsername string
+	}{
+		{
+			name:         "new user",
+			claims:       oidcClaims{Subject: "sub-zed", Email: "Zed@Example.com", EmailVerified: true, Name: "Zed Zero", PreferredUsername: "Zed.Zero"},
+			wantLocation: "/snippets/create",
+			wantUserID:   adamID + 1,
+			wantUsername: "zed-zero",
+		},
+		{
+			name:         "taken username",
+			claims:       oidcClaims{Subject: "sub-other-alice", Email: "alice@example.org", EmailVerified: true, PreferredUsername: "alice"},
+			wantLocation: "/snippets/create",
+			wantUserID:   adamID + 1,
+			wantUsername: "alice-2",
+		},
+		{
+			name:         "verified email",
+			claims:       oidcClaims{Subject: "sub-alice", Email: "alice@example.com", EmailVerified: true, PreferredUsername: "alice.sso"},
+			wantLocation: "/snippets/create",
+			wantUserID:   aliceID,
+			wantUsername: "alice",
+		},
+		{
+			name:         "unverified email",
+			claims:       oidcClaims{Subject: "sub-alice", Email: "alice@example.com"},
+			wantLocation: "/user/login",
+			wantFlash:    "log in with your password and link SSO",
+		},
+		{
+			name:         "no email",
+			claims:       oidcClaims{Subject: "sub-alice"},
+			wantLocation: "/user/login",
+			wantFlash:    "Your SSO account has no email address.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, m, provider := newOIDCTestServer(t)
+			provider.signIn(tt.claims)
+
+			code, location := ts.callback(t, ts.oidcLogin(t))
+			if code != http.StatusSeeOther || location != tt.wantLocation {
+				t.Fatalf("got status %d to %q; want a redirect to %q", code, location, tt.wantLocation)
+			}
+
+			identity, err := m.identities.Get(provider.URL, tt.claims.Subject)
+			if tt.wantUserID == 0 {
+				if err != models.ErrNoRecord {
+					t.Errorf("got identity %+v, error %v; want none", identity, err)
+				}
+				if !strings.Contains(ts.flash(t, location), tt.wantFlash) {
+					t.Errorf("the login page doesn't show %q", tt.wantFlash)
+				}
+				if code, _, _ = ts.get(t, "/account"); code != http.StatusSeeOther {
+					t.Errorf("got status %d for the account page; want %d", code, http.StatusSeeOther)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.UserID != tt.wantUserID {
+				t.Errorf("got identity of user %d; want %d", identity.UserID, tt.wantUserID)
+			}
+			user, err := m.users.Get(tt.wantUserID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Username != tt.wantUsername || user.Email != strings.ToLower(tt.claims.Email) {
+				t.Errorf("got user %s <%s>; want %s <%s>", user.Username, user.Email, tt.wantUsername, strings.ToLower(tt.claims.Email))
+			}
+			if code, _, body := ts.get(t, "/account"); code != http.StatusOK || !strings.Contains(body, user.Email) {
+				t.Errorf("got status %d for the account page; want %d", code, http.StatusOK)
+			}
+
+			// the second sign in finds the identity
+			other := newTestServer(t, ts.Config.Handler)
+			if code, location = other.callback(t, other.oidcLogin(t)); code != http.StatusSeeOther || location != tt.wantLocation {
+				t.Errorf("got status %d to %q on the second sign in", code, location)
+			}
+			next := adamID + 1
+			if tt.wantUserID > adamID {
+				next = tt.wantUserID + 1
+			}
+			if _, err := m.users.Get(next); err != models.ErrNoRecord {
+				t.Error("the second sign in created another user")
+			}
+		})
+	}
+}
+
+func TestOIDCLoginSuspended(t *testing.T) {
+	ts, m, provider := newOIDCTestServer(t)
+	if err := m.identities.Insert(bobID, provider.URL, "sub-bob", "bob@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	m.users.SetSuspended(bobID, true)
+	provider.signIn(oidcClaims{Subject: "sub-bob", Email: "bob@example.com", EmailVerified: true})
+
+	code, location := ts.callback(t, ts.oidcLogin(t))
+	if code != http.StatusSeeOther || location != "/user/login" {
+		t.Fatalf("got status %d to %q; want a redirect to /user/login", code, location)
+	}
+	if !strings.Contains(ts.flash(t, location), "Your account has been suspended") {
+		t.Error("the login page doesn't show the suspension")
+	}
+	if code, _, _ = ts.get(t, "/account"); code != http.StatusSeeOther {
+		t.Errorf("got status %d for the account page; want %d", code, http.StatusSeeOther)
+	}
+
+	events := m.auditLog.Events()
+	if len(events) == 0 || events[len(events)-1].Action != models.AuditLoginFailed {
+		t.Errorf("got audit events %+v; want a failed login last", events)
+	}
+}
+
+func TestOIDCLink(t *testing.T) {
+	tests := []struct {
+		name       string
+		linkedTo   int
+		wantFlash  string
+		wantUserID int
+	}{
+		{"new identity", 0, "Your SSO account has been linked.", aliceID},
+		{"already linked", aliceID, "That SSO account is already linked.", aliceID},
+		{"linked to another user", bobID, "That SSO account is linked to another user.", bobID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, m, provider := newOIDCTestServer(t)
+			if tt.linkedTo != 0 {
+				if err := m.identities.Insert(tt.linkedTo, provider.URL, "sub-sso", "sso@example.com"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// the email of the identity doesn't need to match the account
+			provider.signIn(oidcClaims{Subject: "sub-sso", Email: "sso@example.com"})
+			ts.login(t, "alice")
+
+			code, location := ts.callback(t, ts.oidcPost(t, "/account/identities/link", nil))
+			if code != http.StatusSeeOther || location != "/account" {
+				t.Fatalf("got status %d to %q; want a redirect to /account", code, location)
+			}
+			if !strings.Contains(ts.flash(t, location), tt.wantFlash) {
+				t.Errorf("the account page doesn't show %q", tt.wantFlash)
+			}
+
+			identity, err := m.identities.Get(provider.URL, "sub-sso")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.UserID != tt.wantUserID {
+				t.Errorf("got identity of user %d; want %d", identity.UserID, tt.wantUserID)
+			}
+		})
+	}
+}
+
+func TestOIDCReauth(t *testing.T) {
+	tests := []struct {
+		name         string
+		linkedTo     int
+		wantLocation string
+		wantFlash    string
+		wantAudit    string
+	}{
+		{"linked identity", aliceID, "/account/password", "", models.AuditLogin},
+		{"unlinked identity", 0, "/account", "linked to your account", models.AuditReauthFailed},
+		{"identity of another user", bobID, "/account", "linked to your account", models.AuditReauthFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, m, provider := newOIDCTestServer(t)
+			if tt.linkedTo != 0 {
+				if err := m.identities.Insert(tt.linkedTo, provider.URL, "sub-sso", "sso@example.com"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			provider.signIn(oidcClaims{Subject: "sub-sso", Email: "sso@example.com", EmailVerified: true})
+			ts.login(t, "alice")
+
+			callbackURL := ts.oidcPost(t, "/account/reauth/oidc", url.Values{"next": {"/account/password"}})
+			code, location := ts.callback(t, callbackURL)
+			if code != http.StatusSeeOther || location != tt.wantLocation {
+				t.Fatalf("got status %d to %q; want a redirect to %q", code, location, tt.wantLocation)
+			}
+			if tt.wantFlash != "" && !strings.Contains(ts.flash(t, location), tt.wantFlash) {
+				t.Errorf("the account page doesn't show %q", tt.wantFlash)
+			}
+
+			events := m.auditLog.Events()
+			if len(events) == 0 || events[len(events)-1].Action != tt.wantAudit {
+				t.Errorf("got audit events %+v; want %s last", events, tt.wantAudit)
+			}
+			// a failed reauth keeps the user logged in
+			if code, _, _ = ts.get(t, "/account"); code != http.StatusOK {
+				t.Errorf("got status %d for the account page; want %d", code, http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestOIDCUsername(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims oidcClaims
+		want   string
+	}{
+		{"preferred username", oidcClaims{PreferredUsername: "Zed.Zero", Email: "zed@example.com"}, "zed-zero"},
+		{"preferred username is an email", oidcClaims{PreferredUsername: "zed@example.com", Email: "other@example.com"}, "other"},
+		{"email", oidcClaims{Email: "_zed_@example.com"}, "zed"},
+		{"short", oidcClaims{PreferredUsername: "z"}, "z00"},
+		{"long", oidcClaims{PreferredUsername: strings.Repeat("z", 29) + "-z"}, strings.Repeat("z", 29)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := oidcUsername(&tt.claims); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
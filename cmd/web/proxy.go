@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// client is where a request really came from, it differs from RemoteAddr
+// behind a trusted reverse proxy.
+type client struct {
+	IP     string
+	Scheme string
+	// ViaProxy is true when the request was forwarded by a trusted proxy.
+	ViaProxy bool
+}
+
+const clientContextKey = contextKey("client")
+
+// parseCIDRs parses networks like 10.0.0.0/8, a single address is a network
+// of its own.
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (app *application) isTrustedProxy(ip net.IP) bool {
+	for _, network := range app.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHop is one proxy hop of a Forwarded or X-Forwarded-For header.
+type forwardedHop struct {
+	ip    net.IP
+	proto string
+}
+
+// forwardedHops returns the hops of the Forwarded header, or else of
+// X-Forwarded-For, the client first. A hop the address of which can't be
+// parsed, like for=unknown, has a nil ip.
+func forwardedHops(req *http.Request) []forwardedHop {
+	hops := []forwardedHop{}
+	if values := req.Header.Values("Forwarded"); len(values) > 0 {
+		for _, element := range strings.Split(strings.Join(values, ","), ",") {
+			hop := forwardedHop{}
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				value = strings.Trim(value, `"`)
+				switch strings.ToLower(key) {
+				case "for":
+					hop.ip = parseHopIP(value)
+				case "proto":
+					hop.proto = strings.ToLower(value)
+				}
+			}
+			hops = append(hops, hop)
+		}
+		return hops
+	}
+
+	for _, value := range req.Header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(value, ",") {
+			hops = append(hops, forwardedHop{ip: parseHopIP(strings.TrimSpace(addr))})
+		}
+	}
+	return hops
+}
+
+// parseHopIP accepts 192.0.2.1, 192.0.2.1:80, 2001:db8::1 and [2001:db8::1]:80.
+func parseHopIP(value string) net.IP {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	return net.ParseIP(strings.Trim(value, "[]"))
+}
+
+// cut is strings.Cut, which needs Go 1.18.
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// resolveClient works out the client of the request and stores it in the
+// request context. The forwarding headers are only believed when the request
+// comes from a trusted proxy. They are read from the right, every hop added by
+// a trusted proxy is skipped and the first other address is the client.
+func (app *application) resolveClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		c := peerClient(req)
+		if peer := net.ParseIP(c.IP); peer != nil && app.isTrustedProxy(peer) {
+			c.ViaProxy = true
+			hops := forwardedHops(req)
+			clientHop := -1
+			for i := len(hops) - 1; i >= 0; i-- {
+				// a hop that can't be parsed could be anything, the last
+				// trusted proxy is as far as it goes
+				if hops[i].ip == nil {
+					break
+				}
+				c.IP, clientHop = hops[i].ip.String(), i
+				if !app.isTrustedProxy(hops[i].ip) {
+					break
+				}
+			}
+
+			// the proxy the client connected to knows the scheme
+			proto := strings.TrimSpace(strings.Split(req.Header.Get("X-Forwarded-Proto"), ",")[0])
+			if req.Header.Get("Forwarded") != "" {
+				proto = ""
+				if clientHop >= 0 {
+					proto = hops[clientHop].proto
+				}
+			}
+			if proto = strings.ToLower(proto); proto == "http" || proto == "https" {
+				c.Scheme = proto
+			}
+		}
+
+		if app.forceHTTPS && c.ViaProxy && c.Scheme == "http" {
+			http.Redirect(resp, req, "https://"+req.Host+req.URL.RequestURI(), http.StatusMovedPermanently)
+			return
+		}
+
+		ctx := context.WithValue(req.Context(), clientContextKey, c)
+		next.ServeHTTP(resp, req.WithContext(ctx))
+	})
+}
+
+// requestClient returns the client resolveClient stored in the context.
+func requestClient(req *http.Request) *client {
+	if c, ok := req.Context().Value(clientContextKey).(*client); ok {
+		return c
+	}
+	return peerClient(req)
+}
+
+// peerClient is the client as seen on the connection.
+func peerClient(req *http.Request) *client {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	c := &client{IP: host, Scheme: "http"}
+	if req.TLS != nil {
+		c.Scheme = "https"
+	}
+	return c
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestForwardedHops(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    []forwardedHop
+	}{
+		{
+			name: "none",
+			want: []forwardedHop{},
+		},
+		{
+			name:    "x-forwarded-for",
+			headers: map[string]string{"X-Forwarded-For": "203.0.113.7, 10.0.0.2"},
+			want:    []forwardedHop{{ip: parseHopIP("203.0.113.7")}, {ip: parseHopIP("10.0.0.2")}},
+		},
+		{
+			name:    "forwarded",
+			headers: map[string]string{"Forwarded": `for=203.0.113.7;proto=HTTPS, for="10.0.0.2"`},
+			want:    []forwardedHop{{ip: parseHopIP("203.0.113.7"), proto: "https"}, {ip: parseHopIP("10.0.0.2")}},
+		},
+		{
+			name:    "forwarded before x-forwarded-for",
+			headers: map[string]string{"Forwarded": "for=203.0.113.7", "X-Forwarded-For": "198.51.100.1"},
+			want:    []forwardedHop{{ip: parseHopIP("203.0.113.7")}},
+		},
+		{
+			name:    "unknown",
+			headers: map[string]string{"Forwarded": "for=unknown, for=10.0.0.2"},
+			want:    []forwardedHop{{}, {ip: parseHopIP("10.0.0.2")}},
+		},
+		{
+			name:    "ipv6 with port",
+			headers: map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https`},
+			want:    []forwardedHop{{ip: parseHopIP("2001:db8::1"), proto: "https"}},
+		},
+		{
+			name:    "ipv4 with port",
+			headers: map[string]string{"X-Forwarded-For": "203.0.113.7:4711"},
+			want:    []forwardedHop{{ip: parseHopIP("203.0.113.7")}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			hops := forwardedHops(req)
+			if len(hops) != len(tt.want) {
+				t.Fatalf("got %d hops; want %d", len(hops), len(tt.want))
+			}
+			for i, hop := range hops {
+				if !hop.ip.Equal(tt.want[i].ip) || hop.proto != tt.want[i].proto {
+					t.Errorf("hop %d: got %v %q; want %v %q", i, hop.ip, hop.proto, tt.want[i].ip, tt.want[i].proto)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveClient(t *testing.T) {
+	trustedProxies, err := parseCIDRs([]string{"10.0.0.0/8", "2001:db8:ffff::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		headers      map[string]string
+		forceHTTPS   bool
+		wantIP       string
+		wantScheme   string
+		wantViaProxy bool
+		wantRedirect bool
+	}{
+		{
+			name:       "no proxy",
+			remoteAddr: "203.0.113.7:4711",
+			wantIP:     "203.0.113.7",
+			wantScheme: "http",
+		},
+		{
+			name:       "untrusted peer",
+			remoteAddr: "203.0.113.7:4711",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "https"},
+			wantIP:     "203.0.113.7",
+			wantScheme: "http",
+		},
+		{
+			name:         "trusted peer",
+			remoteAddr:   "10.0.0.1:4711",
+			headers:      map[string]string{"X-Forwarded-For": "203.0.113.7"},
+			wantIP:       "203.0.113.7",
+			wantScheme:   "http",
+			wantViaProxy: true,
+		},
+		{
+			name:         "chain of trusted hops",
+			remoteAddr:   "10.0.0.1:4711",
+			headers:      map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.7, 10.0.0.3, 10.0.0.2"},
+			wantIP:       "203.0.113.7",
+			wantScheme:   "http",
+			wantViaProxy: true,
+		},
+		{
+			name:         "only trusted hops",
+			remoteAddr:   "10.0.0.1:4711",
+			headers:      map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"},
+			wantIP:       "10.0.0.3",
+			wantScheme:   "http",
+			wantViaProxy: true,
+		},
+		{
+			name:         "for unknown",
+			remoteAddr:   "10.0.0.1:4711",
+			headers:      map[string]string{"Forwarded": "for=203.0.113.7;proto=https, for=unknown"},
+			wantIP:       "10.0.0.1",
+			wantScheme:   "http",
+			wantViaProxy: true,
+		},
+		{
+			name:         "for unknown behind the client",
+			remoteAddr:   "10.0.0.1:4711",
+			headers:      map[string]string{"Forwarded": "for=unknown, for=203.0.113.7;proto=https"},
+			wantIP:       "203.0.113.7",
+			wantScheme:   "https",
+			wantViaProxy: true,
+		},
+		{
+			name:         "ipv6 with port",
+			remoteAddr:   "[2001:db8:ffff::1]:4711",
+			headers:      map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https`},
+			wantIP:       "2001:db8::1",
+			wantScheme:   "https",
+			wantViaProxy: true,
+		},
+		{
+			name:         "x-forwarded-proto",
+			remoteAddr:   "10.0.0.1:4711",
+			headers:      map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Forwarded-Proto": "https, http"},
+			wantIP:       "203.0.113.7",
+			wantScheme:   "https",
+			wantViaProxy: true,
+		},
+		{
+			name:       "forwarded over x-forwarded-proto",
+			remoteAddr: "10.0.0.1:4711",
+			headers: map[string]string{
+				"Forwarded":         "for=203.0.113.7;proto=http",
+				"X-Forwarded-For":   "198.51.100.1",
+				"X-Forwarded-Proto": "https",
+			},
+			wantIP:       "203.0.113.7",
+			wantScheme:   "http",
+			wantViaProxy: true,
+		},
+		{
+			name:         "force https",
+			remoteAddr:   "10.0.0.1:4711",
+			headers:      map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Forwarded-Proto": "http"},
+			forceHTTPS:   true,
+			wantRedirect: true,
+		},
+		{
+			name:       "force https without proxy",
+			remoteAddr: "203.0.113.7:4711",
+			forceHTTPS: true,
+			wantIP:     "203.0.113.7",
+			wantScheme: "http",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{trustedProxies: trustedProxies, forceHTTPS: tt.forceHTTPS}
+
+			var got *client
+			next := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				got = requestClient(req)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/snippet/view/1", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+			app.resolveClient(next).ServeHTTP(rr, req)
+
+			if tt.wantRedirect {
+				if rr.Code != http.StatusMovedPermanently || got != nil {
+					t.Fatalf("got status %d; want a redirect", rr.Code)
+				}
+				if location := rr.Header().Get("Location"); location != "https://example.com/snippet/view/1" {
+					t.Errorf("got location %q", location)
+				}
+				return
+			}
+
+			if got == nil {
+				t.Fatalf("the next handler didn't run, status %d", rr.Code)
+			}
+			if got.IP != tt.wantIP {
+				t.Errorf("got ip %q; want %q", got.IP, tt.wantIP)
+			}
+			if got.Scheme != tt.wantScheme {
+				t.Errorf("got scheme %q; want %q", got.Scheme, tt.wantScheme)
+			}
+			if got.ViaProxy != tt.wantViaProxy {
+				t.Errorf("got via proxy %t; want %t", got.ViaProxy, tt.wantViaProxy)
+			}
+		})
+	}
+}
+
+func TestSecureCookies(t *testing.T) {
+	trustedProxies, err := parseCIDRs([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		secureCookies bool
+		headers       map[string]string
+		want          bool
+	}{
+		{
+			name:          "https behind a trusted proxy",
+			secureCookies: true,
+			headers:       map[string]string{"X-Forwarded-Proto": "https"},
+			want:          true,
+		},
+		{
+			name:          "plain http development",
+			secureCookies: false,
+			want:          false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := newTestApplication(t)
+			app.trustedProxies = trustedProxies
+			app.secureCookies = tt.secureCookies
+			app.sessionManager.Cookie.Secure = tt.secureCookies
+
+			serve := func(req *http.Request) *http.Response {
+				req.RemoteAddr = "10.0.0.2:4711"
+				for key, value := range tt.headers {
+					req.Header.Set(key, value)
+				}
+				rr := httptest.NewRecorder()
+				app.routes().ServeHTTP(rr, req)
+				return rr.Result()
+			}
+
+			// the login page sets the CSRF cookie, logging in the session one
+			resp := serve(httptest.NewRequest(http.MethodGet, "/user/login", nil))
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			matches := csrfTokenRX.FindSubmatch(body)
+			if len(matches) < 2 {
+				t.Fatal("no csrf token found in body")
+			}
+			form := url.Values{}
+			form.Set("email", "bob@example.com")
+			form.Set("password", "pa$$word")
+			form.Set("csrf_token", html.UnescapeString(string(matches[1])))
+			req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Referer", "https://example.com/user/login")
+			for _, cookie := range resp.Cookies() {
+				req.AddCookie(cookie)
+			}
+			cookies := append(resp.Cookies(), serve(req).Cookies()...)
+
+			got := map[string]bool{}
+			for _, cookie := range cookies {
+				got[cookie.Name] = cookie.Secure
+			}
+			for _, name := range []string{"session", "csrf_token"} {
+				secure, ok := got[name]
+				if !ok {
+					t.Fatalf("no %s cookie set, got %v", name, got)
+				}
+				if secure != tt.want {
+					t.Errorf("got Secure %t on the %s cookie; want %t", secure, name, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/justinas/alice"
 	"net/http"
+	"snippetbox.labkita.my.id/internal/models"
 )
 
 func (app *application) routes() http.Handler {
@@ -11,7 +12,7 @@ func (app *application) routes() http.Handler {
 	router := httprouter.New()
 
 	// Static asset Route
-	fileServer := http.FileServer(http.Dir("./ui/static/"))
+	fileServer := http.FileServer(http.Dir(app.staticDir))
 	router.Handler(http.MethodGet, "/static/*filepath", http.StripPrefix("/static", fileServer))
 
 	// Custom Handler
@@ -20,25 +21,80 @@ func (app *application) routes() http.Handler {
 	})
 
 	// route middleware
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf)
+	dynamic := alice.New(app.sessionManager.LoadAndSave, app.noSurf, app.authenticate)
 
 	// Handler Route
 	router.Handler(http.MethodGet, "/", dynamic.ThenFunc(app.home))
 	router.Handler(http.MethodGet, "/snippets", dynamic.ThenFunc(app.snippetList))
 	router.Handler(http.MethodGet, "/snippets/view/:id", dynamic.ThenFunc(app.snippetView))
+	router.Handler(http.MethodGet, "/tags/:name", dynamic.ThenFunc(app.tagView))
+	router.Handler(http.MethodGet, "/search", dynamic.ThenFunc(app.snippetSearch))
+	router.Handler(http.MethodGet, "/u/:username", dynamic.ThenFunc(app.userProfile))
+	router.Handler(http.MethodGet, "/u/:username/starred", dynamic.ThenFunc(app.userStarred))
 	router.Handler(http.MethodGet, "/user/signup", dynamic.ThenFunc(app.userSignupForm))
 	router.Handler(http.MethodPost, "/user/signup", dynamic.ThenFunc(app.userSignup))
 	router.Handler(http.MethodGet, "/user/login", dynamic.ThenFunc(app.userLoginForm))
 	router.Handler(http.MethodPost, "/user/login", dynamic.ThenFunc(app.userLogin))
+	router.Handler(http.MethodGet, "/user/oidc/login", dynamic.ThenFunc(app.oidcLogin))
+	router.Handler(http.MethodGet, "/user/oidc/callback", dynamic.ThenFunc(app.oidcCallback))
 
 	protected := dynamic.Append(app.requireAuthentication)
 
 	router.Handler(http.MethodGet, "/snippets/create", protected.ThenFunc(app.snippetCreateForm))
 	router.Handler(http.MethodPost, "/snippets/create", protected.ThenFunc(app.snippetCreate))
+	router.Handler(http.MethodPost, "/snippets/fork/:id", protected.ThenFunc(app.snippetFork))
+	router.Handler(http.MethodPost, "/snippets/star/:id", protected.ThenFunc(app.snippetStar))
+	router.Handler(http.MethodPost, "/snippets/unstar/:id", protected.ThenFunc(app.snippetUnstar))
+	router.Handler(http.MethodPost, "/snippets/comment/:id", protected.ThenFunc(app.commentCreate))
+	router.Handler(http.MethodGet, "/comments/edit/:id", protected.ThenFunc(app.commentEditForm))
+	router.Handler(http.MethodPost, "/comments/edit/:id", protected.ThenFunc(app.commentEdit))
+	router.Handler(http.MethodPost, "/comments/delete/:id", protected.ThenFunc(app.commentDelete))
+	router.Handler(http.MethodGet, "/snippets/report/:id", protected.ThenFunc(app.snippetReportForm))
+	router.Handler(http.MethodPost, "/snippets/report/:id", protected.ThenFunc(app.snippetReport))
+	router.Handler(http.MethodGet, "/snippets/import", protected.ThenFunc(app.snippetImportForm))
+	router.Handler(http.MethodPost, "/snippets/import", protected.ThenFunc(app.snippetImport))
+	router.Handler(http.MethodGet, "/user/snippets", protected.ThenFunc(app.userSnippets))
+	router.Handler(http.MethodGet, "/account", protected.ThenFunc(app.account))
+	router.Handler(http.MethodPost, "/account/sessions/revoke/:id", protected.ThenFunc(app.accountSessionRevoke))
+	router.Handler(http.MethodPost, "/account/sessions/revoke-others", protected.ThenFunc(app.accountSessionRevokeOthers))
+	router.Handler(http.MethodGet, "/account/reauth", protected.ThenFunc(app.accountReauthForm))
+	router.Handler(http.MethodPost, "/account/reauth", protected.ThenFunc(app.accountReauth))
+	router.Handler(http.MethodPost, "/account/reauth/oidc", protected.ThenFunc(app.oidcReauth))
+	router.Handler(http.MethodPost, "/account/identities/link", protected.ThenFunc(app.oidcLink))
+	router.Handler(http.MethodGet, "/account/delete", protected.ThenFunc(app.accountDeleteForm))
+	router.Handler(http.MethodPost, "/account/delete", protected.ThenFunc(app.accountDelete))
+	router.Handler(http.MethodPost, "/account/delete/cancel", protected.ThenFunc(app.accountDeleteCancel))
+
+	sensitive := protected.Append(app.requireRecentAuth)
+
+	router.Handler(http.MethodGet, "/account/password", sensitive.ThenFunc(app.accountPasswordForm))
+	router.Handler(http.MethodPost, "/account/password", sensitive.ThenFunc(app.accountPassword))
+	router.Handler(http.MethodGet, "/account/export", sensitive.ThenFunc(app.accountExport))
 	router.Handler(http.MethodPost, "/user/logout", dynamic.ThenFunc(app.userLogout))
 
+	moderation := protected.Append(app.requireRole(models.RoleModerator, models.RoleAdmin))
+
+	router.Handler(http.MethodGet, "/admin/reports", moderation.ThenFunc(app.adminReports))
+	router.Handler(http.MethodPost, "/admin/reports/resolve/:id", moderation.ThenFunc(app.adminReportResolve))
+
+	admin := protected.Append(app.requireRole(models.RoleAdmin))
+
+	router.Handler(http.MethodGet, "/admin", admin.ThenFunc(app.adminDashboard))
+	router.Handler(http.MethodGet, "/admin/users", admin.ThenFunc(app.adminUsers))
+	router.Handler(http.MethodPost, "/admin/users/suspend/:id", admin.ThenFunc(app.adminUserSuspend))
+	router.Handler(http.MethodPost, "/admin/users/unsuspend/:id", admin.ThenFunc(app.adminUserUnsuspend))
+	router.Handler(http.MethodPost, "/admin/users/logout/:id", admin.ThenFunc(app.adminUserLogout))
+	router.Handler(http.MethodGet, "/admin/audit", admin.ThenFunc(app.adminAudit))
+	// the export may take longer than the write-timeout of the server
+	router.Handler(http.MethodGet, "/admin/audit/export", alice.New(app.extendWriteDeadline(auditExportTimeout)).Extend(admin).ThenFunc(app.adminAuditExport))
+
+	// api route, authenticated by the session cookie but without the csrf form token
+	api := alice.New(app.sessionManager.LoadAndSave, app.authenticate, app.requireAPIAuthentication)
+
+	router.Handler(http.MethodPost, "/api/snippets/import", api.Append(requireContentType("application/json", "application/zip")).ThenFunc(app.apiSnippetImport))
+
 	// global middleware
-	standard := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
+	standard := alice.New(requestID, app.resolveClient, app.logRequest, app.recoverPanic, secureHeaders)
 
 	return standard.Then(router)
 }
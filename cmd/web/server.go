@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// serve runs srv, over HTTPS when certs is set, and the optional redirect
+// server until SIGINT or SIGTERM. It then stops accepting connections and
+// gives the in-flight requests up to timeout to finish before closing what is
+// left, and stops the background jobs. SIGHUP reloads the certificate. The
+// caller closes the database after serve returned.
+func (app *application) serve(srv, redirect *http.Server, certs *certReloader, timeout time.Duration) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	return app.serveUntil(srv, redirect, certs, timeout, signals)
+}
+
+// serveUntil is serve with the signals read from a channel, it returns after
+// the first one other than SIGHUP.
+func (app *application) serveUntil(srv, redirect *http.Server, certs *certReloader, timeout time.Duration, signals <-chan os.Signal) error {
+	serverError := make(chan error, 2)
+	go func() {
+		var err error
+		if certs != nil {
+			app.logger.Info("starting https server", "addr", srv.Addr)
+			// the certificate comes from TLSConfig.GetCertificate
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			app.logger.Info("starting server", "addr", srv.Addr)
+			err = srv.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			serverError <- err
+		}
+	}()
+	if redirect != nil {
+		go func() {
+			app.logger.Info("redirecting http to https", "addr", redirect.Addr)
+			if err := redirect.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serverError <- err
+			}
+		}()
+	}
+
+	var s os.Signal
+	for s == nil {
+		select {
+		case err := <-serverError:
+			return err
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				s = sig
+			} else if certs == nil {
+				app.logger.Info("caught hangup, there is no certificate to reload")
+			} else if err := certs.reload(); err != nil {
+				app.logger.Error("reload certificate, keeping the current one", "error", err)
+			} else {
+				app.logger.Info("reloaded certificate")
+			}
+		}
+	}
+	// a second signal kills the process the usual way
+	signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+
+	app.logger.Info("caught signal, waiting for in-flight requests", "signal", s, "timeout", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if redirect != nil {
+		if err := redirect.Shutdown(ctx); err != nil {
+			redirect.Close()
+		}
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		app.logger.Error("shutdown, closing the remaining connections", "error", err)
+		srv.Close()
+	} else {
+		app.logger.Info("in-flight requests finished")
+	}
+
+	app.logger.Info("stopping background jobs")
+	app.stopBackground()
+	return nil
+}
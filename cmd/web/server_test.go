@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"snippetbox.labkita.my.id/internal/logging"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	logger, err := logging.New(io.Discard, logging.LevelError, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{logger: logger}
+	app.jobsCtx, app.stopJobs = context.WithCancel(context.Background())
+
+	jobStopped := make(chan struct{})
+	app.background(func(ctx context.Context) {
+		<-ctx.Done()
+		close(jobStopped)
+	})
+
+	started := make(chan struct{})
+	shuttingDown := make(chan struct{})
+	stoppedEarly := make(chan bool, 1)
+	handler := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		close(started)
+		// finish only once the shutdown waits for this request
+		<-shuttingDown
+		select {
+		case <-jobStopped:
+			stoppedEarly <- true
+		default:
+			stoppedEarly <- false
+		}
+		resp.Write([]byte("OK"))
+	})
+
+	srv := &http.Server{Addr: freeAddr(t), Handler: handler}
+	srv.RegisterOnShutdown(func() { close(shuttingDown) })
+
+	signals := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- app.serveUntil(srv, nil, nil, 5*time.Second, signals)
+	}()
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		var resp *http.Response
+		var err error
+		// the server starts in the background
+		for i := 0; i < 100; i++ {
+			resp, err = http.Get("http://" + srv.Addr)
+			if err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- result{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	select {
+	case <-started:
+	case r := <-responses:
+		t.Fatalf("the request finished before shutdown: %+v", r)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request didn't reach the handler")
+	}
+	signals <- syscall.SIGTERM
+
+	r := <-responses
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.status != http.StatusOK || r.body != "OK" {
+		t.Errorf("got %d %q; want %d %q", r.status, r.body, http.StatusOK, "OK")
+	}
+	if <-stoppedEarly {
+		t.Error("the background jobs stopped before the in-flight request finished")
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveUntil didn't return")
+	}
+	select {
+	case <-jobStopped:
+	default:
+		t.Error("serveUntil returned before the background jobs stopped")
+	}
+}
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// deadlineWriter records the write deadline it is given.
+type deadlineWriter struct {
+	*httptest.ResponseRecorder
+	deadline time.Time
+}
+
+func (w *deadlineWriter) SetWriteDeadline(deadline time.Time) error {
+	w.deadline = deadline
+	return nil
+}
+
+func TestExtendWriteDeadline(t *testing.T) {
+	app, _ := newTestApplication(t)
+	handler := app.extendWriteDeadline(time.Hour)(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusNoContent)
+	}))
+
+	w := &deadlineWriter{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(&statusRecorder{ResponseWriter: w}, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("got status %d; want %d", w.Code, http.StatusNoContent)
+	}
+	if until := time.Until(w.deadline); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("got a deadline in %s; want one in an hour", until)
+	}
+}
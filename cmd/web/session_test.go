@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/alexedwards/scs/v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionSavesTimes(t *testing.T) {
+	tests := []string{"loginTime", "authTime", "lastSeen"}
+
+	for _, key := range tests {
+		t.Run(key, func(t *testing.T) {
+			sessionManager := scs.New()
+			want := time.Now().Round(0)
+
+			put := sessionManager.LoadAndSave(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				sessionManager.Put(req.Context(), key, want)
+			}))
+			rec := httptest.NewRecorder()
+			put.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d saving the session; want %d", rec.Code, http.StatusOK)
+			}
+			cookies := rec.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("got %d cookies; want the session cookie", len(cookies))
+			}
+
+			var got time.Time
+			get := sessionManager.LoadAndSave(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+				got = sessionManager.GetTime(req.Context(), key)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(cookies[0])
+			get.ServeHTTP(httptest.NewRecorder(), req)
+			if !got.Equal(want) {
+				t.Errorf("got %v after reloading the session; want %v", got, want)
+			}
+		})
+	}
+}
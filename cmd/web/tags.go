@@ -0,0 +1,74 @@
+package main
+
+import (
+	"snippetbox.labkita.my.id/internal/models"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// parseTags splits a free-form tag list on commas and whitespace, lowercases
+// every tag and drops duplicates while keeping the original order.
+func parseTags(value string) []string {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, field := range fields {
+		tag := strings.ToLower(field)
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// parseSearchQuery separates the tag:name filters from the free text of a
+// search query, a tag given more than once is returned once.
+func parseSearchQuery(query string) (string, []string) {
+	terms := []string{}
+	tags := []string{}
+	for _, field := range strings.Fields(query) {
+		if len(field) > 4 && strings.EqualFold(field[:4], "tag:") {
+			tags = append(tags, field[4:])
+			continue
+		}
+		terms = append(terms, field)
+	}
+	return strings.Join(terms, " "), parseTags(strings.Join(tags, ","))
+}
+
+type tagCloudEntry struct {
+	Name   string
+	Count  int
+	Weight int
+}
+
+// newTagCloud gives every tag a weight from 1 to 5 relative to the most used
+// tag and sorts them by name.
+func newTagCloud(tags []*models.Tag) []*tagCloudEntry {
+	max := 0
+	for _, tag := range tags {
+		if tag.Count > max {
+			max = tag.Count
+		}
+	}
+
+	cloud := make([]*tagCloudEntry, 0, len(tags))
+	for _, tag := range tags {
+		cloud = append(cloud, &tagCloudEntry{
+			Name:   tag.Name,
+			Count:  tag.Count,
+			Weight: 1 + (tag.Count*4)/max,
+		})
+	}
+
+	sort.Slice(cloud, func(i, j int) bool {
+		return cloud[i].Name < cloud[j].Name
+	})
+	return cloud
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"html/template"
 	"path/filepath"
+	"regexp"
 	"snippetbox.labkita.my.id/internal/models"
+	"strings"
 	"time"
 )
 
@@ -13,16 +16,67 @@ type templateData struct {
 	CurrentYear     int
 	Snippet         *models.Snippet
 	Snippets        []*models.Snippet
+	Popular         []*models.Snippet
+	Starred         bool
+	Comment         *models.Comment
+	Comments        []*models.Comment
+	UserID          int
+	Reports         []*models.Report
+	Actions         []*models.ModerationAction
+	Users           []*models.User
+	Audit           []*models.AuditEvent
+	Sessions        []*accountSession
+	Identities      []*models.Identity
+	Stats           *models.Stats
+	User            *models.User
+	Tag             string
+	TagCloud        []*tagCloudEntry
+	Query           string
+	Pagination      *pagination
 	Form            any
 	Flash           string
 	IsAuthenticated bool
+	IsModerator     bool
+	IsAdmin         bool
+	OIDCEnabled     bool
+	DeletionGrace   time.Duration
 	CSRFToken       string
 }
 
-func newTemplateCache() (map[string]*template.Template, error) { // Initialize a new map to act as the cache.
+const pageSize = 20
+
+type pagination struct {
+	Page    int
+	HasNext bool
+	// BaseURL ends with '?' or '&' so the page parameter can be appended
+	BaseURL string
+}
+
+func (p *pagination) PrevPage() int {
+	return p.Page - 1
+}
+
+func (p *pagination) NextPage() int {
+	return p.Page + 1
+}
+
+func newPagination(page, count int, baseURL string) *pagination {
+	return &pagination{Page: page, HasNext: count > pageSize, BaseURL: baseURL}
+}
+
+// paginate trims the extra row that was fetched to detect a next page.
+func paginate(snippets []*models.Snippet, page int, baseURL string) ([]*models.Snippet, *pagination) {
+	p := newPagination(page, len(snippets), baseURL)
+	if p.HasNext {
+		snippets = snippets[:pageSize]
+	}
+	return snippets, p
+}
+
+func newTemplateCache(dir string) (map[string]*template.Template, error) { // Initialize a new map to act as the cache.
 	cache := map[string]*template.Template{}
 
-	pages, err := filepath.Glob("./ui/html/pages/*.tmpl")
+	pages, err := filepath.Glob(filepath.Join(dir, "pages", "*.tmpl"))
 	if err != nil {
 		return nil, err
 	}
@@ -31,13 +85,13 @@ func newTemplateCache() (map[string]*template.Template, error) { // Initialize a
 		name := filepath.Base(page)
 
 		// Parse the base template file into a template set.
-		ts, err := template.New(name).Funcs(functions).ParseFiles("./ui/html/base.tmpl")
+		ts, err := template.New(name).Funcs(functions).ParseFiles(filepath.Join(dir, "base.tmpl"))
 		if err != nil {
 			return nil, err
 		}
 
 		// Call ParseGlob() *on this template set* to add any partials.
-		ts, err = ts.ParseGlob("./ui/html/partials/*.tmpl")
+		ts, err = ts.ParseGlob(filepath.Join(dir, "partials", "*.tmpl"))
 		if err != nil {
 			return nil, err
 		}
@@ -58,6 +112,94 @@ func humanDate(t time.Time) string {
 	return t.Format("02 Jan 2006 at 15:04")
 }
 
+// codeLines splits snippet content so every line can get an L<n> anchor.
+func codeLines(content string) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	return strings.Split(strings.TrimRight(content, "\n"), "\n")
+}
+
+func add(a, b int) int {
+	return a + b
+}
+
+var lineRefRX = regexp.MustCompile(`\bL([1-9][0-9]{0,5})\b`)
+
+// commentBody escapes a comment and turns references like L12 into links to
+// the matching line of the snippet.
+func commentBody(body string) template.HTML {
+	escaped := template.HTMLEscapeString(body)
+	return template.HTML(lineRefRX.ReplaceAllString(escaped, `<a href="#L$1">L$1</a>`))
+}
+
+// commentView carries what the comment partial needs besides the comment.
+type commentView struct {
+	*models.Comment
+	CanEdit   bool
+	CanDelete bool
+	CSRFToken string
+}
+
+func commentContext(data *templateData, c *models.Comment) commentView {
+	isAuthor := data.UserID != 0 && c.UserID == data.UserID
+	isSnippetOwner := data.Snippet != nil && data.UserID != 0 && data.Snippet.UserID == data.UserID
+	return commentView{
+		Comment:   c,
+		CanEdit:   isAuthor,
+		CanDelete: isAuthor || isSnippetOwner,
+		CSRFToken: data.CSRFToken,
+	}
+}
+
+// deviceName turns a user agent into a short "browser on platform" label.
+func deviceName(userAgent string) string {
+	browser, platform := "Unknown browser", "unknown device"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"},
+		{"Safari/", "Safari"}, {"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, p := range []struct{ token, name string }{
+		{"Android", "Android"}, {"iPhone", "iPhone"}, {"iPad", "iPad"}, {"Windows", "Windows"},
+		{"Mac OS X", "macOS"}, {"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, p.token) {
+			platform = p.name
+			break
+		}
+	}
+	return browser + " on " + platform
+}
+
+// humanDuration formats durations in whole days or hours.
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	}
+	return d.String()
+}
+
+// auditValue formats one side of an audit change, missing values show as a dash.
+func auditValue(v any) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprint(v)
+}
+
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":      humanDate,
+	"codeLines":      codeLines,
+	"commentBody":    commentBody,
+	"add":            add,
+	"commentContext": commentContext,
+	"auditValue":     auditValue,
+	"deviceName":     deviceName,
+	"humanDuration":  humanDuration,
 }
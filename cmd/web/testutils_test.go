@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-playground/form/v4"
+	"html"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"snippetbox.labkita.my.id/internal/logging"
+	"snippetbox.labkita.my.id/internal/models"
+	"snippetbox.labkita.my.id/internal/models/mocks"
+	"testing"
+	"time"
+)
+
+// testMocks are the stores of a test application, setting their Err field
+// breaks the store.
+type testMocks struct {
+	snippets   *mocks.SnippetModel
+	users      *mocks.UserModel
+	tags       *mocks.TagModel
+	stars      *mocks.StarModel
+	comments   *mocks.CommentModel
+	reports    *mocks.ReportModel
+	sessions   *mocks.SessionModel
+	identities *mocks.IdentityModel
+	stats      *mocks.StatsModel
+	auditLog   *mocks.AuditModel
+}
+
+// The users of a test application, they all have the password pa$$word.
+const (
+	aliceID = 1 + iota
+	bobID
+	mollyID
+	adamID
+)
+
+// newTestApplication returns an application on in-memory stores holding the
+// users alice and bob, the moderator molly and the admin adam, and the public
+// snippet 1 of alice.
+func newTestApplication(t *testing.T) (*application, *testMocks) {
+	t.Helper()
+
+	logger, err := logging.New(io.Discard, logging.LevelError, "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	templateCache, err := newTemplateCache("../../ui/html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := mocks.NewUserModel()
+	for _, u := range []struct{ name, username, role string }{
+		{"Bob Smith", "bob", models.RoleUser},
+		{"Molly Moderator", "molly", models.RoleModerator},
+		{"Adam Admin", "adam", models.RoleAdmin},
+	} {
+		id, err := users.Insert(u.name, u.username, u.username+"@example.com", "pa$$word")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = users.SetRole(id, u.role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snippets := mocks.NewSnippetModel()
+	m := &testMocks{
+		snippets:   snippets,
+		users:      users,
+		tags:       mocks.NewTagModel(),
+		stars:      mocks.NewStarModel(snippets),
+		comments:   mocks.NewCommentModel(users),
+		reports:    mocks.NewReportModel(snippets, users),
+		sessions:   mocks.NewSessionModel(),
+		identities: mocks.NewIdentityModel(),
+		stats:      &mocks.StatsModel{},
+		auditLog:   mocks.NewAuditModel(),
+	}
+
+	sessionManager := scs.New()
+	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Cookie.Persist = false
+	sessionManager.Cookie.Secure = true
+	m.sessions.Store = sessionManager.Store.(interface{ Delete(token string) error })
+
+	app := &application{
+		logger:          logger,
+		snippets:        m.snippets,
+		users:           m.users,
+		tags:            m.tags,
+		stars:           m.stars,
+		comments:        m.comments,
+		reports:         m.reports,
+		sessions:        m.sessions,
+		identities:      m.identities,
+		stats:           m.stats,
+		auditLog:        m.auditLog,
+		sessionLifetime: 12 * time.Hour,
+		reauthWindow:    15 * time.Minute,
+		deletionGrace:   14 * 24 * time.Hour,
+		secureCookies:   true,
+		staticDir:       "../../ui/static",
+		templateCache:   templateCache,
+		formDecoder:     form.NewDecoder(),
+		sessionManager:  sessionManager,
+	}
+	return app, m
+}
+
+type testServer struct {
+	*httptest.Server
+}
+
+// newTestServer starts an HTTPS server whose client keeps cookies and doesn't
+// follow redirects.
+func newTestServer(t *testing.T, h http.Handler) *testServer {
+	t.Helper()
+
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar = jar
+	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &testServer{ts}
+}
+
+func (ts *testServer) do(t *testing.T, req *http.Request) (int, http.Header, string) {
+	t.Helper()
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, resp.Header, string(bytes.TrimSpace(body))
+}
+
+func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+urlPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts.do(t, req)
+}
+
+// postForm posts the form, a CSRF token is added unless the form has one.
+func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	t.Helper()
+
+	if form == nil {
+		form = url.Values{}
+	}
+	if _, ok := form["csrf_token"]; !ok {
+		form.Set("csrf_token", ts.csrfToken(t))
+	}
+	return ts.post(t, urlPath, "application/x-www-form-urlencoded", []byte(form.Encode()))
+}
+
+func (ts *testServer) post(t *testing.T, urlPath, contentType string, body []byte) (int, http.Header, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+urlPath, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	return ts.do(t, req)
+}
+
+var csrfTokenRX = regexp.MustCompile(`<input type='hidden' name='csrf_token' value='(.+?)'>`)
+
+// csrfToken reads a CSRF token of the current session from the login page.
+func (ts *testServer) csrfToken(t *testing.T) string {
+	t.Helper()
+
+	_, _, body := ts.get(t, "/user/login")
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no csrf token found in body")
+	}
+	return html.UnescapeString(matches[1])
+}
+
+// login logs in as the user with the given username, the email of every test
+// user is username@example.com.
+func (ts *testServer) login(t *testing.T, username string) {
+	t.Helper()
+
+	form := url.Values{}
+	form.Set("email", username+"@example.com")
+	form.Set("password", "pa$$word")
+	code, header, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther || header.Get("Location") != "/snippets/create" {
+		t.Fatalf("login as %s: got status %d to %q", username, code, header.Get("Location"))
+	}
+}
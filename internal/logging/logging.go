@@ -0,0 +1,171 @@
+// Package logging writes leveled, structured log lines. Every line has a time,
+// a level, a message and key/value pairs, formatted as JSON objects or as
+// key=value text that log pipelines can parse.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int8
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelError
+	LevelFatal
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelError:
+		return "ERROR"
+	case LevelFatal:
+		return "FATAL"
+	}
+	return ""
+}
+
+// ParseLevel accepts debug, info and error.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("logging: unknown level %q", s)
+}
+
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Logger writes the lines of at least its minimum level. It is safe for
+// concurrent use, the loggers returned by With share the output.
+type Logger struct {
+	out      io.Writer
+	minLevel Level
+	json     bool
+	mu       *sync.Mutex
+	fields   []interface{}
+}
+
+// New returns a logger writing format, json or text, to out.
+func New(out io.Writer, minLevel Level, format string) (*Logger, error) {
+	if format != "json" && format != "text" {
+		return nil, fmt.Errorf("logging: unknown format %q", format)
+	}
+	return &Logger{out: out, minLevel: minLevel, json: format == "json", mu: &sync.Mutex{}}, nil
+}
+
+// With returns a logger that adds the key/value pairs to every line.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	c := *l
+	c.fields = append(append([]interface{}{}, l.fields...), keyvals...)
+	return &c
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.print(LevelDebug, msg, keyvals)
+}
+
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.print(LevelInfo, msg, keyvals)
+}
+
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.print(LevelError, msg, keyvals)
+}
+
+// Fatal logs at the fatal level and exits with status 1.
+func (l *Logger) Fatal(msg string, keyvals ...interface{}) {
+	l.print(LevelFatal, msg, keyvals)
+	os.Exit(1)
+}
+
+// Write logs p as an error, so a log.Logger like the ErrorLog of an
+// http.Server can write to the logger.
+func (l *Logger) Write(p []byte) (int, error) {
+	l.print(LevelError, strings.TrimRight(string(p), "\n"), nil)
+	return len(p), nil
+}
+
+func (l *Logger) print(level Level, msg string, keyvals []interface{}) {
+	if level < l.minLevel {
+		return
+	}
+	keyvals = append(append([]interface{}{}, l.fields...), keyvals...)
+	if len(keyvals)%2 != 0 {
+		keyvals = append(keyvals, nil)
+	}
+
+	var line bytes.Buffer
+	now := time.Now().UTC().Format(timeFormat)
+	if l.json {
+		line.WriteString(`{"time":"` + now + `","level":"` + level.String() + `","msg":`)
+		line.Write(jsonValue(msg))
+		for i := 0; i < len(keyvals); i += 2 {
+			line.WriteByte(',')
+			line.Write(jsonValue(fmt.Sprint(keyvals[i])))
+			line.WriteByte(':')
+			line.Write(jsonValue(keyvals[i+1]))
+		}
+		line.WriteString("}\n")
+	} else {
+		line.WriteString("time=" + now + " level=" + level.String() + " msg=" + textValue(msg))
+		for i := 0; i < len(keyvals); i += 2 {
+			line.WriteString(" " + fmt.Sprint(keyvals[i]) + "=" + textValue(stringValue(keyvals[i+1])))
+		}
+		line.WriteByte('\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(line.Bytes())
+}
+
+// stringValue formats errors, durations and other Stringers as text.
+func stringValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+func jsonValue(v interface{}) []byte {
+	switch v.(type) {
+	case error, fmt.Stringer:
+		v = stringValue(v)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return b
+}
+
+// textValue quotes values that would otherwise be ambiguous.
+func textValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=\\") {
+		return strconv.Quote(s)
+	}
+	return s
+}
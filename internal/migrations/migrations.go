@@ -0,0 +1,423 @@
+// Package migrations keeps the database schema in versioned up and down
+// migrations that are built into the binary. Every driver has its own
+// directory of files named like 0001_create_snippets.up.sql, the versions are
+// the same for all drivers. Applied versions are recorded in the
+// schema_migrations table.
+//
+// MySQL databases set up by hand from the db.sql, user.sql and session.sql
+// scripts of earlier releases are upgraded by migrate up as well. A
+// migration named create_<table> may come with a .baseline.sql script, which
+// runs instead of its up script when the table already exists and brings it
+// to the schema of the migration without losing its rows. Back up the
+// database first, MySQL can't roll back a failed upgrade. The sample
+// snippets inserted by db.sql are kept, delete them by hand if they are
+// unwanted.
+//
+// The MySQL database itself has to exist before migrating, create it with:
+// CREATE DATABASE snippetbox CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+var ErrUnknownVersion = errors.New("migrations: unknown version")
+
+// Migration is one version of the schema.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+	// Baseline upgrades the table of a create_<table> migration when it
+	// already exists, it is empty when there is nothing to upgrade.
+	Baseline string
+}
+
+// Status tells whether a migration has been applied, and when.
+type Status struct {
+	*Migration
+	Applied *time.Time
+}
+
+// dialect holds the statements that differ between the drivers.
+type dialect struct {
+	createTable string
+	insert      string
+	remove      string
+	applied     string
+	lock        string
+	unlock      string
+	// tableExists counts the tables with the given name, it is only set for
+	// the drivers that have baseline scripts
+	tableExists string
+	// the MySQL driver runs a single statement per Exec unless the DSN has
+	// multiStatements=true, so its migrations are split
+	split bool
+}
+
+var dialects = map[string]dialect{
+	"mysql": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied DATETIME NOT NULL)`,
+		insert:      `INSERT INTO schema_migrations (version, name, applied) VALUES(?, ?, UTC_TIMESTAMP())`,
+		remove:      `DELETE FROM schema_migrations WHERE version = ?`,
+		applied:     `SELECT COUNT(*) FROM schema_migrations WHERE version = ?`,
+		lock:        `SELECT GET_LOCK('snippetbox_migrations', 300)`,
+		unlock:      `SELECT RELEASE_LOCK('snippetbox_migrations')`,
+		tableExists: `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?`,
+		split:       true,
+	},
+	"postgres": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied TIMESTAMP NOT NULL)`,
+		insert:      `INSERT INTO schema_migrations (version, name, applied) VALUES($1, $2, now() AT TIME ZONE 'UTC')`,
+		remove:      `DELETE FROM schema_migrations WHERE version = $1`,
+		applied:     `SELECT COUNT(*) FROM schema_migrations WHERE version = $1`,
+		lock:        `SELECT true FROM pg_advisory_lock(7160411)`,
+		unlock:      `SELECT pg_advisory_unlock(7160411)`,
+	},
+	// SQLite has no advisory locks, concurrent writers are serialized by the
+	// database lock and every migration checks again whether it is still due
+	// once its transaction has started
+	"sqlite": {
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied DATETIME NOT NULL)`,
+		insert:      `INSERT INTO schema_migrations (version, name, applied) VALUES(?, ?, datetime('now'))`,
+		remove:      `DELETE FROM schema_migrations WHERE version = ?`,
+		applied:     `SELECT COUNT(*) FROM schema_migrations WHERE version = ?`,
+	},
+}
+
+// Migrator applies the migrations of one driver to a database.
+type Migrator struct {
+	DB     *sql.DB
+	Driver string
+	// Log is called with a line for every applied migration when set.
+	Log func(format string, args ...interface{})
+}
+
+func (m *Migrator) dialect() (dialect, error) {
+	d, ok := dialects[m.Driver]
+	if !ok {
+		return d, fmt.Errorf("migrations: unknown driver %q", m.Driver)
+	}
+	return d, nil
+}
+
+// Migrations returns the migrations of the driver ordered by version.
+func (m *Migrator) Migrations() ([]*Migration, error) {
+	names, err := fs.Glob(files, m.Driver+"/*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("migrations: unknown driver %q", m.Driver)
+	}
+
+	migrations := []*Migration{}
+	for _, name := range names {
+		base := strings.TrimSuffix(path.Base(name), ".up.sql")
+		i := strings.IndexByte(base, '_')
+		if i < 0 {
+			return nil, fmt.Errorf("migrations: %s doesn't start with a version", name)
+		}
+		version, err := strconv.Atoi(base[:i])
+		if err != nil {
+			return nil, fmt.Errorf("migrations: %s doesn't start with a version", name)
+		}
+		up, err := files.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		down, err := files.ReadFile(strings.TrimSuffix(name, ".up.sql") + ".down.sql")
+		if err != nil {
+			return nil, err
+		}
+		baseline, err := files.ReadFile(strings.TrimSuffix(name, ".up.sql") + ".baseline.sql")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		migrations = append(migrations, &Migration{Version: version, Name: base[i+1:], Up: string(up), Down: string(down), Baseline: string(baseline)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest returns the version this build of the application needs.
+func (m *Migrator) Latest() (int, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return 0, err
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// Version returns the highest applied version, 0 for an empty database.
+func (m *Migrator) Version() (int, error) {
+	d, err := m.dialect()
+	if err != nil {
+		return 0, err
+	}
+	if _, err = m.DB.Exec(d.createTable); err != nil {
+		return 0, err
+	}
+	var version int
+	err = m.DB.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// Status returns every migration with the time it was applied.
+func (m *Migrator) Status() ([]*Status, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = m.Version(); err != nil {
+		return nil, err
+	}
+
+	applied := map[int]time.Time{}
+	rows, err := m.DB.Query(`SELECT version, applied FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err = rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := []*Status{}
+	for _, migration := range migrations {
+		s := &Status{Migration: migration}
+		if at, ok := applied[migration.Version]; ok {
+			s.Applied = &at
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up() error {
+	latest, err := m.Latest()
+	if err != nil {
+		return err
+	}
+	return m.Goto(latest)
+}
+
+// Down reverts the given number of applied migrations, newest first.
+func (m *Migrator) Down(steps int) error {
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+	target := 0
+	for i := len(statuses) - 1; i >= 0; i-- {
+		if statuses[i].Applied == nil {
+			continue
+		}
+		if steps == 0 {
+			target = statuses[i].Version
+			break
+		}
+		steps--
+	}
+	return m.Goto(target)
+}
+
+// Goto migrates up or down until version is the latest applied migration,
+// version 0 reverts everything.
+func (m *Migrator) Goto(version int) error {
+	return m.locked(func(conn *sql.Conn) error {
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		if version != 0 && !hasVersion(statuses, version) {
+			return fmt.Errorf("%w %d", ErrUnknownVersion, version)
+		}
+
+		for _, s := range statuses {
+			if s.Version <= version && s.Applied == nil {
+				if err = m.apply(conn, s.Migration, true); err != nil {
+					return err
+				}
+			}
+		}
+		for i := len(statuses) - 1; i >= 0; i-- {
+			if s := statuses[i]; s.Version > version && s.Applied != nil {
+				if err = m.apply(conn, s.Migration, false); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Force records version as the latest applied migration without running any
+// SQL. It is meant for databases whose schema was created by hand, or left
+// half migrated by a failed MySQL migration whose DDL can't be rolled back.
+func (m *Migrator) Force(version int) error {
+	d, err := m.dialect()
+	if err != nil {
+		return err
+	}
+	return m.locked(func(conn *sql.Conn) error {
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		if version != 0 && !hasVersion(statuses, version) {
+			return fmt.Errorf("%w %d", ErrUnknownVersion, version)
+		}
+		for _, s := range statuses {
+			switch {
+			case s.Version <= version && s.Applied == nil:
+				_, err = conn.ExecContext(context.Background(), d.insert, s.Version, s.Name)
+			case s.Version > version && s.Applied != nil:
+				_, err = conn.ExecContext(context.Background(), d.remove, s.Version)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// locked runs fn while holding the advisory lock of the driver, so instances
+// that start at the same time don't migrate concurrently.
+func (m *Migrator) locked(fn func(conn *sql.Conn) error) error {
+	d, err := m.dialect()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	// advisory locks belong to a connection, so everything runs on one
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if d.lock != "" {
+		var ok sql.NullBool
+		if err = conn.QueryRowContext(ctx, d.lock).Scan(&ok); err != nil {
+			return err
+		}
+		if !ok.Bool {
+			return errors.New("migrations: timed out waiting for the migration lock")
+		}
+		defer conn.ExecContext(ctx, d.unlock)
+	}
+	return fn(conn)
+}
+
+// apply runs a migration in a transaction, MySQL commits DDL statements
+// implicitly so its migrations aren't atomic.
+func (m *Migrator) apply(conn *sql.Conn, migration *Migration, up bool) error {
+	d, err := m.dialect()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// another instance may have got there first
+	var n int
+	err = tx.QueryRow(d.applied, migration.Version).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if (n > 0) == up {
+		return nil
+	}
+
+	script, record, args := migration.Down, d.remove, []interface{}{migration.Version}
+	if up {
+		script, record, args = migration.Up, d.insert, []interface{}{migration.Version, migration.Name}
+	}
+	baseline := false
+	if up && migration.Baseline != "" && d.tableExists != "" {
+		table := strings.TrimPrefix(migration.Name, "create_")
+		if err = tx.QueryRow(d.tableExists, table).Scan(&n); err != nil {
+			return err
+		}
+		if baseline = n > 0; baseline {
+			script = migration.Baseline
+		}
+	}
+	statements := []string{script}
+	if d.split {
+		statements = splitStatements(script)
+	}
+	for _, stmt := range statements {
+		if _, err = tx.Exec(stmt); err != nil {
+			return fmt.Errorf("migrations: %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+	if _, err = tx.Exec(record, args...); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	if m.Log != nil {
+		direction := "down"
+		if up {
+			direction = "up"
+		}
+		if baseline {
+			direction = "up the existing table of"
+		}
+		m.Log("migrated %s %04d_%s", direction, migration.Version, migration.Name)
+	}
+	return nil
+}
+
+// splitStatements splits a script on the semicolons that end a line, the
+// MySQL migrations don't use semicolons anywhere else.
+func splitStatements(script string) []string {
+	statements := []string{}
+	for _, stmt := range strings.Split(script, ";\n") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements
+}
+
+func hasVersion(statuses []*Status, version int) bool {
+	for _, s := range statuses {
+		if s.Version == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBaselineScripts(t *testing.T) {
+	for _, driver := range []string{"mysql", "postgres", "sqlite"} {
+		m := &Migrator{Driver: driver}
+		migrations, err := m.Migrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, migration := range migrations {
+			if migration.Baseline == "" {
+				continue
+			}
+			if dialects[driver].tableExists == "" {
+				t.Errorf("%s %04d_%s: baseline script for a driver without tableExists", driver, migration.Version, migration.Name)
+			}
+			if !strings.HasPrefix(migration.Name, "create_") {
+				t.Errorf("%s %04d_%s: baseline script for a migration that doesn't create a table", driver, migration.Version, migration.Name)
+			}
+			if len(splitStatements(migration.Baseline)) == 0 {
+				t.Errorf("%s %04d_%s: empty baseline script", driver, migration.Version, migration.Name)
+			}
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := "-- a comment\nCREATE TABLE a\n(\n    id INTEGER\n);\nCREATE INDEX idx_a ON a (id);\n\n"
+	want := []string{"-- a comment\nCREATE TABLE a\n(\n    id INTEGER\n)", "CREATE INDEX idx_a ON a (id)"}
+
+	got := splitStatements(script)
+	if len(got) != len(want) {
+		t.Fatalf("got %d statements; want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("statement %d: got %q; want %q", i, got[i], want[i])
+		}
+	}
+}
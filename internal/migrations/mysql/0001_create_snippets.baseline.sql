@@ -0,0 +1,13 @@
+-- Upgrade the `snippets` table created by db.sql, its snippets stay without
+-- an owner.
+ALTER TABLE snippets
+    ADD COLUMN user_id        INTEGER     NULL AFTER id,
+    ADD COLUMN language       VARCHAR(30) NOT NULL DEFAULT '' AFTER content,
+    ADD COLUMN visibility     VARCHAR(10) NOT NULL DEFAULT 'public' AFTER language,
+    ADD COLUMN forked_from_id INTEGER     NULL AFTER visibility,
+    ADD COLUMN hidden         BOOLEAN     NOT NULL DEFAULT FALSE AFTER forked_from_id,
+    ADD FOREIGN KEY (forked_from_id) REFERENCES snippets (id) ON DELETE SET NULL;
+-- Add an index for the profile and dashboard listings.
+CREATE INDEX idx_snippets_user ON snippets (user_id, id);
+-- Add an index for counting forks.
+CREATE INDEX idx_snippets_forked_from ON snippets (forked_from_id);
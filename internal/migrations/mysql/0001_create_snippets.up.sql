@@ -0,0 +1,21 @@
+-- Create a `snippets` table.
+CREATE TABLE snippets
+(
+    id             INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id        INTEGER      NULL,
+    title          VARCHAR(100) NOT NULL,
+    content        TEXT         NOT NULL,
+    language       VARCHAR(30)  NOT NULL DEFAULT '',
+    visibility     VARCHAR(10)  NOT NULL DEFAULT 'public',
+    forked_from_id INTEGER      NULL,
+    hidden         BOOLEAN      NOT NULL DEFAULT FALSE,
+    created        DATETIME     NOT NULL,
+    expires        DATETIME     NOT NULL,
+    FOREIGN KEY (forked_from_id) REFERENCES snippets (id) ON DELETE SET NULL
+);
+-- Add an index on the created column.
+CREATE INDEX idx_snippets_created ON snippets (created);
+-- Add an index for the profile and dashboard listings.
+CREATE INDEX idx_snippets_user ON snippets (user_id, id);
+-- Add an index for counting forks.
+CREATE INDEX idx_snippets_forked_from ON snippets (forked_from_id);
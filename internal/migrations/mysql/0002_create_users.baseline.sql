@@ -0,0 +1,33 @@
+-- Upgrade the `users` table created by user.sql. Existing users get the
+-- username user<id>, which they can't have picked themselves as usernames
+-- didn't exist before.
+ALTER TABLE users
+    ADD COLUMN username      VARCHAR(30) NULL AFTER name,
+    MODIFY hashed_password   VARCHAR(255) NOT NULL,
+    ADD COLUMN role          VARCHAR(10) NOT NULL DEFAULT 'user' AFTER hashed_password,
+    ADD COLUMN suspended     BOOLEAN     NOT NULL DEFAULT FALSE AFTER role,
+    ADD COLUMN delete_at     DATETIME    NULL AFTER created,
+    ADD COLUMN delete_policy VARCHAR(10) NOT NULL DEFAULT '' AFTER delete_at;
+UPDATE users
+SET username = CONCAT('user', id);
+ALTER TABLE users
+    MODIFY username VARCHAR(30) NOT NULL;
+ALTER TABLE users
+    ADD CONSTRAINT users_uc_username UNIQUE (username);
+
+-- snippets are owned by the user who created them
+ALTER TABLE snippets
+    ADD CONSTRAINT snippets_fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
+
+-- identities of external OpenID Connect providers linked to a user
+CREATE TABLE user_identities
+(
+    id      INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER      NOT NULL,
+    issuer  VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email   VARCHAR(255) NOT NULL DEFAULT '',
+    created DATETIME     NOT NULL,
+    CONSTRAINT user_identities_uc_subject UNIQUE (issuer, subject),
+    CONSTRAINT user_identities_fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
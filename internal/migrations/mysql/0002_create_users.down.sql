@@ -0,0 +1,4 @@
+ALTER TABLE snippets
+    DROP FOREIGN KEY snippets_fk_user;
+DROP TABLE user_identities;
+DROP TABLE users;
@@ -0,0 +1,36 @@
+CREATE TABLE users
+(
+    id              INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name            VARCHAR(255) NOT NULL,
+    username        VARCHAR(30)  NOT NULL,
+    email           VARCHAR(255) NOT NULL,
+    hashed_password VARCHAR(255) NOT NULL,
+    role            VARCHAR(10)  NOT NULL DEFAULT 'user',
+    suspended       BOOLEAN      NOT NULL DEFAULT FALSE,
+    created         DATETIME     NOT NULL,
+    -- set while the account waits for its deletion
+    delete_at       DATETIME     NULL,
+    delete_policy   VARCHAR(10)  NOT NULL DEFAULT ''
+);
+-- hashed_password holds bcrypt hashes and argon2id PHC strings
+ALTER TABLE users
+    ADD CONSTRAINT users_uc_email UNIQUE (email);
+ALTER TABLE users
+    ADD CONSTRAINT users_uc_username UNIQUE (username);
+
+-- snippets are owned by the user who created them
+ALTER TABLE snippets
+    ADD CONSTRAINT snippets_fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
+
+-- identities of external OpenID Connect providers linked to a user
+CREATE TABLE user_identities
+(
+    id      INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER      NOT NULL,
+    issuer  VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email   VARCHAR(255) NOT NULL DEFAULT '',
+    created DATETIME     NOT NULL,
+    CONSTRAINT user_identities_uc_subject UNIQUE (issuer, subject),
+    CONSTRAINT user_identities_fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,16 @@
+-- The `sessions` table created by session.sql is unchanged, only the
+-- user_sessions table is new. Sessions started before the upgrade have no
+-- user_sessions row, so their users are logged out and log in again.
+CREATE TABLE user_sessions
+(
+    id         INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    token      CHAR(43)     NOT NULL,
+    user_id    INTEGER      NOT NULL,
+    ip         VARCHAR(45)  NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    created    DATETIME     NOT NULL,
+    last_seen  DATETIME     NOT NULL,
+    CONSTRAINT user_sessions_uc_token UNIQUE (token),
+    CONSTRAINT user_sessions_fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_user_sessions_user ON user_sessions (user_id, last_seen);
@@ -0,0 +1,22 @@
+CREATE TABLE sessions
+(
+    token  CHAR(43) PRIMARY KEY,
+    data   BLOB         NOT NULL,
+    expiry TIMESTAMP(6) NOT NULL
+);
+CREATE INDEX sessions_expiry_idx ON sessions (expiry);
+-- user_sessions maps the opaque scs tokens to users so sessions can be listed
+-- and revoked, rows are removed together with the session they belong to
+CREATE TABLE user_sessions
+(
+    id         INTEGER      NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    token      CHAR(43)     NOT NULL,
+    user_id    INTEGER      NOT NULL,
+    ip         VARCHAR(45)  NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    created    DATETIME     NOT NULL,
+    last_seen  DATETIME     NOT NULL,
+    CONSTRAINT user_sessions_uc_token UNIQUE (token),
+    CONSTRAINT user_sessions_fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_user_sessions_user ON user_sessions (user_id, last_seen);
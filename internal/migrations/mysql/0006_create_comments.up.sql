@@ -0,0 +1,15 @@
+-- comments of deleted accounts stay without an author so replies keep their thread
+CREATE TABLE comments
+(
+    id         INTEGER  NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER  NOT NULL,
+    user_id    INTEGER  NULL,
+    parent_id  INTEGER  NULL,
+    body       TEXT     NOT NULL,
+    created    DATETIME NOT NULL,
+    updated    DATETIME NOT NULL,
+    FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL,
+    FOREIGN KEY (parent_id) REFERENCES comments (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_comments_snippet ON comments (snippet_id, created);
@@ -0,0 +1,28 @@
+-- audit_events is append-only, actor_id has no foreign key so the history
+-- outlives deleted accounts
+CREATE TABLE audit_events
+(
+    id             BIGINT       NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    created        DATETIME(6)  NOT NULL,
+    actor_id       INTEGER      NULL,
+    actor_username VARCHAR(30)  NOT NULL DEFAULT '',
+    action         VARCHAR(40)  NOT NULL,
+    target_type    VARCHAR(20)  NOT NULL DEFAULT '',
+    target_id      INTEGER      NULL,
+    ip             VARCHAR(45)  NOT NULL,
+    user_agent     VARCHAR(255) NOT NULL,
+    details        VARCHAR(500) NOT NULL DEFAULT '',
+    changes        JSON         NULL
+);
+CREATE INDEX idx_audit_events_created ON audit_events (created);
+CREATE INDEX idx_audit_events_actor ON audit_events (actor_id, created);
+CREATE INDEX idx_audit_events_action ON audit_events (action, created);
+
+CREATE TRIGGER audit_events_no_update
+    BEFORE UPDATE
+    ON audit_events
+    FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_events is append-only';
+CREATE TRIGGER audit_events_no_delete
+    BEFORE DELETE
+    ON audit_events
+    FOR EACH ROW SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_events is append-only';
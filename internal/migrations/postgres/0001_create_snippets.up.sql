@@ -0,0 +1,17 @@
+CREATE TABLE snippets
+(
+    id             SERIAL       NOT NULL PRIMARY KEY,
+    user_id        INTEGER      NULL,
+    title          VARCHAR(100) NOT NULL,
+    content        TEXT         NOT NULL,
+    language       VARCHAR(30)  NOT NULL DEFAULT '',
+    visibility     VARCHAR(10)  NOT NULL DEFAULT 'public',
+    forked_from_id INTEGER      NULL,
+    hidden         BOOLEAN      NOT NULL DEFAULT FALSE,
+    created        TIMESTAMP    NOT NULL,
+    expires        TIMESTAMP    NOT NULL,
+    FOREIGN KEY (forked_from_id) REFERENCES snippets (id) ON DELETE SET NULL
+);
+CREATE INDEX idx_snippets_created ON snippets (created);
+CREATE INDEX idx_snippets_user ON snippets (user_id, id);
+CREATE INDEX idx_snippets_forked_from ON snippets (forked_from_id);
@@ -0,0 +1,4 @@
+ALTER TABLE snippets
+    DROP CONSTRAINT snippets_fk_user;
+DROP TABLE user_identities;
+DROP TABLE users;
@@ -0,0 +1,31 @@
+CREATE TABLE users
+(
+    id              SERIAL       NOT NULL PRIMARY KEY,
+    name            VARCHAR(255) NOT NULL,
+    username        VARCHAR(30)  NOT NULL,
+    email           VARCHAR(255) NOT NULL,
+    hashed_password VARCHAR(255) NOT NULL,
+    role            VARCHAR(10)  NOT NULL DEFAULT 'user',
+    suspended       BOOLEAN      NOT NULL DEFAULT FALSE,
+    created         TIMESTAMP    NOT NULL,
+    delete_at       TIMESTAMP    NULL,
+    delete_policy   VARCHAR(10)  NOT NULL DEFAULT '',
+    CONSTRAINT users_uc_email UNIQUE (email),
+    CONSTRAINT users_uc_username UNIQUE (username)
+);
+
+CREATE TABLE user_identities
+(
+    id      SERIAL       NOT NULL PRIMARY KEY,
+    user_id INTEGER      NOT NULL,
+    issuer  VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email   VARCHAR(255) NOT NULL DEFAULT '',
+    created TIMESTAMP    NOT NULL,
+    CONSTRAINT user_identities_uc_subject UNIQUE (issuer, subject),
+    CONSTRAINT user_identities_fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- snippets are owned by the user who created them
+ALTER TABLE snippets
+    ADD CONSTRAINT snippets_fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
@@ -0,0 +1,21 @@
+CREATE TABLE sessions
+(
+    token  TEXT PRIMARY KEY,
+    data   BYTEA       NOT NULL,
+    expiry TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX sessions_expiry_idx ON sessions (expiry);
+
+CREATE TABLE user_sessions
+(
+    id         SERIAL       NOT NULL PRIMARY KEY,
+    token      CHAR(43)     NOT NULL,
+    user_id    INTEGER      NOT NULL,
+    ip         VARCHAR(45)  NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    created    TIMESTAMP    NOT NULL,
+    last_seen  TIMESTAMP    NOT NULL,
+    CONSTRAINT user_sessions_uc_token UNIQUE (token),
+    CONSTRAINT user_sessions_fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_user_sessions_user ON user_sessions (user_id, last_seen);
@@ -0,0 +1,29 @@
+CREATE TABLE audit_events
+(
+    id             BIGSERIAL    NOT NULL PRIMARY KEY,
+    created        TIMESTAMP    NOT NULL,
+    actor_id       INTEGER      NULL,
+    actor_username VARCHAR(30)  NOT NULL DEFAULT '',
+    action         VARCHAR(40)  NOT NULL,
+    target_type    VARCHAR(20)  NOT NULL DEFAULT '',
+    target_id      INTEGER      NULL,
+    ip             VARCHAR(45)  NOT NULL,
+    user_agent     VARCHAR(255) NOT NULL,
+    details        VARCHAR(500) NOT NULL DEFAULT '',
+    changes        JSONB        NULL
+);
+CREATE INDEX idx_audit_events_created ON audit_events (created);
+CREATE INDEX idx_audit_events_actor ON audit_events (actor_id, created);
+CREATE INDEX idx_audit_events_action ON audit_events (action, created);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+CREATE TRIGGER audit_events_no_update
+    BEFORE UPDATE OR DELETE
+    ON audit_events
+    FOR EACH ROW
+EXECUTE FUNCTION audit_events_append_only();
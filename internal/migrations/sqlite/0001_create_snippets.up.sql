@@ -0,0 +1,18 @@
+CREATE TABLE snippets
+(
+    id             INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id        INTEGER      NULL,
+    title          VARCHAR(100) NOT NULL,
+    content        TEXT         NOT NULL,
+    language       VARCHAR(30)  NOT NULL DEFAULT '',
+    visibility     VARCHAR(10)  NOT NULL DEFAULT 'public',
+    forked_from_id INTEGER      NULL,
+    hidden         BOOLEAN      NOT NULL DEFAULT FALSE,
+    created        DATETIME     NOT NULL,
+    expires        DATETIME     NOT NULL,
+    CONSTRAINT snippets_fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL,
+    FOREIGN KEY (forked_from_id) REFERENCES snippets (id) ON DELETE SET NULL
+);
+CREATE INDEX idx_snippets_created ON snippets (created);
+CREATE INDEX idx_snippets_user ON snippets (user_id, id);
+CREATE INDEX idx_snippets_forked_from ON snippets (forked_from_id);
@@ -0,0 +1,11 @@
+CREATE TABLE stars
+(
+    user_id    INTEGER   NOT NULL,
+    snippet_id INTEGER   NOT NULL,
+    created    DATETIME  NOT NULL,
+    PRIMARY KEY (user_id, snippet_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE CASCADE
+);
+CREATE INDEX idx_stars_created ON stars (created, snippet_id);
+CREATE INDEX idx_stars_snippet ON stars (snippet_id);
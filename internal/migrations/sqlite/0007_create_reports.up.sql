@@ -0,0 +1,28 @@
+CREATE TABLE reports
+(
+    id          INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    snippet_id  INTEGER      NULL,
+    reporter_id INTEGER      NULL,
+    reason      VARCHAR(20)  NOT NULL,
+    details     VARCHAR(500) NOT NULL,
+    status      VARCHAR(10)  NOT NULL DEFAULT 'open',
+    created     DATETIME     NOT NULL,
+    resolved_by INTEGER      NULL,
+    resolved_at DATETIME     NULL,
+    FOREIGN KEY (snippet_id) REFERENCES snippets (id) ON DELETE SET NULL,
+    FOREIGN KEY (reporter_id) REFERENCES users (id) ON DELETE SET NULL,
+    FOREIGN KEY (resolved_by) REFERENCES users (id) ON DELETE SET NULL
+);
+CREATE INDEX idx_reports_status ON reports (status, created);
+
+CREATE TABLE moderation_actions
+(
+    id             INTEGER     NOT NULL PRIMARY KEY AUTOINCREMENT,
+    report_id      INTEGER     NOT NULL,
+    snippet_id     INTEGER     NULL,
+    target_user_id INTEGER     NULL,
+    admin_id       INTEGER     NOT NULL,
+    action         VARCHAR(10) NOT NULL,
+    created        DATETIME    NOT NULL
+);
+CREATE INDEX idx_moderation_actions_created ON moderation_actions (created);
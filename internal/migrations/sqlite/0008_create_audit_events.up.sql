@@ -0,0 +1,30 @@
+CREATE TABLE audit_events
+(
+    id             INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    created        DATETIME     NOT NULL,
+    actor_id       INTEGER      NULL,
+    actor_username VARCHAR(30)  NOT NULL DEFAULT '',
+    action         VARCHAR(40)  NOT NULL,
+    target_type    VARCHAR(20)  NOT NULL DEFAULT '',
+    target_id      INTEGER      NULL,
+    ip             VARCHAR(45)  NOT NULL,
+    user_agent     VARCHAR(255) NOT NULL,
+    details        VARCHAR(500) NOT NULL DEFAULT '',
+    changes        TEXT         NULL
+);
+CREATE INDEX idx_audit_events_created ON audit_events (created);
+CREATE INDEX idx_audit_events_actor ON audit_events (actor_id, created);
+CREATE INDEX idx_audit_events_action ON audit_events (action, created);
+
+CREATE TRIGGER audit_events_no_update
+    BEFORE UPDATE
+    ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+CREATE TRIGGER audit_events_no_delete
+    BEFORE DELETE
+    ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
@@ -0,0 +1,216 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	AuditSignup              = "user.signup"
+	AuditLogin               = "user.login"
+	AuditLoginFailed         = "user.login_failed"
+	AuditLogout              = "user.logout"
+	AuditUserSuspend         = "user.suspend"
+	AuditUserUnsuspend       = "user.unsuspend"
+	AuditUserLogout          = "user.force_logout"
+	AuditUserRole            = "user.role"
+	AuditReauthFailed        = "user.reauth_failed"
+	AuditPasswordChange      = "user.password_change"
+	AuditIdentityLink        = "user.identity_link"
+	AuditDeleteRequest       = "user.delete_request"
+	AuditDeleteCancel        = "user.delete_cancel"
+	AuditDelete              = "user.delete"
+	AuditDataExport          = "user.data_export"
+	AuditSessionRevoke       = "session.revoke"
+	AuditSessionRevokeOthers = "session.revoke_others"
+	AuditSnippetCreate       = "snippet.create"
+	AuditSnippetImport       = "snippet.import"
+	AuditSnippetFork         = "snippet.fork"
+	AuditSnippetReport       = "snippet.report"
+	AuditSnippetHide         = "snippet.hide"
+	AuditSnippetUnhide       = "snippet.unhide"
+	AuditSnippetDelete       = "snippet.delete"
+	AuditSessionPurge        = "session.purge"
+	AuditCommentEdit         = "comment.edit"
+	AuditCommentDelete       = "comment.delete"
+	AuditReportResolve       = "report.resolve"
+)
+
+const (
+	auditMaxUserAgent   = 255
+	auditMaxDetailsSize = 500
+)
+
+// AuditChange is the value of a field before and after an action.
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+type AuditEvent struct {
+	ID            int64                  `json:"id"`
+	Created       time.Time              `json:"created"`
+	ActorID       int                    `json:"actor_id,omitempty"`
+	ActorUsername string                 `json:"actor_username,omitempty"`
+	Action        string                 `json:"action"`
+	TargetType    string                 `json:"target_type,omitempty"`
+	TargetID      int                    `json:"target_id,omitempty"`
+	IP            string                 `json:"ip"`
+	UserAgent     string                 `json:"user_agent"`
+	Details       string                 `json:"details,omitempty"`
+	Changes       map[string]AuditChange `json:"changes,omitempty"`
+}
+
+// AuditFilter narrows down a query, empty fields match everything.
+type AuditFilter struct {
+	ActorID       int
+	Action        string
+	ActorUsername string
+	TargetType    string
+	TargetID      int
+	IP            string
+	Since         time.Time
+	Until         time.Time
+}
+
+type AuditModel struct {
+	DB      *sql.DB
+	Dialect *Dialect
+}
+
+// Insert appends an event, the table has no update or delete counterpart.
+func (m *AuditModel) Insert(e *AuditEvent) error {
+	var changes interface{}
+	if len(e.Changes) > 0 {
+		js, err := json.Marshal(e.Changes)
+		if err != nil {
+			return err
+		}
+		changes = string(js)
+	}
+
+	stmt := `INSERT INTO audit_events (created, actor_id, actor_username, action, target_type, target_id, ip, user_agent, details, changes)
+	VALUES({nowPrecise}, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := m.DB.Exec(m.Dialect.rebind(stmt), nullInt(e.ActorID), e.ActorUsername, e.Action, e.TargetType, nullInt(e.TargetID),
+		e.IP, truncate(e.UserAgent, auditMaxUserAgent), truncate(e.Details, auditMaxDetailsSize), changes)
+	return err
+}
+
+// List returns the matching events, newest first.
+func (m *AuditModel) List(filter AuditFilter, limit, offset int) ([]*AuditEvent, error) {
+	where, args := filter.where(m.Dialect)
+	stmt := `SELECT ` + auditColumns + where + ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Each calls fn for every matching event in the order they happened without
+// loading them all into memory, it is used for exports.
+func (m *AuditModel) Each(filter AuditFilter, fn func(*AuditEvent) error) error {
+	where, args := filter.where(m.Dialect)
+	stmt := `SELECT ` + auditColumns + where + ` ORDER BY id`
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+const auditColumns = `id, created, COALESCE(actor_id, 0), actor_username, action, target_type, COALESCE(target_id, 0), ip, user_agent, details, changes FROM audit_events`
+
+func (f AuditFilter) where(d *Dialect) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	if f.ActorID != 0 {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, f.ActorID)
+	}
+	if f.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.ActorUsername != "" {
+		conditions = append(conditions, "actor_username = ?")
+		args = append(args, f.ActorUsername)
+	}
+	if f.TargetType != "" {
+		conditions = append(conditions, "target_type = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != 0 {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if f.IP != "" {
+		conditions = append(conditions, "ip = ?")
+		args = append(args, f.IP)
+	}
+	if !f.Since.IsZero() {
+		conditions = append(conditions, "created >= ?")
+		args = append(args, d.time(f.Since))
+	}
+	if !f.Until.IsZero() {
+		conditions = append(conditions, "created < ?")
+		args = append(args, d.time(f.Until))
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func scanAuditEvent(rows *sql.Rows) (*AuditEvent, error) {
+	e := &AuditEvent{}
+	var changes []byte
+	err := rows.Scan(&e.ID, &e.Created, &e.ActorID, &e.ActorUsername, &e.Action, &e.TargetType, &e.TargetID, &e.IP, &e.UserAgent, &e.Details, &changes)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 {
+		if err = json.Unmarshal(changes, &e.Changes); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	// don't cut a multi-byte character in half
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
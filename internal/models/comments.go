@@ -0,0 +1,124 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// DeletedCommentBody replaces the body of the comments of a deleted account.
+const DeletedCommentBody = "[deleted]"
+
+// Comment is a comment on a snippet, those of deleted accounts have no UserID
+// or Username.
+type Comment struct {
+	ID        int
+	SnippetID int
+	UserID    int
+	Username  string
+	ParentID  int
+	Body      string
+	Created   time.Time
+	Updated   time.Time
+	Replies   []*Comment
+}
+
+func (c *Comment) IsEdited() bool {
+	return c.Updated.After(c.Created)
+}
+
+type CommentModel struct {
+	DB      *sql.DB
+	Dialect *Dialect
+}
+
+const commentColumns = `c.id, c.snippet_id, COALESCE(c.user_id, 0), COALESCE(u.username, ''), COALESCE(c.parent_id, 0), c.body, c.created, c.updated
+	FROM comments c LEFT JOIN users u ON u.id = c.user_id`
+
+func (m *CommentModel) Insert(snippetID, userID, parentID int, body string) (int, error) {
+	stmt := `INSERT INTO comments (snippet_id, user_id, parent_id, body, created, updated) VALUES(?, ?, ?, ?, {now}, {now})`
+	return m.Dialect.insert(m.DB, stmt, snippetID, userID, nullInt(parentID), body)
+}
+
+func (m *CommentModel) Get(id int) (*Comment, error) {
+	stmt := `SELECT ` + commentColumns + ` WHERE c.id = ?`
+	c := &Comment{}
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), id).Scan(&c.ID, &c.SnippetID, &c.UserID, &c.Username, &c.ParentID, &c.Body, &c.Created, &c.Updated)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (m *CommentModel) Update(id int, body string) error {
+	stmt := `UPDATE comments SET body = ?, updated = {now} WHERE id = ?`
+	_, err := m.DB.Exec(m.Dialect.rebind(stmt), body, id)
+	return err
+}
+
+// Delete removes the comment together with its replies.
+func (m *CommentModel) Delete(id int) error {
+	stmt := `DELETE FROM comments WHERE id = ?`
+	_, err := m.DB.Exec(m.Dialect.rebind(stmt), id)
+	return err
+}
+
+// ByUser returns every comment the user wrote, oldest first.
+func (m *CommentModel) ByUser(userID int) ([]*Comment, error) {
+	stmt := `SELECT ` + commentColumns + ` WHERE c.user_id = ? ORDER BY c.id`
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*Comment{}
+	for rows.Next() {
+		c := &Comment{}
+		err = rows.Scan(&c.ID, &c.SnippetID, &c.UserID, &c.Username, &c.ParentID, &c.Body, &c.Created, &c.Updated)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// ForSnippet returns the top level comments of the snippet in the order they
+// were written, with their replies attached.
+func (m *CommentModel) ForSnippet(snippetID int) ([]*Comment, error) {
+	stmt := `SELECT ` + commentColumns + ` WHERE c.snippet_id = ? ORDER BY c.created, c.id`
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*Comment{}
+	byID := map[int]*Comment{}
+	for rows.Next() {
+		c := &Comment{}
+		err = rows.Scan(&c.ID, &c.SnippetID, &c.UserID, &c.Username, &c.ParentID, &c.Body, &c.Created, &c.Updated)
+		if err != nil {
+			return nil, err
+		}
+		// parents are always older than their replies
+		if parent, ok := byID[c.ParentID]; ok {
+			parent.Replies = append(parent.Replies, c)
+			continue
+		}
+		byID[c.ID] = c
+		comments = append(comments, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
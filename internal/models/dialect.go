@@ -0,0 +1,136 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect describes how a database differs from MySQL, which the queries of
+// the models are written for. A query marks the SQL that differs with {name}
+// fragments, rebind replaces them from the SQL table of the dialect. The
+// postgres and sqlite packages hold the dialects of their databases, a model
+// without a Dialect runs on MySQL.
+type Dialect struct {
+	// Numbered placeholders like $1 replace the ? of the queries.
+	Numbered bool
+	// Returning reads the id of a new row with RETURNING id instead of
+	// LastInsertId.
+	Returning bool
+	// SQL holds the fragments, see MySQL for the names.
+	SQL map[string]string
+	// UniqueViolation reports whether err breaks the unique constraint with
+	// the given name, or any unique constraint when the name is empty.
+	UniqueViolation func(err error, constraint string) bool
+	// Time converts a time that is compared with the stored timestamps, they
+	// are in UTC. Times are passed on in UTC when it is nil.
+	Time func(t time.Time) interface{}
+}
+
+// MySQL is the dialect the queries are written for.
+var MySQL = &Dialect{
+	SQL: map[string]string{
+		// now is the current time in UTC, nowPrecise with fractional seconds
+		"now":        `UTC_TIMESTAMP()`,
+		"nowPrecise": `UTC_TIMESTAMP(6)`,
+		// nowPlusDays adds the days of its ? parameter to now, which can be
+		// negative
+		"nowPlusDays": `DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY)`,
+		// sessionNow is now compared with the expiry of the session store
+		"sessionNow": `UTC_TIMESTAMP(6)`,
+		// like is a case insensitive LIKE ? with \ as the escape character
+		"like": `LIKE ?`,
+		// insertIgnore and onConflictIgnore wrap an INSERT that skips rows
+		// which already exist
+		"insertIgnore":     `INSERT IGNORE`,
+		"onConflictIgnore": ``,
+		// onConflictTag makes the insert of an existing tag return its id
+		"onConflictTag": `ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)`,
+		// lockReport locks the row of the report r read by a transaction
+		"lockReport": `FOR UPDATE`,
+	},
+	UniqueViolation: func(err error, constraint string) bool {
+		var mySQLError *mysql.MySQLError
+		return errors.As(err, &mySQLError) && mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, constraint)
+	},
+}
+
+func (d *Dialect) orMySQL() *Dialect {
+	if d == nil {
+		return MySQL
+	}
+	return d
+}
+
+// rebind rewrites a query into the dialect.
+func (d *Dialect) rebind(query string) string {
+	d = d.orMySQL()
+	for name, fragment := range d.SQL {
+		query = strings.ReplaceAll(query, "{"+name+"}", fragment)
+	}
+	if !d.Numbered {
+		return query
+	}
+
+	var sb strings.Builder
+	n := 0
+	for {
+		i := strings.IndexByte(query, '?')
+		if i < 0 {
+			break
+		}
+		n++
+		sb.WriteString(query[:i])
+		sb.WriteString("$" + strconv.Itoa(n))
+		query = query[i+1:]
+	}
+	sb.WriteString(query)
+	return sb.String()
+}
+
+func (d *Dialect) uniqueViolation(err error, constraint string) bool {
+	return d.orMySQL().UniqueViolation(err, constraint)
+}
+
+func (d *Dialect) time(t time.Time) interface{} {
+	if d = d.orMySQL(); d.Time != nil {
+		return d.Time(t)
+	}
+	return t.UTC()
+}
+
+// execer runs statements on a database or inside a transaction.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// insert runs an INSERT and returns the id of the new row. An INSERT ...
+// SELECT that finds nothing to copy returns ErrNoRecord.
+func (d *Dialect) insert(db execer, stmt string, args ...interface{}) (int, error) {
+	if d.orMySQL().Returning {
+		var id int
+		err := db.QueryRow(d.rebind(stmt+` RETURNING id`), args...).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return id, err
+	}
+
+	result, err := db.Exec(d.rebind(stmt), args...)
+	if err != nil {
+		return 0, err
+	}
+	// the affected rows don't tell, an upsert that changes nothing has none
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if id == 0 {
+		return 0, ErrNoRecord
+	}
+	return int(id), nil
+}
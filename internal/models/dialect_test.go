@@ -0,0 +1,49 @@
+package models
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	numbered := &Dialect{
+		Numbered: true,
+		SQL:      map[string]string{"now": `now()`, "like": `ILIKE ?`},
+	}
+
+	tests := []struct {
+		name    string
+		dialect *Dialect
+		query   string
+		want    string
+	}{
+		{
+			name:  "mysql by default",
+			query: `SELECT id FROM users WHERE created > {now} AND name {like} LIMIT ?`,
+			want:  `SELECT id FROM users WHERE created > UTC_TIMESTAMP() AND name LIKE ? LIMIT ?`,
+		},
+		{
+			name:    "numbered",
+			dialect: numbered,
+			query:   `UPDATE users SET role = ? WHERE id = ?`,
+			want:    `UPDATE users SET role = $1 WHERE id = $2`,
+		},
+		{
+			name:    "numbered fragments",
+			dialect: numbered,
+			query:   `SELECT id FROM users WHERE id = ? AND created > {now} AND name {like} LIMIT ?`,
+			want:    `SELECT id FROM users WHERE id = $1 AND created > now() AND name ILIKE $2 LIMIT $3`,
+		},
+		{
+			name:    "no placeholders",
+			dialect: numbered,
+			query:   `SELECT COUNT(*) FROM users`,
+			want:    `SELECT COUNT(*) FROM users`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.rebind(tt.query); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,4 +6,10 @@ var (
 	ErrNoRecord           = errors.New("models: no matching record found")
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 	ErrDuplicateEmail     = errors.New("models: duplicate email")
+	ErrDuplicateUsername  = errors.New("models: duplicate username")
+	ErrAccountSuspended   = errors.New("models: account suspended")
+	ErrDuplicateIdentity  = errors.New("models: identity already linked")
+	// ErrRehashFailed is returned together with the user id by Authenticate
+	// when the login succeeded but the password hash couldn't be upgraded.
+	ErrRehashFailed = errors.New("models: password rehash failed")
 )
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Identity is an account at an external OpenID Connect provider, identified
+// by the issuer and the subject claim.
+type Identity struct {
+	ID      int
+	UserID  int
+	Issuer  string
+	Subject string
+	Email   string
+	Created time.Time
+}
+
+type IdentityModel struct {
+	DB      *sql.DB
+	Dialect *Dialect
+}
+
+func (m *IdentityModel) Get(issuer, subject string) (*Identity, error) {
+	stmt := `SELECT id, user_id, issuer, subject, email, created FROM user_identities WHERE issuer = ? AND subject = ?`
+	i := &Identity{}
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), issuer, subject).Scan(&i.ID, &i.UserID, &i.Issuer, &i.Subject, &i.Email, &i.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return i, nil
+}
+
+// Insert links an identity to a user, an identity can only belong to one user.
+func (m *IdentityModel) Insert(userID int, issuer, subject, email string) error {
+	stmt := `INSERT INTO user_identities (user_id, issuer, subject, email, created) VALUES(?, ?, ?, ?, {now})`
+	_, err := m.DB.Exec(m.Dialect.rebind(stmt), userID, issuer, subject, email)
+	if err != nil {
+		if m.Dialect.uniqueViolation(err, "") {
+			return ErrDuplicateIdentity
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *IdentityModel) ForUser(userID int) ([]*Identity, error) {
+	stmt := `SELECT id, user_id, issuer, subject, email, created FROM user_identities WHERE user_id = ? ORDER BY id`
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*Identity{}
+	for rows.Next() {
+		i := &Identity{}
+		err = rows.Scan(&i.ID, &i.UserID, &i.Issuer, &i.Subject, &i.Email, &i.Created)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
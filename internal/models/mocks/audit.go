@@ -0,0 +1,102 @@
+package mocks
+
+import (
+	"snippetbox.labkita.my.id/internal/models"
+	"sync"
+	"time"
+)
+
+// AuditModel keeps the audit log in memory. Setting Err makes every method
+// fail with it.
+type AuditModel struct {
+	Err error
+
+	mu     sync.Mutex
+	events []*models.AuditEvent
+}
+
+func NewAuditModel() *AuditModel {
+	return &AuditModel{}
+}
+
+func (m *AuditModel) Insert(e *models.AuditEvent) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := *e
+	c.ID = int64(len(m.events) + 1)
+	c.Created = time.Now().UTC()
+	m.events = append(m.events, &c)
+	return nil
+}
+
+func (m *AuditModel) List(filter models.AuditFilter, limit, offset int) ([]*models.AuditEvent, error) {
+	events, err := m.matching(filter)
+	if err != nil {
+		return nil, err
+	}
+	// newest first
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+
+	if offset >= len(events) {
+		return []*models.AuditEvent{}, nil
+	}
+	events = events[offset:]
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (m *AuditModel) Each(filter models.AuditFilter, fn func(*models.AuditEvent) error) error {
+	events, err := m.matching(filter)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if err = fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Events returns every recorded event in the order they happened.
+func (m *AuditModel) Events() []*models.AuditEvent {
+	events, _ := m.matching(models.AuditFilter{})
+	return events
+}
+
+// matching returns copies of the events that pass the filter, oldest first.
+func (m *AuditModel) matching(f models.AuditFilter) ([]*models.AuditEvent, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []*models.AuditEvent{}
+	for _, e := range m.events {
+		switch {
+		case f.ActorID != 0 && e.ActorID != f.ActorID,
+			f.Action != "" && e.Action != f.Action,
+			f.ActorUsername != "" && e.ActorUsername != f.ActorUsername,
+			f.TargetType != "" && e.TargetType != f.TargetType,
+			f.TargetID != 0 && e.TargetID != f.TargetID,
+			f.IP != "" && e.IP != f.IP,
+			!f.Since.IsZero() && e.Created.Before(f.Since),
+			!f.Until.IsZero() && !e.Created.Before(f.Until):
+			continue
+		}
+		c := *e
+		events = append(events, &c)
+	}
+	return events, nil
+}
+
+var _ models.AuditStore = (*AuditModel)(nil)
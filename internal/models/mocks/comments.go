@@ -0,0 +1,137 @@
+package mocks
+
+import (
+	"snippetbox.labkita.my.id/internal/models"
+	"sync"
+	"time"
+)
+
+// CommentModel keeps comments in memory, the usernames of their authors come
+// from Users. Setting Err makes every method fail with it.
+type CommentModel struct {
+	Err   error
+	Users models.UserStore
+
+	mu       sync.Mutex
+	comments []*models.Comment
+	nextID   int
+}
+
+func NewCommentModel(users models.UserStore) *CommentModel {
+	return &CommentModel{Users: users, nextID: 1}
+}
+
+func (m *CommentModel) Insert(snippetID, userID, parentID int, body string) (int, error) {
+	if m.Err != nil {
+		return 0, m.Err
+	}
+	user, err := m.Users.Get(userID)
+	if err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	id := m.nextID
+	m.nextID++
+	m.comments = append(m.comments, &models.Comment{
+		ID:        id,
+		SnippetID: snippetID,
+		UserID:    userID,
+		Username:  user.Username,
+		ParentID:  parentID,
+		Body:      body,
+		Created:   now,
+		Updated:   now,
+	})
+	return id, nil
+}
+
+func (m *CommentModel) Get(id int) (*models.Comment, error) {
+	comments, err := m.all(func(c *models.Comment) bool { return c.ID == id })
+	if err != nil {
+		return nil, err
+	}
+	if len(comments) == 0 {
+		return nil, models.ErrNoRecord
+	}
+	return comments[0], nil
+}
+
+func (m *CommentModel) Update(id int, body string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.comments {
+		if c.ID == id {
+			c.Body = body
+			c.Updated = time.Now().UTC()
+		}
+	}
+	return nil
+}
+
+// Delete removes the comment together with its replies.
+func (m *CommentModel) Delete(id int) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := []*models.Comment{}
+	for _, c := range m.comments {
+		if c.ID != id && c.ParentID != id {
+			kept = append(kept, c)
+		}
+	}
+	m.comments = kept
+	return nil
+}
+
+func (m *CommentModel) ByUser(userID int) ([]*models.Comment, error) {
+	return m.all(func(c *models.Comment) bool { return c.UserID == userID })
+}
+
+func (m *CommentModel) ForSnippet(snippetID int) ([]*models.Comment, error) {
+	all, err := m.all(func(c *models.Comment) bool { return c.SnippetID == snippetID })
+	if err != nil {
+		return nil, err
+	}
+
+	comments := []*models.Comment{}
+	byID := map[int]*models.Comment{}
+	for _, c := range all {
+		if parent, ok := byID[c.ParentID]; ok {
+			parent.Replies = append(parent.Replies, c)
+			continue
+		}
+		byID[c.ID] = c
+		comments = append(comments, c)
+	}
+	return comments, nil
+}
+
+// all returns copies of the matching comments, oldest first.
+func (m *CommentModel) all(match func(*models.Comment) bool) ([]*models.Comment, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comments := []*models.Comment{}
+	for _, c := range m.comments {
+		if match(c) {
+			copied := *c
+			comments = append(comments, &copied)
+		}
+	}
+	return comments, nil
+}
+
+var _ models.CommentStore = (*CommentModel)(nil)
@@ -0,0 +1,80 @@
+package mocks
+
+import (
+	"snippetbox.labkita.my.id/internal/models"
+	"sync"
+	"time"
+)
+
+// IdentityModel keeps linked identities in memory. Setting Err makes every
+// method fail with it.
+type IdentityModel struct {
+	Err error
+
+	mu         sync.Mutex
+	identities []*models.Identity
+	nextID     int
+}
+
+func NewIdentityModel() *IdentityModel {
+	return &IdentityModel{nextID: 1}
+}
+
+func (m *IdentityModel) Get(issuer, subject string) (*models.Identity, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, i := range m.identities {
+		if i.Issuer == issuer && i.Subject == subject {
+			c := *i
+			return &c, nil
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *IdentityModel) Insert(userID int, issuer, subject, email string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, i := range m.identities {
+		if i.Issuer == issuer && i.Subject == subject {
+			return models.ErrDuplicateIdentity
+		}
+	}
+	m.identities = append(m.identities, &models.Identity{
+		ID:      m.nextID,
+		UserID:  userID,
+		Issuer:  issuer,
+		Subject: subject,
+		Email:   email,
+		Created: time.Now().UTC(),
+	})
+	m.nextID++
+	return nil
+}
+
+func (m *IdentityModel) ForUser(userID int) ([]*models.Identity, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	identities := []*models.Identity{}
+	for _, i := range m.identities {
+		if i.UserID == userID {
+			c := *i
+			identities = append(identities, &c)
+		}
+	}
+	return identities, nil
+}
+
+var _ models.IdentityStore = (*IdentityModel)(nil)
@@ -0,0 +1,190 @@
+package mocks
+
+import (
+	"errors"
+	"snippetbox.labkita.my.id/internal/models"
+	"sync"
+	"time"
+)
+
+// ReportModel keeps reports and moderation actions in memory. Resolving a
+// report applies the action to Snippets and Users. Setting Err makes every
+// method fail with it.
+type ReportModel struct {
+	Err      error
+	Snippets models.SnippetStore
+	Users    models.UserStore
+
+	mu      sync.Mutex
+	reports []*models.Report
+	actions []*models.ModerationAction
+}
+
+func NewReportModel(snippets models.SnippetStore, users models.UserStore) *ReportModel {
+	return &ReportModel{Snippets: snippets, Users: users}
+}
+
+func (m *ReportModel) Insert(snippetID, reporterID int, reason, details string) (int, error) {
+	if m.Err != nil {
+		return 0, m.Err
+	}
+	reporter, err := m.Users.Get(reporterID)
+	if err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := len(m.reports) + 1
+	m.reports = append(m.reports, &models.Report{
+		ID:               id,
+		SnippetID:        snippetID,
+		ReporterUsername: reporter.Username,
+		Reason:           reason,
+		Details:          details,
+		Status:           "open",
+		Created:          time.Now().UTC(),
+	})
+	return id, nil
+}
+
+func (m *ReportModel) Open(limit, offset int) ([]*models.Report, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	open := []models.Report{}
+	for _, r := range m.reports {
+		if r.Status == "open" {
+			open = append(open, *r)
+		}
+	}
+	m.mu.Unlock()
+
+	if offset >= len(open) {
+		return []*models.Report{}, nil
+	}
+	open = open[offset:]
+	if len(open) > limit {
+		open = open[:limit]
+	}
+
+	reports := []*models.Report{}
+	for i := range open {
+		r := &open[i]
+		snippet, err := m.snippet(r.SnippetID)
+		if err != nil {
+			return nil, err
+		}
+		if snippet != nil {
+			r.SnippetTitle = snippet.Title
+			r.AuthorID = snippet.UserID
+			if author, err := m.Users.Get(snippet.UserID); err == nil {
+				r.AuthorUsername = author.Username
+			}
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+func (m *ReportModel) Resolve(id, adminID int, action string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var report *models.Report
+	for _, r := range m.reports {
+		if r.ID == id && r.Status == "open" {
+			report = r
+		}
+	}
+	if report == nil {
+		return models.ErrNoRecord
+	}
+	snippet, err := m.snippet(report.SnippetID)
+	if err != nil {
+		return err
+	}
+
+	moderation := &models.ModerationAction{
+		ID:       len(m.actions) + 1,
+		ReportID: id,
+		Action:   action,
+		Created:  time.Now().UTC(),
+	}
+	if snippet != nil {
+		moderation.SnippetID = snippet.ID
+		moderation.TargetUserID = snippet.UserID
+	}
+
+	switch action {
+	case models.ReportActionHide:
+		if snippet != nil {
+			err = m.Snippets.SetHidden(snippet.ID, true)
+		}
+	case models.ReportActionDelete:
+		if snippet != nil {
+			err = m.Snippets.Delete(snippet.ID)
+		}
+	case models.ReportActionSuspend:
+		if snippet == nil || snippet.UserID == 0 {
+			return models.ErrNoRecord
+		}
+		err = m.Users.SetSuspended(snippet.UserID, true)
+	case models.ReportActionDismiss:
+	default:
+		return errors.New("models: unknown report action " + action)
+	}
+	if err != nil {
+		return err
+	}
+
+	// dismissing only closes this report, the other actions every open
+	// report of the snippet
+	for _, r := range m.reports {
+		if r.ID == id || (action != models.ReportActionDismiss && snippet != nil && r.SnippetID == snippet.ID && r.Status == "open") {
+			r.Status = "resolved"
+		}
+		if action == models.ReportActionDelete && snippet != nil && r.SnippetID == snippet.ID {
+			r.SnippetID = 0
+		}
+	}
+
+	if admin, err := m.Users.Get(adminID); err == nil {
+		moderation.AdminUsername = admin.Username
+	}
+	m.actions = append(m.actions, moderation)
+	return nil
+}
+
+func (m *ReportModel) RecentActions(limit int) ([]*models.ModerationAction, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	actions := []*models.ModerationAction{}
+	for i := len(m.actions) - 1; i >= 0 && len(actions) < limit; i-- {
+		c := *m.actions[i]
+		actions = append(actions, &c)
+	}
+	return actions, nil
+}
+
+// snippet returns the reported snippet, or nil when it was deleted.
+func (m *ReportModel) snippet(id int) (*models.Snippet, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	s, err := m.Snippets.Get(id)
+	if errors.Is(err, models.ErrNoRecord) {
+		return nil, nil
+	}
+	return s, err
+}
+
+var _ models.ReportStore = (*ReportModel)(nil)
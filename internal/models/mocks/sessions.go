@@ -0,0 +1,159 @@
+package mocks
+
+import (
+	"snippetbox.labkita.my.id/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SessionModel keeps the mapping of session tokens to users in memory. When
+// Store is set, revoked sessions are deleted from it like the database models
+// delete them from the sessions table. Setting Err makes every method fail
+// with it.
+type SessionModel struct {
+	Err   error
+	Store interface{ Delete(token string) error }
+
+	mu       sync.Mutex
+	sessions []*models.UserSession
+	nextID   int
+}
+
+func NewSessionModel() *SessionModel {
+	return &SessionModel{nextID: 1}
+}
+
+func (m *SessionModel) Track(token string, userID int, ip, userAgent string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	m.sessions = append(m.sessions, &models.UserSession{
+		ID:        m.nextID,
+		Token:     token,
+		UserID:    userID,
+		IP:        ip,
+		UserAgent: userAgent,
+		Created:   now,
+		LastSeen:  now,
+	})
+	m.nextID++
+	return nil
+}
+
+func (m *SessionModel) Touch(token, ip string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sessions {
+		if s.Token == token {
+			s.LastSeen = time.Now().UTC()
+			s.IP = ip
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (m *SessionModel) ForUser(userID int) ([]*models.UserSession, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessions := []*models.UserSession{}
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			c := *s
+			sessions = append(sessions, &c)
+		}
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].LastSeen.After(sessions[j].LastSeen) })
+	return sessions, nil
+}
+
+func (m *SessionModel) Revoke(userID, id int) (string, error) {
+	if m.Err != nil {
+		return "", m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sessions {
+		if s.ID == id && s.UserID == userID {
+			return s.Token, m.remove(func(other *models.UserSession) bool { return other.Token == s.Token })
+		}
+	}
+	return "", models.ErrNoRecord
+}
+
+func (m *SessionModel) RevokeAll(userID int, except string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.remove(func(s *models.UserSession) bool { return s.UserID == userID && s.Token != except })
+}
+
+func (m *SessionModel) Forget(token string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := []*models.UserSession{}
+	for _, s := range m.sessions {
+		if s.Token != token {
+			kept = append(kept, s)
+		}
+	}
+	m.sessions = kept
+	return nil
+}
+
+// Purge only knows about tracked sessions, which never expire in memory, so
+// it only deletes something when all is set.
+func (m *SessionModel) Purge(all bool) (int, error) {
+	if m.Err != nil {
+		return 0, m.Err
+	}
+	if !all {
+		return 0, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := len(m.sessions)
+	return n, m.remove(func(*models.UserSession) bool { return true })
+}
+
+// remove drops the matching mappings and their sessions, m.mu must be held.
+func (m *SessionModel) remove(match func(*models.UserSession) bool) error {
+	kept := []*models.UserSession{}
+	for _, s := range m.sessions {
+		if !match(s) {
+			kept = append(kept, s)
+			continue
+		}
+		if m.Store != nil {
+			if err := m.Store.Delete(s.Token); err != nil {
+				return err
+			}
+		}
+	}
+	m.sessions = kept
+	return nil
+}
+
+var _ models.SessionStore = (*SessionModel)(nil)
@@ -0,0 +1,227 @@
+// Package mocks holds in-memory implementations of the model stores, they
+// let handlers run without a database.
+package mocks
+
+import (
+	"snippetbox.labkita.my.id/internal/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SnippetModel keeps snippets in memory. Setting Err makes every method fail
+// with it, to cover the error paths of callers.
+type SnippetModel struct {
+	Err error
+
+	mu       sync.Mutex
+	snippets map[int]*models.Snippet
+	nextID   int
+}
+
+// NewSnippetModel returns a store holding the public snippet 1, owned by
+// user 1.
+func NewSnippetModel() *SnippetModel {
+	m := &SnippetModel{snippets: map[int]*models.Snippet{}, nextID: 1}
+	m.Add(&models.Snippet{
+		UserID:     1,
+		Username:   "alice",
+		Title:      "An old silent pond",
+		Content:    "An old silent pond...",
+		Visibility: models.VisibilityPublic,
+		Created:    time.Date(2022, 3, 17, 10, 15, 0, 0, time.UTC),
+		Expires:    time.Now().AddDate(1, 0, 0),
+		Tags:       []string{"haiku"},
+	})
+	return m
+}
+
+// Add stores a copy of the snippet as it is and returns its new id.
+func (m *SnippetModel) Add(s *models.Snippet) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := *s
+	c.ID = m.nextID
+	m.nextID++
+	m.snippets[c.ID] = &c
+	return c.ID
+}
+
+func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
+	return m.filter(10, 0, isPublic)
+}
+
+func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	c := *s
+	c.ForkCount = 0
+	for _, other := range m.snippets {
+		if other.ForkedFromID == id {
+			c.ForkCount++
+		}
+	}
+	return &c, nil
+}
+
+func (m *SnippetModel) Insert(input models.SnippetInput) (int, error) {
+	ids, err := m.InsertMany([]models.SnippetInput{input})
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+func (m *SnippetModel) InsertMany(inputs []models.SnippetInput) ([]int, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	ids := make([]int, 0, len(inputs))
+	for _, input := range inputs {
+		now := time.Now().UTC()
+		ids = append(ids, m.Add(&models.Snippet{
+			UserID:     input.UserID,
+			Title:      input.Title,
+			Content:    input.Content,
+			Language:   input.Language,
+			Visibility: input.Visibility,
+			Created:    now,
+			Expires:    now.AddDate(0, 0, input.Expires),
+			Tags:       input.Tags,
+		}))
+	}
+	return ids, nil
+}
+
+func (m *SnippetModel) Fork(id, userID int) (int, error) {
+	original, err := m.Get(id)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	return m.Add(&models.Snippet{
+		UserID:       userID,
+		Title:        original.Title,
+		Content:      original.Content,
+		Language:     original.Language,
+		Visibility:   original.Visibility,
+		ForkedFromID: original.ID,
+		Created:      now,
+		Expires:      now.AddDate(1, 0, 0),
+		Tags:         original.Tags,
+	}), nil
+}
+
+func (m *SnippetModel) Search(text string, tags []string, limit, offset int) ([]*models.Snippet, error) {
+	text = strings.ToLower(text)
+	return m.filter(limit, offset, func(s *models.Snippet) bool {
+		if !isPublic(s) {
+			return false
+		}
+		if text != "" && !strings.Contains(strings.ToLower(s.Title), text) && !strings.Contains(strings.ToLower(s.Content), text) {
+			return false
+		}
+		for _, tag := range tags {
+			if !hasTag(s, tag) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (m *SnippetModel) ByTag(tag string, limit, offset int) ([]*models.Snippet, error) {
+	return m.Search("", []string{tag}, limit, offset)
+}
+
+func (m *SnippetModel) ByUser(userID int, includeHidden bool, limit, offset int) ([]*models.Snippet, error) {
+	return m.filter(limit, offset, func(s *models.Snippet) bool {
+		return s.UserID == userID && (includeHidden || isPublic(s))
+	})
+}
+
+// filter returns copies of the matching snippets, newest first.
+func (m *SnippetModel) filter(limit, offset int, match func(*models.Snippet) bool) ([]*models.Snippet, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snippets := []*models.Snippet{}
+	for _, s := range m.snippets {
+		if match(s) {
+			c := *s
+			snippets = append(snippets, &c)
+		}
+	}
+	sort.Slice(snippets, func(i, j int) bool { return snippets[i].ID > snippets[j].ID })
+
+	if offset >= len(snippets) {
+		return []*models.Snippet{}, nil
+	}
+	snippets = snippets[offset:]
+	if len(snippets) > limit {
+		snippets = snippets[:limit]
+	}
+	return snippets, nil
+}
+
+func (m *SnippetModel) SetHidden(id int, hidden bool) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok {
+		return models.ErrNoRecord
+	}
+	s.Hidden = hidden
+	return nil
+}
+
+func (m *SnippetModel) Delete(id int) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.snippets[id]; !ok {
+		return models.ErrNoRecord
+	}
+	delete(m.snippets, id)
+	for _, s := range m.snippets {
+		if s.ForkedFromID == id {
+			s.ForkedFromID = 0
+		}
+	}
+	return nil
+}
+
+func isPublic(s *models.Snippet) bool {
+	return s.Visibility == models.VisibilityPublic && !s.Hidden && !s.IsExpired()
+}
+
+func hasTag(s *models.Snippet, tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+var _ models.SnippetStore = (*SnippetModel)(nil)
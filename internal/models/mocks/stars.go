@@ -0,0 +1,162 @@
+package mocks
+
+import (
+	"errors"
+	"snippetbox.labkita.my.id/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+type star struct {
+	userID    int
+	snippetID int
+	created   time.Time
+}
+
+// StarModel keeps stars in memory and reads the starred snippets from
+// Snippets. Setting Err makes every method fail with it.
+type StarModel struct {
+	Err      error
+	Snippets models.SnippetStore
+
+	mu    sync.Mutex
+	stars []star
+}
+
+func NewStarModel(snippets models.SnippetStore) *StarModel {
+	return &StarModel{Snippets: snippets}
+}
+
+func (m *StarModel) Add(userID, snippetID int) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.stars {
+		if s.userID == userID && s.snippetID == snippetID {
+			return nil
+		}
+	}
+	m.stars = append(m.stars, star{userID: userID, snippetID: snippetID, created: time.Now().UTC()})
+	return nil
+}
+
+func (m *StarModel) Remove(userID, snippetID int) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := []star{}
+	for _, s := range m.stars {
+		if s.userID != userID || s.snippetID != snippetID {
+			kept = append(kept, s)
+		}
+	}
+	m.stars = kept
+	return nil
+}
+
+func (m *StarModel) Exists(userID, snippetID int) (bool, error) {
+	if m.Err != nil {
+		return false, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.stars {
+		if s.userID == userID && s.snippetID == snippetID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *StarModel) StarredBy(userID, limit, offset int) ([]*models.Snippet, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	ids := []int{}
+	// most recently starred first
+	for i := len(m.stars) - 1; i >= 0; i-- {
+		if m.stars[i].userID == userID {
+			ids = append(ids, m.stars[i].snippetID)
+		}
+	}
+	m.mu.Unlock()
+
+	snippets, err := m.publicSnippets(ids)
+	if err != nil {
+		return nil, err
+	}
+	if offset >= len(snippets) {
+		return []*models.Snippet{}, nil
+	}
+	snippets = snippets[offset:]
+	if len(snippets) > limit {
+		snippets = snippets[:limit]
+	}
+	return snippets, nil
+}
+
+func (m *StarModel) Popular(days, limit int) ([]*models.Snippet, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	since := time.Now().AddDate(0, 0, -days)
+	counts := map[int]int{}
+	ids := []int{}
+	for _, s := range m.stars {
+		if s.created.After(since) {
+			if counts[s.snippetID] == 0 {
+				ids = append(ids, s.snippetID)
+			}
+			counts[s.snippetID]++
+		}
+	}
+	m.mu.Unlock()
+
+	snippets, err := m.publicSnippets(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range snippets {
+		s.StarCount = counts[s.ID]
+	}
+	sort.Slice(snippets, func(i, j int) bool {
+		if snippets[i].StarCount != snippets[j].StarCount {
+			return snippets[i].StarCount > snippets[j].StarCount
+		}
+		return snippets[i].ID > snippets[j].ID
+	})
+	if len(snippets) > limit {
+		snippets = snippets[:limit]
+	}
+	return snippets, nil
+}
+
+// publicSnippets loads the snippets in the given order, leaving out the ones
+// that are gone or not public anymore.
+func (m *StarModel) publicSnippets(ids []int) ([]*models.Snippet, error) {
+	snippets := []*models.Snippet{}
+	for _, id := range ids {
+		s, err := m.Snippets.Get(id)
+		if errors.Is(err, models.ErrNoRecord) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if isPublic(s) {
+			snippets = append(snippets, s)
+		}
+	}
+	return snippets, nil
+}
+
+var _ models.StarStore = (*StarModel)(nil)
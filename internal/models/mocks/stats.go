@@ -0,0 +1,21 @@
+package mocks
+
+import (
+	"snippetbox.labkita.my.id/internal/models"
+)
+
+// StatsModel returns fixed Stats, setting Err makes Get fail with it.
+type StatsModel struct {
+	Err   error
+	Stats models.Stats
+}
+
+func (m *StatsModel) Get() (*models.Stats, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	s := m.Stats
+	return &s, nil
+}
+
+var _ models.StatsStore = (*StatsModel)(nil)
@@ -0,0 +1,40 @@
+package mocks
+
+import (
+	"snippetbox.labkita.my.id/internal/models"
+	"sync"
+)
+
+// TagModel returns a fixed tag cloud, Tags can be replaced by tests. Setting
+// Err makes Popular fail with it.
+type TagModel struct {
+	Err  error
+	Tags []*models.Tag
+
+	mu sync.Mutex
+}
+
+// NewTagModel returns a store with the tag of the snippet of NewSnippetModel.
+func NewTagModel() *TagModel {
+	return &TagModel{Tags: []*models.Tag{{ID: 1, Name: "haiku", Count: 1}}}
+}
+
+func (m *TagModel) Popular(limit int) ([]*models.Tag, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tags := []*models.Tag{}
+	for _, t := range m.Tags {
+		if len(tags) == limit {
+			break
+		}
+		c := *t
+		tags = append(tags, &c)
+	}
+	return tags, nil
+}
+
+var _ models.TagStore = (*TagModel)(nil)
@@ -0,0 +1,223 @@
+package mocks
+
+import (
+	"errors"
+	"snippetbox.labkita.my.id/internal/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserModel keeps users in memory with their passwords in plain text.
+// Setting Err makes every method fail with it.
+type UserModel struct {
+	Err error
+
+	mu        sync.Mutex
+	users     map[int]*models.User
+	passwords map[int]string
+	nextID    int
+}
+
+// NewUserModel returns a store holding the user alice with the id 1, the
+// email alice@example.com and the password pa$$word.
+func NewUserModel() *UserModel {
+	m := &UserModel{users: map[int]*models.User{}, passwords: map[int]string{}, nextID: 1}
+	m.Insert("Alice Jones", "alice", "alice@example.com", "pa$$word")
+	return m
+}
+
+func (m *UserModel) Insert(name, username, email, password string) (int, error) {
+	if m.Err != nil {
+		return 0, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Email == email {
+			return 0, models.ErrDuplicateEmail
+		}
+		if u.Username == username {
+			return 0, models.ErrDuplicateUsername
+		}
+	}
+
+	id := m.nextID
+	m.nextID++
+	m.users[id] = &models.User{
+		ID:       id,
+		Name:     name,
+		Username: username,
+		Email:    email,
+		Role:     models.RoleUser,
+		Created:  time.Now().UTC(),
+	}
+	m.passwords[id] = password
+	return id, nil
+}
+
+func (m *UserModel) Authenticate(email, password string) (int, error) {
+	user, err := m.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return 0, models.ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.passwords[user.ID] != password {
+		return 0, models.ErrInvalidCredentials
+	}
+	if user.Suspended {
+		return 0, models.ErrAccountSuspended
+	}
+	return user.ID, nil
+}
+
+func (m *UserModel) PasswordMatches(id int, password string) (bool, error) {
+	if _, err := m.Get(id); err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.passwords[id] == password, nil
+}
+
+func (m *UserModel) UpdatePassword(id int, password string) error {
+	return m.update(id, func(u *models.User) {
+		m.passwords[id] = password
+	})
+}
+
+func (m *UserModel) Get(id int) (*models.User, error) {
+	return m.find(func(u *models.User) bool { return u.ID == id })
+}
+
+func (m *UserModel) GetByUsername(username string) (*models.User, error) {
+	return m.find(func(u *models.User) bool { return u.Username == username })
+}
+
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	return m.find(func(u *models.User) bool { return u.Email == email })
+}
+
+func (m *UserModel) Exists(id int) (bool, error) {
+	_, err := m.Get(id)
+	if errors.Is(err, models.ErrNoRecord) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (m *UserModel) List(query string, limit, offset int) ([]*models.User, error) {
+	query = strings.ToLower(query)
+	users, err := m.all(func(u *models.User) bool {
+		return strings.Contains(strings.ToLower(u.Name), query) || strings.Contains(u.Username, query) || strings.Contains(u.Email, query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID > users[j].ID })
+
+	if offset >= len(users) {
+		return []*models.User{}, nil
+	}
+	users = users[offset:]
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (m *UserModel) SetSuspended(id int, suspended bool) error {
+	return m.update(id, func(u *models.User) { u.Suspended = suspended })
+}
+
+func (m *UserModel) SetRole(id int, role string) error {
+	return m.update(id, func(u *models.User) { u.Role = role })
+}
+
+func (m *UserModel) ScheduleDeletion(id int, at time.Time, policy string) error {
+	return m.update(id, func(u *models.User) {
+		at := at.UTC()
+		u.DeleteAt = &at
+		u.DeletePolicy = policy
+	})
+}
+
+func (m *UserModel) CancelDeletion(id int) error {
+	return m.update(id, func(u *models.User) {
+		u.DeleteAt = nil
+		u.DeletePolicy = ""
+	})
+}
+
+func (m *UserModel) DueForDeletion() ([]*models.User, error) {
+	now := time.Now()
+	return m.all(func(u *models.User) bool { return u.DeleteAt != nil && !u.DeleteAt.After(now) })
+}
+
+func (m *UserModel) Delete(id int, policy string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return models.ErrNoRecord
+	}
+	delete(m.users, id)
+	delete(m.passwords, id)
+	return nil
+}
+
+func (m *UserModel) find(match func(*models.User) bool) (*models.User, error) {
+	users, err := m.all(match)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, models.ErrNoRecord
+	}
+	return users[0], nil
+}
+
+// all returns copies of the matching users.
+func (m *UserModel) all(match func(*models.User) bool) ([]*models.User, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := []*models.User{}
+	for _, u := range m.users {
+		if match(u) {
+			c := *u
+			users = append(users, &c)
+		}
+	}
+	return users, nil
+}
+
+func (m *UserModel) update(id int, fn func(*models.User)) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return models.ErrNoRecord
+	}
+	fn(u)
+	return nil
+}
+
+var _ models.UserStore = (*UserModel)(nil)
@@ -0,0 +1,37 @@
+// Package postgres holds the dialect that runs the models of the models
+// package on PostgreSQL, the schema is in internal/migrations/postgres.
+package postgres
+
+import (
+	"errors"
+	"github.com/lib/pq"
+	"snippetbox.labkita.my.id/internal/models"
+)
+
+// utcNow matches the UTC_TIMESTAMP() of MySQL, timestamps are stored in UTC
+// without a time zone like the DATETIME columns there.
+const utcNow = `(now() AT TIME ZONE 'UTC')`
+
+var Dialect = &models.Dialect{
+	Numbered:  true,
+	Returning: true,
+	SQL: map[string]string{
+		"now":         utcNow,
+		"nowPrecise":  utcNow,
+		"nowPlusDays": utcNow + ` + ? * INTERVAL '1 day'`,
+		// the sessions table of postgresstore uses TIMESTAMPTZ
+		"sessionNow":       `now()`,
+		"like":             `ILIKE ?`,
+		"insertIgnore":     `INSERT`,
+		"onConflictIgnore": `ON CONFLICT DO NOTHING`,
+		"onConflictTag":    `ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name`,
+		// Postgres can't lock the nullable side of an outer join
+		"lockReport": `FOR UPDATE OF r`,
+	},
+	UniqueViolation: uniqueViolation,
+}
+
+func uniqueViolation(err error, constraint string) bool {
+	var pqError *pq.Error
+	return errors.As(err, &pqError) && pqError.Code == "23505" && (constraint == "" || pqError.Constraint == constraint)
+}
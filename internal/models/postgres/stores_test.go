@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"database/sql"
+	"github.com/alexedwards/scs/postgresstore"
+	"os"
+	"snippetbox.labkita.my.id/internal/migrations"
+	"snippetbox.labkita.my.id/internal/models"
+	"snippetbox.labkita.my.id/internal/models/storetest"
+	"testing"
+	"time"
+)
+
+// TestStores runs the shared suite on the PostgreSQL database of
+// SNIPPETBOX_TEST_POSTGRES_DSN. Every test drops and recreates the
+// schema, so never point it at a database you care about.
+func TestStores(t *testing.T) {
+	dsn := os.Getenv("SNIPPETBOX_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("SNIPPETBOX_TEST_POSTGRES_DSN isn't set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err = db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	storetest.Run(t, func(t *testing.T) *storetest.Stores {
+		migrator := &migrations.Migrator{DB: db, Driver: "postgres"}
+		if err := migrator.Goto(0); err != nil {
+			t.Fatal(err)
+		}
+		if err := migrator.Up(); err != nil {
+			t.Fatal(err)
+		}
+
+		sessionStore := postgresstore.NewWithCleanupInterval(db, 0)
+		return &storetest.Stores{
+			Snippets:   &models.SnippetModel{DB: db, Dialect: Dialect},
+			Users:      &models.UserModel{DB: db, Dialect: Dialect, Hasher: storetest.Hasher},
+			Tags:       &models.TagModel{DB: db, Dialect: Dialect},
+			Stars:      &models.StarModel{DB: db, Dialect: Dialect},
+			Comments:   &models.CommentModel{DB: db, Dialect: Dialect},
+			Reports:    &models.ReportModel{DB: db, Dialect: Dialect},
+			Sessions:   &models.SessionModel{DB: db, Dialect: Dialect},
+			Identities: &models.IdentityModel{DB: db, Dialect: Dialect},
+			Stats:      &models.StatsModel{DB: db, Dialect: Dialect},
+			AuditLog:   &models.AuditModel{DB: db, Dialect: Dialect},
+			Session:    func(token string, expiry time.Time) error { return sessionStore.Commit(token, []byte("data"), expiry) },
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	ReportActionHide    = "hide"
+	ReportActionDelete  = "delete"
+	ReportActionSuspend = "suspend"
+	ReportActionDismiss = "dismiss"
+)
+
+type Report struct {
+	ID               int
+	SnippetID        int
+	SnippetTitle     string
+	AuthorID         int
+	AuthorUsername   string
+	ReporterUsername string
+	Reason           string
+	Details          string
+	Status           string
+	Created          time.Time
+}
+
+type ModerationAction struct {
+	ID            int
+	ReportID      int
+	SnippetID     int
+	TargetUserID  int
+	AdminUsername string
+	Action        string
+	Created       time.Time
+}
+
+type ReportModel struct {
+	DB      *sql.DB
+	Dialect *Dialect
+}
+
+func (m *ReportModel) Insert(snippetID, reporterID int, reason, details string) (int, error) {
+	stmt := `INSERT INTO reports (snippet_id, reporter_id, reason, details, status, created) VALUES(?, ?, ?, ?, 'open', {now})`
+	return m.Dialect.insert(m.DB, stmt, snippetID, reporterID, reason, details)
+}
+
+// Open returns the reports waiting for a decision, oldest first.
+func (m *ReportModel) Open(limit, offset int) ([]*Report, error) {
+	stmt := `SELECT r.id, COALESCE(r.snippet_id, 0), COALESCE(s.title, ''), COALESCE(s.user_id, 0), COALESCE(a.username, ''),
+	COALESCE(rp.username, ''), r.reason, r.details, r.status, r.created
+	FROM reports r
+	LEFT JOIN snippets s ON s.id = r.snippet_id
+	LEFT JOIN users a ON a.id = s.user_id
+	LEFT JOIN users rp ON rp.id = r.reporter_id
+	WHERE r.status = 'open'
+	ORDER BY r.created, r.id LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []*Report{}
+	for rows.Next() {
+		r := &Report{}
+		err = rows.Scan(&r.ID, &r.SnippetID, &r.SnippetTitle, &r.AuthorID, &r.AuthorUsername, &r.ReporterUsername, &r.Reason, &r.Details, &r.Status, &r.Created)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// Resolve applies the moderation action to the reported snippet, closes the
+// report and records who took the action. Hiding, deleting or suspending
+// closes every open report of the snippet, dismissing only this one.
+func (m *ReportModel) Resolve(id, adminID int, action string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var snippetID, authorID sql.NullInt64
+	stmt := `SELECT r.snippet_id, s.user_id FROM reports r LEFT JOIN snippets s ON s.id = r.snippet_id WHERE r.id = ? AND r.status = 'open' {lockReport}`
+	err = tx.QueryRow(m.Dialect.rebind(stmt), id).Scan(&snippetID, &authorID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	// resolve the reports before deleting, the delete clears their snippet_id
+	if action == ReportActionDismiss || !snippetID.Valid {
+		_, err = tx.Exec(m.Dialect.rebind(`UPDATE reports SET status = 'resolved', resolved_by = ?, resolved_at = {now} WHERE id = ?`), adminID, id)
+	} else {
+		_, err = tx.Exec(m.Dialect.rebind(`UPDATE reports SET status = 'resolved', resolved_by = ?, resolved_at = {now} WHERE snippet_id = ? AND status = 'open'`), adminID, snippetID)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case ReportActionHide:
+		_, err = tx.Exec(m.Dialect.rebind(`UPDATE snippets SET hidden = TRUE WHERE id = ?`), snippetID)
+	case ReportActionDelete:
+		_, err = tx.Exec(m.Dialect.rebind(`DELETE FROM snippets WHERE id = ?`), snippetID)
+	case ReportActionSuspend:
+		if !authorID.Valid {
+			return ErrNoRecord
+		}
+		_, err = tx.Exec(m.Dialect.rebind(`UPDATE users SET suspended = TRUE WHERE id = ?`), authorID)
+	case ReportActionDismiss:
+	default:
+		return errors.New("models: unknown report action " + action)
+	}
+	if err != nil {
+		return err
+	}
+
+	stmt = `INSERT INTO moderation_actions (report_id, snippet_id, target_user_id, admin_id, action, created) VALUES(?, ?, ?, ?, ?, {now})`
+	_, err = tx.Exec(m.Dialect.rebind(stmt), id, snippetID, authorID, adminID, action)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecentActions returns the latest moderation decisions.
+func (m *ReportModel) RecentActions(limit int) ([]*ModerationAction, error) {
+	stmt := `SELECT ma.id, ma.report_id, COALESCE(ma.snippet_id, 0), COALESCE(ma.target_user_id, 0), COALESCE(u.username, ''), ma.action, ma.created
+	FROM moderation_actions ma LEFT JOIN users u ON u.id = ma.admin_id
+	ORDER BY ma.id DESC LIMIT ?`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []*ModerationAction{}
+	for rows.Next() {
+		a := &ModerationAction{}
+		err = rows.Scan(&a.ID, &a.ReportID, &a.SnippetID, &a.TargetUserID, &a.AdminUsername, &a.Action, &a.Created)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
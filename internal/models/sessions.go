@@ -0,0 +1,163 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SessionModel keeps track of which user owns which session of the scs store
+// of the database. The data column of the sessions table is encoded by the
+// session manager, so the mapping lives in its own user_sessions table.
+type SessionModel struct {
+	DB      *sql.DB
+	Dialect *Dialect
+}
+
+type UserSession struct {
+	ID        int
+	Token     string
+	UserID    int
+	IP        string
+	UserAgent string
+	Created   time.Time
+	LastSeen  time.Time
+}
+
+// Track records a freshly logged in session. Mappings whose session is gone
+// are cleaned up at the same time.
+func (m *SessionModel) Track(token string, userID int, ip, userAgent string) error {
+	stmt := `DELETE FROM user_sessions WHERE user_id = ?
+	AND NOT EXISTS (SELECT 1 FROM sessions s WHERE s.token = user_sessions.token AND s.expiry > {sessionNow})`
+	_, err := m.DB.Exec(m.Dialect.rebind(stmt), userID)
+	if err != nil {
+		return err
+	}
+
+	stmt = `INSERT INTO user_sessions (token, user_id, ip, user_agent, created, last_seen)
+	VALUES(?, ?, ?, ?, {now}, {now})`
+	_, err = m.DB.Exec(m.Dialect.rebind(stmt), token, userID, ip, truncate(userAgent, auditMaxUserAgent))
+	return err
+}
+
+// Touch updates the last seen time and ip of a session, it returns
+// ErrNoRecord when the session isn't tracked anymore.
+func (m *SessionModel) Touch(token, ip string) error {
+	stmt := `UPDATE user_sessions SET last_seen = {now}, ip = ? WHERE token = ?`
+	result, err := m.DB.Exec(m.Dialect.rebind(stmt), ip, token)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// ForUser returns the sessions of a user that haven't expired yet, most
+// recently used first.
+func (m *SessionModel) ForUser(userID int) ([]*UserSession, error) {
+	stmt := `SELECT us.id, us.token, us.user_id, us.ip, us.user_agent, us.created, us.last_seen
+	FROM user_sessions us JOIN sessions s ON s.token = us.token
+	WHERE us.user_id = ? AND s.expiry > {sessionNow}
+	ORDER BY us.last_seen DESC`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*UserSession{}
+	for rows.Next() {
+		s := &UserSession{}
+		err = rows.Scan(&s.ID, &s.Token, &s.UserID, &s.IP, &s.UserAgent, &s.Created, &s.LastSeen)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Revoke ends a single session of the user and returns its token.
+func (m *SessionModel) Revoke(userID, id int) (string, error) {
+	var token string
+	stmt := `SELECT token FROM user_sessions WHERE id = ? AND user_id = ?`
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), id, userID).Scan(&token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", err
+	}
+	return token, m.revoke(`token = ?`, token)
+}
+
+// RevokeAll ends every session of the user except the one with the given
+// token, pass an empty token to end them all.
+func (m *SessionModel) RevokeAll(userID int, except string) error {
+	return m.revoke(`user_id = ? AND token <> ?`, userID, except)
+}
+
+// Forget removes the mapping of a session that was ended by the session
+// manager itself, like on logout.
+func (m *SessionModel) Forget(token string) error {
+	_, err := m.DB.Exec(m.Dialect.rebind(`DELETE FROM user_sessions WHERE token = ?`), token)
+	return err
+}
+
+// Purge deletes the expired sessions, or every session when all is set, and
+// the mappings left without a session. It returns the number of sessions
+// deleted.
+func (m *SessionModel) Purge(all bool) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `DELETE FROM sessions`
+	if !all {
+		stmt += ` WHERE expiry < {sessionNow}`
+	}
+	result, err := tx.Exec(m.Dialect.rebind(stmt))
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	stmt = `DELETE FROM user_sessions WHERE NOT EXISTS (SELECT 1 FROM sessions s WHERE s.token = user_sessions.token)`
+	if _, err = tx.Exec(m.Dialect.rebind(stmt)); err != nil {
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+// revoke ends the sessions whose user_sessions row matches the condition.
+func (m *SessionModel) revoke(cond string, args ...interface{}) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(m.Dialect.rebind(`DELETE FROM sessions WHERE token IN (SELECT token FROM user_sessions WHERE `+cond+`)`), args...)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(m.Dialect.rebind(`DELETE FROM user_sessions WHERE `+cond), args...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -3,48 +3,82 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 )
 
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID           int
+	UserID       int
+	Username     string
+	Title        string
+	Content      string
+	Language     string
+	Visibility   string
+	ForkedFromID int
+	Hidden       bool
+	ForkCount    int
+	StarCount    int
+	Created      time.Time
+	Expires      time.Time
+	Tags         []string
+}
+
+// IsExpired reports whether the snippet is past its expiry date.
+func (s *Snippet) IsExpired() bool {
+	return !s.Expires.After(time.Now())
+}
+
+// VisibleTo reports whether the given user may open the snippet, userID is 0
+// for anonymous visitors. Owners can always see their own snippets, everyone
+// else only unexpired public or unlisted ones that no moderator has hidden.
+func (s *Snippet) VisibleTo(userID int) bool {
+	if userID != 0 && s.UserID == userID {
+		return true
+	}
+	return s.Visibility != VisibilityPrivate && !s.Hidden && !s.IsExpired()
 }
 
 type SnippetModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect *Dialect
+}
+
+const (
+	snippetColumns = `s.id, COALESCE(s.user_id, 0), COALESCE(u.username, ''), s.title, s.content, s.language, s.visibility, COALESCE(s.forked_from_id, 0), s.hidden, s.created, s.expires`
+	snippetTables  = `snippets s LEFT JOIN users u ON u.id = s.user_id`
+	snippetPublic  = `s.visibility = 'public' AND s.hidden = FALSE AND s.expires > {now}`
+)
+
+// snippetFields returns the scan destinations matching snippetColumns.
+func snippetFields(s *Snippet) []interface{} {
+	return []interface{}{&s.ID, &s.UserID, &s.Username, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.ForkedFromID, &s.Hidden, &s.Created, &s.Expires}
 }
 
 func (m *SnippetModel) Latest() ([]*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
-	rows, err := m.DB.Query(stmt)
+	stmt := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + ` WHERE ` + snippetPublic + ` ORDER BY s.id DESC LIMIT 10`
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt))
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	snippets := []*Snippet{}
-	for rows.Next() {
-		s := &Snippet{}
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
-		if err != nil {
-			return nil, err
-		}
-		snippets = append(snippets, s)
-	}
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-	return snippets, nil
+	return scanSnippets(rows)
 }
 
+// Get returns the snippet even when it is private or expired, callers must
+// check VisibleTo before showing it.
 func (m *SnippetModel) Get(id int) (*Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?`
-	row := m.DB.QueryRow(stmt, id)
+	stmt := `SELECT ` + snippetColumns + `,
+	(SELECT COUNT(*) FROM snippets f WHERE f.forked_from_id = s.id),
+	(SELECT COUNT(*) FROM stars st WHERE st.snippet_id = s.id)
+	FROM ` + snippetTables + ` WHERE s.id = ?`
 	s := &Snippet{}
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), id).Scan(append(snippetFields(s), &s.ForkCount, &s.StarCount)...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
@@ -52,22 +86,187 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 			return nil, err
 		}
 	}
+
+	s.Tags, err = snippetTags(m.DB, m.Dialect, s.ID)
+	if err != nil {
+		return nil, err
+	}
 	return s, nil
 }
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+type SnippetInput struct {
+	UserID     int
+	Title      string
+	Content    string
+	Language   string
+	Visibility string
+	Expires    int
+	Tags       []string
+}
 
-	stmt := `INSERT INTO snippets (title, content, created, expires) VALUES(?, ?, UTC_TIMESTAMP, DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+func (m *SnippetModel) Insert(input SnippetInput) (int, error) {
+	ids, err := m.InsertMany([]SnippetInput{input})
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
 
-	result, err := m.DB.Exec(stmt, title, content, expires)
+// InsertMany inserts all snippets in a single transaction, if one of them fails nothing is saved
+func (m *SnippetModel) InsertMany(inputs []SnippetInput) ([]int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO snippets (user_id, title, content, language, visibility, created, expires) VALUES(?, ?, ?, ?, ?, {now}, {nowPlusDays})`
+	ids := make([]int, 0, len(inputs))
+	for _, input := range inputs {
+		id, err := m.Dialect.insert(tx, stmt, nullInt(input.UserID), input.Title, input.Content, input.Language, input.Visibility, input.Expires)
+		if err != nil {
+			return nil, err
+		}
+		if err = insertSnippetTags(tx, m.Dialect, id, input.Tags); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Fork copies the snippet and its tags into a new snippet owned by userID,
+// the copy keeps the visibility of the original and expires in a year.
+func (m *SnippetModel) Fork(id, userID int) (int, error) {
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
 
-	id, err := result.LastInsertId()
+	stmt := `INSERT INTO snippets (user_id, title, content, language, visibility, forked_from_id, created, expires)
+	SELECT ?, title, content, language, visibility, id, {now}, {nowPlusDays}
+	FROM snippets WHERE id = ?`
+	forkID, err := m.Dialect.insert(tx, stmt, userID, 365, id)
 	if err != nil {
 		return 0, err
 	}
 
-	return int(id), nil
+	stmt = `INSERT INTO snippet_tags (snippet_id, tag_id) SELECT ?, tag_id FROM snippet_tags WHERE snippet_id = ?`
+	if _, err = tx.Exec(m.Dialect.rebind(stmt), forkID, id); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return forkID, nil
+}
+
+// Search returns unexpired public snippets whose title or content contains
+// the text and which carry every one of the given tags, newest first.
+func (m *SnippetModel) Search(text string, tags []string, limit, offset int) ([]*Snippet, error) {
+	var sb strings.Builder
+	args := []interface{}{}
+
+	sb.WriteString(`SELECT ` + snippetColumns + ` FROM ` + snippetTables + ` WHERE ` + snippetPublic)
+	if text != "" {
+		like := "%" + escapeLike(text) + "%"
+		sb.WriteString(` AND (s.title {like} OR s.content {like})`)
+		args = append(args, like, like)
+	}
+	for _, tag := range tags {
+		sb.WriteString(` AND EXISTS (SELECT 1 FROM snippet_tags st JOIN tags t ON t.id = st.tag_id WHERE st.snippet_id = s.id AND t.name = ?)`)
+		args = append(args, tag)
+	}
+	sb.WriteString(` ORDER BY s.id DESC LIMIT ? OFFSET ?`)
+	args = append(args, limit, offset)
+
+	rows, err := m.DB.Query(m.Dialect.rebind(sb.String()), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanSnippets(rows)
+}
+
+func (m *SnippetModel) ByTag(tag string, limit, offset int) ([]*Snippet, error) {
+	return m.Search("", []string{tag}, limit, offset)
+}
+
+// ByUser returns the snippets owned by the user, newest first. Unless
+// includeHidden is set only the unexpired public ones are returned.
+func (m *SnippetModel) ByUser(userID int, includeHidden bool, limit, offset int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + ` WHERE s.user_id = ?`
+	if !includeHidden {
+		stmt += ` AND ` + snippetPublic
+	}
+	stmt += ` ORDER BY s.id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanSnippets(rows)
+}
+
+// SetHidden hides the snippet from everyone but its owner, or shows it again.
+func (m *SnippetModel) SetHidden(id int, hidden bool) error {
+	result, err := m.DB.Exec(m.Dialect.rebind(`UPDATE snippets SET hidden = ? WHERE id = ?`), hidden, id)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+// Delete removes the snippet for good, its forks are kept.
+func (m *SnippetModel) Delete(id int) error {
+	result, err := m.DB.Exec(m.Dialect.rebind(`DELETE FROM snippets WHERE id = ?`), id)
+	if err != nil {
+		return err
+	}
+	return expectRow(result)
+}
+
+func scanSnippets(rows *sql.Rows) ([]*Snippet, error) {
+	defer rows.Close()
+	snippets := []*Snippet{}
+	for rows.Next() {
+		s := &Snippet{}
+		err := rows.Scan(snippetFields(s)...)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return snippets, nil
+}
+
+var likeReplacer = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeReplacer.Replace(s)
+}
+
+// expectRow returns ErrNoRecord when a statement didn't affect any row.
+func expectRow(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// nullInt stores 0 as NULL for optional foreign keys.
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
 }
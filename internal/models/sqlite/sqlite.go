@@ -0,0 +1,56 @@
+// Package sqlite holds the dialect that runs the models of the models package
+// on SQLite for single binary deployments, the schema is in
+// internal/migrations/sqlite.
+package sqlite
+
+import (
+	"errors"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"snippetbox.labkita.my.id/internal/models"
+	"strings"
+	"time"
+)
+
+// timeFormat is how times are stored, as UTC text that compares correctly
+// as strings.
+const timeFormat = "2006-01-02 15:04:05"
+
+var Dialect = &models.Dialect{
+	Returning: true,
+	SQL: map[string]string{
+		"now":         `datetime('now')`,
+		"nowPrecise":  `datetime('now')`,
+		"nowPlusDays": `datetime('now', printf('%+d days', ?))`,
+		// sqlite3store keeps the expiry as a julian day number
+		"sessionNow": `julianday('now')`,
+		// the pattern characters are only honored with an explicit escape
+		"like":             `LIKE ? ESCAPE '\'`,
+		"insertIgnore":     `INSERT`,
+		"onConflictIgnore": `ON CONFLICT DO NOTHING`,
+		"onConflictTag":    `ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name`,
+		// SQLite has no row locks, the write transaction is serialized by the
+		// database lock instead
+		"lockReport": ``,
+	},
+	UniqueViolation: uniqueViolation,
+	// the driver would otherwise write the time with its time zone
+	Time: func(t time.Time) interface{} {
+		return t.UTC().Format(timeFormat)
+	},
+}
+
+// uniqueColumns maps the unique constraints of the other databases to the
+// columns SQLite names in its errors.
+var uniqueColumns = map[string]string{
+	"users_uc_email":    "users.email",
+	"users_uc_username": "users.username",
+}
+
+func uniqueViolation(err error, constraint string) bool {
+	var sqliteError *sqlite.Error
+	if errors.As(err, &sqliteError) && sqliteError.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return constraint == "" || strings.Contains(sqliteError.Error(), uniqueColumns[constraint])
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package sqlite
+
+import (
+	"database/sql"
+	"github.com/alexedwards/scs/sqlite3store"
+	"path/filepath"
+	"snippetbox.labkita.my.id/internal/migrations"
+	"snippetbox.labkita.my.id/internal/models"
+	"snippetbox.labkita.my.id/internal/models/storetest"
+	"testing"
+	"time"
+)
+
+// TestStores runs the shared suite on a new database file for every test.
+func TestStores(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) *storetest.Stores {
+		dsn := filepath.Join(t.TempDir(), "snippetbox.db") + "?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_txlock=immediate"
+		db, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		if err = (&migrations.Migrator{DB: db, Driver: "sqlite"}).Up(); err != nil {
+			t.Fatal(err)
+		}
+		return newStores(db)
+	})
+}
+
+func newStores(db *sql.DB) *storetest.Stores {
+	sessionStore := sqlite3store.NewWithCleanupInterval(db, 0)
+	return &storetest.Stores{
+		Snippets:   &models.SnippetModel{DB: db, Dialect: Dialect},
+		Users:      &models.UserModel{DB: db, Dialect: Dialect, Hasher: storetest.Hasher},
+		Tags:       &models.TagModel{DB: db, Dialect: Dialect},
+		Stars:      &models.StarModel{DB: db, Dialect: Dialect},
+		Comments:   &models.CommentModel{DB: db, Dialect: Dialect},
+		Reports:    &models.ReportModel{DB: db, Dialect: Dialect},
+		Sessions:   &models.SessionModel{DB: db, Dialect: Dialect},
+		Identities: &models.IdentityModel{DB: db, Dialect: Dialect},
+		Stats:      &models.StatsModel{DB: db, Dialect: Dialect},
+		AuditLog:   &models.AuditModel{DB: db, Dialect: Dialect},
+		Session:    func(token string, expiry time.Time) error { return sessionStore.Commit(token, []byte("data"), expiry) },
+	}
+}
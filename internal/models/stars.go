@@ -0,0 +1,76 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type StarModel struct {
+	DB      *sql.DB
+	Dialect *Dialect
+}
+
+// Add stars the snippet, starring it twice is not an error.
+func (m *StarModel) Add(userID, snippetID int) error {
+	stmt := `{insertIgnore} INTO stars (user_id, snippet_id, created) VALUES(?, ?, {now}) {onConflictIgnore}`
+	_, err := m.DB.Exec(m.Dialect.rebind(stmt), userID, snippetID)
+	return err
+}
+
+func (m *StarModel) Remove(userID, snippetID int) error {
+	stmt := `DELETE FROM stars WHERE user_id = ? AND snippet_id = ?`
+	_, err := m.DB.Exec(m.Dialect.rebind(stmt), userID, snippetID)
+	return err
+}
+
+func (m *StarModel) Exists(userID, snippetID int) (bool, error) {
+	var exists bool
+	stmt := `SELECT EXISTS(SELECT true FROM stars WHERE user_id = ? AND snippet_id = ?)`
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), userID, snippetID).Scan(&exists)
+	return exists, err
+}
+
+// StarredBy returns the unexpired public snippets starred by the user, most
+// recently starred first.
+func (m *StarModel) StarredBy(userID, limit, offset int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + ` JOIN stars st ON st.snippet_id = s.id
+	WHERE st.user_id = ? AND ` + snippetPublic + `
+	ORDER BY st.created DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanSnippets(rows)
+}
+
+// Popular returns the public snippets with the most stars given in the last
+// days. The inner query only reads the idx_stars_created index range.
+func (m *StarModel) Popular(days, limit int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `, r.total FROM (
+		SELECT snippet_id, COUNT(*) AS total FROM stars
+		WHERE created > {nowPlusDays}
+		GROUP BY snippet_id
+	) r JOIN snippets s ON s.id = r.snippet_id LEFT JOIN users u ON u.id = s.user_id
+	WHERE ` + snippetPublic + `
+	ORDER BY r.total DESC, s.id DESC LIMIT ?`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), -days, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(append(snippetFields(s), &s.StarCount)...)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return snippets, nil
+}
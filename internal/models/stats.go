@@ -0,0 +1,46 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type Stats struct {
+	Users          int
+	SuspendedUsers int
+	Snippets       int
+	ActiveSnippets int
+	HiddenSnippets int
+	Comments       int
+	Stars          int
+	OpenReports    int
+	ActiveSessions int
+}
+
+type StatsModel struct {
+	DB      *sql.DB
+	Dialect *Dialect
+}
+
+func (m *StatsModel) Get() (*Stats, error) {
+	s := &Stats{}
+	queries := []struct {
+		stmt string
+		dest *int
+	}{
+		{`SELECT COUNT(*) FROM users`, &s.Users},
+		{`SELECT COUNT(*) FROM users WHERE suspended = TRUE`, &s.SuspendedUsers},
+		{`SELECT COUNT(*) FROM snippets`, &s.Snippets},
+		{`SELECT COUNT(*) FROM snippets WHERE expires > {now}`, &s.ActiveSnippets},
+		{`SELECT COUNT(*) FROM snippets WHERE hidden = TRUE`, &s.HiddenSnippets},
+		{`SELECT COUNT(*) FROM comments`, &s.Comments},
+		{`SELECT COUNT(*) FROM stars`, &s.Stars},
+		{`SELECT COUNT(*) FROM reports WHERE status = 'open'`, &s.OpenReports},
+		{`SELECT COUNT(*) FROM sessions WHERE {sessionNow} < expiry`, &s.ActiveSessions},
+	}
+	for _, q := range queries {
+		if err := m.DB.QueryRow(m.Dialect.rebind(q.stmt)).Scan(q.dest); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
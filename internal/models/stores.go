@@ -0,0 +1,107 @@
+package models
+
+import "time"
+
+// SnippetStore is the storage used for snippets, SnippetModel implements it
+// on the database of its Dialect and the mocks package in memory.
+type SnippetStore interface {
+	Latest() ([]*Snippet, error)
+	Get(id int) (*Snippet, error)
+	Insert(input SnippetInput) (int, error)
+	InsertMany(inputs []SnippetInput) ([]int, error)
+	Fork(id, userID int) (int, error)
+	Search(text string, tags []string, limit, offset int) ([]*Snippet, error)
+	ByTag(tag string, limit, offset int) ([]*Snippet, error)
+	ByUser(userID int, includeHidden bool, limit, offset int) ([]*Snippet, error)
+	SetHidden(id int, hidden bool) error
+	Delete(id int) error
+}
+
+// UserStore is the storage used for user accounts, UserModel implements it
+// on the database of its Dialect and the mocks package in memory.
+type UserStore interface {
+	Insert(name, username, email, password string) (int, error)
+	// Authenticate returns the id of the user, together with an error
+	// wrapping ErrRehashFailed when only upgrading the hash failed.
+	Authenticate(email, password string) (int, error)
+	PasswordMatches(id int, password string) (bool, error)
+	UpdatePassword(id int, password string) error
+	Get(id int) (*User, error)
+	GetByUsername(username string) (*User, error)
+	GetByEmail(email string) (*User, error)
+	Exists(id int) (bool, error)
+	List(query string, limit, offset int) ([]*User, error)
+	SetSuspended(id int, suspended bool) error
+	SetRole(id int, role string) error
+	ScheduleDeletion(id int, at time.Time, policy string) error
+	CancelDeletion(id int) error
+	DueForDeletion() ([]*User, error)
+	Delete(id int, policy string) error
+}
+
+type TagStore interface {
+	Popular(limit int) ([]*Tag, error)
+}
+
+type StarStore interface {
+	Add(userID, snippetID int) error
+	Remove(userID, snippetID int) error
+	Exists(userID, snippetID int) (bool, error)
+	StarredBy(userID, limit, offset int) ([]*Snippet, error)
+	Popular(days, limit int) ([]*Snippet, error)
+}
+
+type CommentStore interface {
+	Insert(snippetID, userID, parentID int, body string) (int, error)
+	Get(id int) (*Comment, error)
+	Update(id int, body string) error
+	Delete(id int) error
+	ByUser(userID int) ([]*Comment, error)
+	ForSnippet(snippetID int) ([]*Comment, error)
+}
+
+type ReportStore interface {
+	Insert(snippetID, reporterID int, reason, details string) (int, error)
+	Open(limit, offset int) ([]*Report, error)
+	Resolve(id, adminID int, action string) error
+	RecentActions(limit int) ([]*ModerationAction, error)
+}
+
+type SessionStore interface {
+	Track(token string, userID int, ip, userAgent string) error
+	Touch(token, ip string) error
+	ForUser(userID int) ([]*UserSession, error)
+	Revoke(userID, id int) (string, error)
+	RevokeAll(userID int, except string) error
+	Forget(token string) error
+	Purge(all bool) (int, error)
+}
+
+type StatsStore interface {
+	Get() (*Stats, error)
+}
+
+type AuditStore interface {
+	Insert(e *AuditEvent) error
+	List(filter AuditFilter, limit, offset int) ([]*AuditEvent, error)
+	Each(filter AuditFilter, fn func(*AuditEvent) error) error
+}
+
+type IdentityStore interface {
+	Get(issuer, subject string) (*Identity, error)
+	Insert(userID int, issuer, subject, email string) error
+	ForUser(userID int) ([]*Identity, error)
+}
+
+var (
+	_ SnippetStore  = (*SnippetModel)(nil)
+	_ UserStore     = (*UserModel)(nil)
+	_ TagStore      = (*TagModel)(nil)
+	_ StarStore     = (*StarModel)(nil)
+	_ CommentStore  = (*CommentModel)(nil)
+	_ ReportStore   = (*ReportModel)(nil)
+	_ SessionStore  = (*SessionModel)(nil)
+	_ StatsStore    = (*StatsModel)(nil)
+	_ AuditStore    = (*AuditModel)(nil)
+	_ IdentityStore = (*IdentityModel)(nil)
+)
@@ -0,0 +1,58 @@
+package models_test
+
+import (
+	"database/sql"
+	"github.com/alexedwards/scs/mysqlstore"
+	"os"
+	"snippetbox.labkita.my.id/internal/migrations"
+	"snippetbox.labkita.my.id/internal/models"
+	"snippetbox.labkita.my.id/internal/models/storetest"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// TestStores runs the shared suite on the MySQL database of
+// SNIPPETBOX_TEST_MYSQL_DSN, which needs parseTime=true. Every test drops and
+// recreates the schema, so never point it at a database you care about.
+func TestStores(t *testing.T) {
+	dsn := os.Getenv("SNIPPETBOX_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("SNIPPETBOX_TEST_MYSQL_DSN isn't set")
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err = db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	storetest.Run(t, func(t *testing.T) *storetest.Stores {
+		migrator := &migrations.Migrator{DB: db, Driver: "mysql"}
+		if err := migrator.Goto(0); err != nil {
+			t.Fatal(err)
+		}
+		if err := migrator.Up(); err != nil {
+			t.Fatal(err)
+		}
+
+		sessionStore := mysqlstore.NewWithCleanupInterval(db, 0)
+		return &storetest.Stores{
+			Snippets:   &models.SnippetModel{DB: db},
+			Users:      &models.UserModel{DB: db, Hasher: storetest.Hasher},
+			Tags:       &models.TagModel{DB: db},
+			Stars:      &models.StarModel{DB: db},
+			Comments:   &models.CommentModel{DB: db},
+			Reports:    &models.ReportModel{DB: db},
+			Sessions:   &models.SessionModel{DB: db},
+			Identities: &models.IdentityModel{DB: db},
+			Stats:      &models.StatsModel{DB: db},
+			AuditLog:   &models.AuditModel{DB: db},
+			Session:    func(token string, expiry time.Time) error { return sessionStore.Commit(token, []byte("data"), expiry) },
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package storetest
+
+import (
+	"errors"
+	"snippetbox.labkita.my.id/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAuditLog(t *testing.T, s *Stores) {
+	alice := insertUser(t, s, "alice")
+	admin := insertUser(t, s, "admin")
+
+	events := []*models.AuditEvent{
+		{ActorID: alice, ActorUsername: "alice", Action: models.AuditLogin, IP: "192.0.2.1", UserAgent: "Mozilla/5.0"},
+		{ActorID: admin, ActorUsername: "admin", Action: models.AuditLogin, IP: "192.0.2.2"},
+		{
+			ActorID: admin, ActorUsername: "admin", Action: models.AuditUserRole, TargetType: "user", TargetID: alice, IP: "192.0.2.2",
+			Details: strings.Repeat("d", 600),
+			Changes: map[string]models.AuditChange{"role": {Before: models.RoleUser, After: models.RoleModerator}},
+		},
+		{Action: models.AuditLoginFailed, IP: "192.0.2.3", Details: "unknown email"},
+	}
+	for _, e := range events {
+		if err := s.AuditLog.Insert(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	actions := func(events []*models.AuditEvent) string {
+		names := []string{}
+		for _, e := range events {
+			names = append(names, e.Action)
+		}
+		return strings.Join(names, ",")
+	}
+
+	t.Run("List", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			filter models.AuditFilter
+			limit  int
+			offset int
+			want   string
+		}{
+			{"all", models.AuditFilter{}, 10, 0, "user.login_failed,user.role,user.login,user.login"},
+			{"page", models.AuditFilter{}, 2, 1, "user.role,user.login"},
+			{"actor", models.AuditFilter{ActorID: admin}, 10, 0, "user.role,user.login"},
+			{"actor username", models.AuditFilter{ActorUsername: "alice"}, 10, 0, "user.login"},
+			{"action", models.AuditFilter{Action: models.AuditLogin}, 10, 0, "user.login,user.login"},
+			{"target", models.AuditFilter{TargetType: "user", TargetID: alice}, 10, 0, "user.role"},
+			{"ip", models.AuditFilter{IP: "192.0.2.3"}, 10, 0, "user.login_failed"},
+			{"since", models.AuditFilter{Since: time.Now().Add(-time.Hour)}, 10, 0, "user.login_failed,user.role,user.login,user.login"},
+			{"since later", models.AuditFilter{Since: time.Now().Add(time.Hour)}, 10, 0, ""},
+			{"until", models.AuditFilter{Until: time.Now().Add(-time.Hour)}, 10, 0, ""},
+			{"combined", models.AuditFilter{ActorID: admin, Action: models.AuditLogin, Until: time.Now().Add(time.Hour)}, 10, 0, "user.login"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				events, err := s.AuditLog.List(tt.filter, tt.limit, tt.offset)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := actions(events); got != tt.want {
+					t.Errorf("got %q; want %q", got, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("Fields", func(t *testing.T) {
+		events, err := s.AuditLog.List(models.AuditFilter{Action: models.AuditUserRole}, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("got %d events; want 1", len(events))
+		}
+		e := events[0]
+		if e.ID == 0 || e.ActorID != admin || e.ActorUsername != "admin" || e.TargetType != "user" || e.TargetID != alice ||
+			e.IP != "192.0.2.2" || !recent(e.Created) {
+			t.Errorf("got event %+v", e)
+		}
+		if len(e.Details) != 500 {
+			t.Errorf("got details of %d bytes; want them cut to 500", len(e.Details))
+		}
+		if change := e.Changes["role"]; change.Before != models.RoleUser || change.After != models.RoleModerator {
+			t.Errorf("got changes %+v", e.Changes)
+		}
+
+		if events, err = s.AuditLog.List(models.AuditFilter{Action: models.AuditLoginFailed}, 1, 0); err != nil || len(events) != 1 {
+			t.Fatalf("got %d events, error %v", len(events), err)
+		}
+		if e = events[0]; e.ActorID != 0 || e.TargetID != 0 || e.Changes != nil {
+			t.Errorf("got event %+v; want one without an actor, target or changes", e)
+		}
+	})
+
+	t.Run("Each", func(t *testing.T) {
+		got := []*models.AuditEvent{}
+		err := s.AuditLog.Each(models.AuditFilter{Action: models.AuditLogin}, func(e *models.AuditEvent) error {
+			got = append(got, e)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 || got[0].ActorID != alice || got[1].ActorID != admin {
+			t.Errorf("got %d events; want the logins oldest first", len(got))
+		}
+
+		errStop := errors.New("stop")
+		calls := 0
+		err = s.AuditLog.Each(models.AuditFilter{}, func(e *models.AuditEvent) error {
+			calls++
+			return errStop
+		})
+		if !errors.Is(err, errStop) || calls != 1 {
+			t.Errorf("got error %v after %d calls; want the error of the first call", err, calls)
+		}
+	})
+}
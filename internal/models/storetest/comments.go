@@ -0,0 +1,102 @@
+package storetest
+
+import (
+	"errors"
+	"snippetbox.labkita.my.id/internal/models"
+	"testing"
+)
+
+func testComments(t *testing.T, s *Stores) {
+	alice := insertUser(t, s, "alice")
+	bob := insertUser(t, s, "bob")
+	snippet := insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "Commented"})
+	other := insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "Other"})
+
+	insert := func(snippetID, userID, parentID int, body string) int {
+		t.Helper()
+		id, err := s.Comments.Insert(snippetID, userID, parentID, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	first := insert(snippet, alice, 0, "First")
+	reply := insert(snippet, bob, first, "Reply")
+	second := insert(snippet, bob, 0, "Second")
+	elsewhere := insert(other, bob, 0, "Elsewhere")
+
+	t.Run("Get", func(t *testing.T) {
+		comment, err := s.Comments.Get(reply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if comment.SnippetID != snippet || comment.UserID != bob || comment.Username != "bob" || comment.ParentID != first ||
+			comment.Body != "Reply" || !recent(comment.Created) || !recent(comment.Updated) {
+			t.Errorf("got comment %+v", comment)
+		}
+		if _, err = s.Comments.Get(9999); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v; want %v", err, models.ErrNoRecord)
+		}
+	})
+
+	t.Run("ForSnippet", func(t *testing.T) {
+		comments, err := s.Comments.ForSnippet(snippet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(comments) != 2 || comments[0].ID != first || comments[1].ID != second {
+			t.Fatalf("got %d top level comments; want %d and %d", len(comments), first, second)
+		}
+		if len(comments[0].Replies) != 1 || comments[0].Replies[0].ID != reply || len(comments[1].Replies) != 0 {
+			t.Errorf("got replies %+v and %+v", comments[0].Replies, comments[1].Replies)
+		}
+	})
+
+	t.Run("ByUser", func(t *testing.T) {
+		comments, err := s.Comments.ByUser(bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []int{}
+		for _, c := range comments {
+			got = append(got, c.ID)
+		}
+		if want := []int{reply, second, elsewhere}; !equalInts(got, want) {
+			t.Errorf("got comments %v; want %v", got, want)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		if err := s.Comments.Update(second, "Second, edited"); err != nil {
+			t.Fatal(err)
+		}
+		if comment, err := s.Comments.Get(second); err != nil || comment.Body != "Second, edited" {
+			t.Errorf("got comment %+v, error %v", comment, err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if err := s.Comments.Delete(first); err != nil {
+			t.Fatal(err)
+		}
+		// the replies go with the comment
+		if _, err := s.Comments.Get(reply); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v for the reply; want %v", err, models.ErrNoRecord)
+		}
+		comments, err := s.Comments.ForSnippet(snippet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(comments) != 1 || comments[0].ID != second {
+			t.Errorf("got %d comments; want only %d", len(comments), second)
+		}
+
+		// and so do the comments of a deleted snippet
+		if err = s.Snippets.Delete(other); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = s.Comments.Get(elsewhere); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v for the comment of a deleted snippet; want %v", err, models.ErrNoRecord)
+		}
+	})
+}
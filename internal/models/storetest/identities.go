@@ -0,0 +1,66 @@
+package storetest
+
+import (
+	"errors"
+	"snippetbox.labkita.my.id/internal/models"
+	"testing"
+)
+
+func testIdentities(t *testing.T, s *Stores) {
+	alice := insertUser(t, s, "alice")
+	bob := insertUser(t, s, "bob")
+	const issuer = "https://sso.example.com"
+
+	tests := []struct {
+		name    string
+		userID  int
+		issuer  string
+		subject string
+		wantErr error
+	}{
+		{"first", alice, issuer, "sub-1", nil},
+		{"second issuer", alice, "https://other.example.com", "sub-1", nil},
+		{"another subject", alice, issuer, "sub-2", nil},
+		{"taken subject", bob, issuer, "sub-1", models.ErrDuplicateIdentity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Identities.Insert(tt.userID, tt.issuer, tt.subject, "sso@example.com")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v; want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	identity, err := s.Identities.Get(issuer, "sub-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.ID == 0 || identity.UserID != alice || identity.Issuer != issuer || identity.Subject != "sub-1" ||
+		identity.Email != "sso@example.com" || !recent(identity.Created) {
+		t.Errorf("got identity %+v", identity)
+	}
+	if _, err = s.Identities.Get(issuer, "sub-3"); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("got error %v; want %v", err, models.ErrNoRecord)
+	}
+
+	identities, err := s.Identities.ForUser(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 3 || identities[0].Subject != "sub-1" || identities[2].Subject != "sub-2" {
+		t.Errorf("got %d identities; want the 3 of alice in order", len(identities))
+	}
+	if identities, err = s.Identities.ForUser(bob); err != nil || len(identities) != 0 {
+		t.Errorf("got %d identities, error %v; want none", len(identities), err)
+	}
+
+	// the identities go with the account
+	if err = s.Users.Delete(alice, models.DeletionPolicyDelete); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Identities.Get(issuer, "sub-1"); !errors.Is(err, models.ErrNoRecord) {
+		t.Errorf("got error %v after deleting the user; want %v", err, models.ErrNoRecord)
+	}
+}
@@ -0,0 +1,155 @@
+package storetest
+
+import (
+	"errors"
+	"snippetbox.labkita.my.id/internal/models"
+	"testing"
+)
+
+func testReports(t *testing.T, s *Stores) {
+	alice := insertUser(t, s, "alice")
+	bob := insertUser(t, s, "bob")
+	admin := insertUser(t, s, "admin")
+	spam := insertSnippet(t, s, models.SnippetInput{UserID: bob, Title: "Spam"})
+	rude := insertSnippet(t, s, models.SnippetInput{UserID: bob, Title: "Rude"})
+	fine := insertSnippet(t, s, models.SnippetInput{UserID: bob, Title: "Fine"})
+
+	insert := func(snippetID, reporterID int, reason string) int {
+		t.Helper()
+		id, err := s.Reports.Insert(snippetID, reporterID, reason, "details of "+reason)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	spamReport := insert(spam, alice, "spam")
+	spamReport2 := insert(spam, admin, "spam")
+	fineReport := insert(fine, alice, "other")
+	rudeReport := insert(rude, alice, "abuse")
+
+	open := func(t *testing.T, want ...int) {
+		t.Helper()
+		reports, err := s.Reports.Open(10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []int{}
+		for _, r := range reports {
+			got = append(got, r.ID)
+		}
+		if !equalInts(got, want) {
+			t.Errorf("got open reports %v; want %v", got, want)
+		}
+	}
+
+	t.Run("Open", func(t *testing.T) {
+		reports, err := s.Reports.Open(10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reports) != 4 {
+			t.Fatalf("got %d reports; want 4", len(reports))
+		}
+		r := reports[0]
+		if r.ID != spamReport || r.SnippetID != spam || r.SnippetTitle != "Spam" || r.AuthorID != bob || r.AuthorUsername != "bob" ||
+			r.ReporterUsername != "alice" || r.Reason != "spam" || r.Details != "details of spam" || r.Status != "open" || !recent(r.Created) {
+			t.Errorf("got report %+v", r)
+		}
+		if reports, err = s.Reports.Open(2, 1); err != nil || len(reports) != 2 || reports[0].ID != spamReport2 {
+			t.Errorf("got %d reports, error %v; want the second page", len(reports), err)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		report   int
+		action   string
+		wantErr  bool
+		wantOpen []int
+	}{
+		{"unknown action", spamReport, "ban", true, []int{spamReport, spamReport2, fineReport, rudeReport}},
+		{"hide", spamReport, models.ReportActionHide, false, []int{fineReport, rudeReport}},
+		{"resolved report", spamReport2, models.ReportActionDismiss, true, []int{fineReport, rudeReport}},
+		{"missing report", 9999, models.ReportActionDismiss, true, []int{fineReport, rudeReport}},
+		{"dismiss", fineReport, models.ReportActionDismiss, false, []int{rudeReport}},
+		{"delete", rudeReport, models.ReportActionDelete, false, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Reports.Resolve(tt.report, admin, tt.action)
+			if tt.wantErr && err == nil {
+				t.Error("got no error")
+			} else if !tt.wantErr && err != nil {
+				t.Fatal(err)
+			}
+			open(t, tt.wantOpen...)
+		})
+	}
+
+	t.Run("Effects", func(t *testing.T) {
+		if snippet, err := s.Snippets.Get(spam); err != nil || !snippet.Hidden {
+			t.Errorf("got snippet %+v, error %v; want it hidden", snippet, err)
+		}
+		if snippet, err := s.Snippets.Get(fine); err != nil || snippet.Hidden {
+			t.Errorf("got snippet %+v, error %v; want it untouched", snippet, err)
+		}
+		if _, err := s.Snippets.Get(rude); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v; want the snippet deleted", err)
+		}
+		if err := s.Reports.Resolve(spamReport, admin, models.ReportActionHide); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v resolving twice; want %v", err, models.ErrNoRecord)
+		}
+	})
+
+	t.Run("Suspend", func(t *testing.T) {
+		report := insert(fine, alice, "spam")
+		if err := s.Reports.Resolve(report, admin, models.ReportActionSuspend); err != nil {
+			t.Fatal(err)
+		}
+		if user, err := s.Users.Get(bob); err != nil || !user.Suspended {
+			t.Errorf("got user %+v, error %v; want the author suspended", user, err)
+		}
+
+		// a report of a deleted snippet has no author to suspend
+		orphan := insertSnippet(t, s, models.SnippetInput{UserID: bob, Title: "Orphan"})
+		report = insert(orphan, alice, "spam")
+		if err := s.Snippets.Delete(orphan); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Reports.Resolve(report, admin, models.ReportActionSuspend); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v; want %v", err, models.ErrNoRecord)
+		}
+		open(t, report)
+	})
+
+	t.Run("RecentActions", func(t *testing.T) {
+		actions, err := s.Reports.RecentActions(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []struct {
+			action string
+			report int
+		}{
+			{models.ReportActionSuspend, 0},
+			{models.ReportActionDelete, rudeReport},
+			{models.ReportActionDismiss, fineReport},
+			{models.ReportActionHide, spamReport},
+		}
+		if len(actions) != len(want) {
+			t.Fatalf("got %d actions; want %d", len(actions), len(want))
+		}
+		for i, a := range actions {
+			if a.Action != want[i].action || (want[i].report != 0 && a.ReportID != want[i].report) || a.AdminUsername != "admin" || !recent(a.Created) {
+				t.Errorf("action %d: got %+v; want %s of report %d", i, a, want[i].action, want[i].report)
+			}
+		}
+		if actions[0].TargetUserID != bob || actions[3].SnippetID != spam || actions[3].TargetUserID != bob {
+			t.Errorf("got targets %+v and %+v", actions[0], actions[3])
+		}
+		if actions, err = s.Reports.RecentActions(1); err != nil || len(actions) != 1 {
+			t.Errorf("got %d actions, error %v; want 1", len(actions), err)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package storetest
+
+import (
+	"errors"
+	"snippetbox.labkita.my.id/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSessions(t *testing.T, s *Stores) {
+	alice := insertUser(t, s, "alice")
+	bob := insertUser(t, s, "bob")
+
+	track := func(token string, userID int, expiry time.Time) {
+		t.Helper()
+		if err := s.Session(token, expiry); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Sessions.Track(token, userID, "192.0.2.1", "Mozilla/5.0"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tokens := func(t *testing.T, userID int) []string {
+		t.Helper()
+		sessions, err := s.Sessions.ForUser(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, session := range sessions {
+			got = append(got, session.Token)
+		}
+		return got
+	}
+	later := time.Now().Add(time.Hour)
+	track("alice-1", alice, later)
+	track("alice-2", alice, later)
+	track("alice-3", alice, later)
+	track("bob-1", bob, later)
+	track("expired", bob, time.Now().Add(-time.Hour))
+
+	t.Run("ForUser", func(t *testing.T) {
+		sessions, err := s.Sessions.ForUser(bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 1 {
+			t.Fatalf("got %d sessions; want the unexpired one", len(sessions))
+		}
+		session := sessions[0]
+		if session.ID == 0 || session.Token != "bob-1" || session.UserID != bob || session.IP != "192.0.2.1" ||
+			session.UserAgent != "Mozilla/5.0" || !recent(session.Created) || !recent(session.LastSeen) {
+			t.Errorf("got session %+v", session)
+		}
+		if got := tokens(t, alice); len(got) != 3 {
+			t.Errorf("got sessions %v; want 3", got)
+		}
+	})
+
+	t.Run("Track", func(t *testing.T) {
+		// user agents are cut to the size of the column
+		if err := s.Session("long-agent", later); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Sessions.Track("long-agent", bob, "192.0.2.1", strings.Repeat("x", 300)); err != nil {
+			t.Fatal(err)
+		}
+		sessions, err := s.Sessions.ForUser(bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, session := range sessions {
+			if session.Token == "long-agent" && len(session.UserAgent) != 255 {
+				t.Errorf("got a user agent of %d bytes; want 255", len(session.UserAgent))
+			}
+		}
+		if err = s.Sessions.Forget("long-agent"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Touch", func(t *testing.T) {
+		if err := s.Sessions.Touch("alice-1", "198.51.100.7"); err != nil {
+			t.Fatal(err)
+		}
+		sessions, err := s.Sessions.ForUser(alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, session := range sessions {
+			if session.Token == "alice-1" && session.IP != "198.51.100.7" {
+				t.Errorf("got ip %q; want the ip of the last request", session.IP)
+			}
+		}
+		if err = s.Sessions.Touch("unknown", "198.51.100.7"); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v; want %v", err, models.ErrNoRecord)
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		sessions, err := s.Sessions.ForUser(alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var id int
+		for _, session := range sessions {
+			if session.Token == "alice-2" {
+				id = session.ID
+			}
+		}
+
+		if _, err = s.Sessions.Revoke(bob, id); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v revoking the session of another user; want %v", err, models.ErrNoRecord)
+		}
+		token, err := s.Sessions.Revoke(alice, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "alice-2" {
+			t.Errorf("got token %q; want alice-2", token)
+		}
+		if got := tokens(t, alice); len(got) != 2 {
+			t.Errorf("got sessions %v; want 2", got)
+		}
+		if err = s.Sessions.Touch("alice-2", "192.0.2.1"); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v touching a revoked session; want %v", err, models.ErrNoRecord)
+		}
+	})
+
+	t.Run("RevokeAll", func(t *testing.T) {
+		if err := s.Sessions.RevokeAll(alice, "alice-3"); err != nil {
+			t.Fatal(err)
+		}
+		if got := tokens(t, alice); !equalStrings(got, []string{"alice-3"}) {
+			t.Errorf("got sessions %v; want [alice-3]", got)
+		}
+		if got := tokens(t, bob); !equalStrings(got, []string{"bob-1"}) {
+			t.Errorf("got sessions %v of another user; want [bob-1]", got)
+		}
+	})
+
+	t.Run("Forget", func(t *testing.T) {
+		if err := s.Sessions.Forget("alice-3"); err != nil {
+			t.Fatal(err)
+		}
+		if got := tokens(t, alice); len(got) != 0 {
+			t.Errorf("got sessions %v; want none", got)
+		}
+		if err := s.Sessions.Touch("alice-3", "192.0.2.1"); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v; want %v", err, models.ErrNoRecord)
+		}
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		if n, err := s.Sessions.Purge(false); err != nil || n != 1 {
+			t.Errorf("got %d, error %v; want the expired session purged", n, err)
+		}
+		if got := tokens(t, bob); !equalStrings(got, []string{"bob-1"}) {
+			t.Errorf("got sessions %v; want [bob-1]", got)
+		}
+		if n, err := s.Sessions.Purge(true); err != nil || n < 1 {
+			t.Errorf("got %d, error %v; want the remaining sessions purged", n, err)
+		}
+		if got := tokens(t, bob); len(got) != 0 {
+			t.Errorf("got sessions %v; want none", got)
+		}
+	})
+}
@@ -0,0 +1,168 @@
+package storetest
+
+import (
+	"errors"
+	"snippetbox.labkita.my.id/internal/models"
+	"testing"
+)
+
+func testSnippets(t *testing.T, s *Stores) {
+	alice := insertUser(t, s, "alice")
+	bob := insertUser(t, s, "bob")
+
+	pond := insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "An old silent pond", Language: "text", Tags: []string{"haiku", "classic"}})
+	private := insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "Private pond", Visibility: models.VisibilityPrivate, Tags: []string{"haiku"}})
+	unlisted := insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "Unlisted pond", Visibility: models.VisibilityUnlisted})
+	hidden := insertSnippet(t, s, models.SnippetInput{UserID: bob, Title: "Hidden pond", Tags: []string{"haiku"}})
+	percent := insertSnippet(t, s, models.SnippetInput{UserID: bob, Title: "100% pond", Tags: []string{"go"}})
+	anonymous := insertSnippet(t, s, models.SnippetInput{Title: "Anonymous"})
+	if err := s.Snippets.SetHidden(hidden, true); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		snippet, err := s.Snippets.Get(pond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snippet.UserID != alice || snippet.Username != "alice" || snippet.Title != "An old silent pond" ||
+			snippet.Content != "Content of An old silent pond" || snippet.Language != "text" || snippet.Visibility != models.VisibilityPublic {
+			t.Errorf("got snippet %+v", snippet)
+		}
+		if !equalStrings(snippet.Tags, []string{"classic", "haiku"}) {
+			t.Errorf("got tags %v; want [classic haiku]", snippet.Tags)
+		}
+		if !recent(snippet.Created) || snippet.Expires.Sub(snippet.Created).Hours() < 7*24-1 || snippet.Expires.Sub(snippet.Created).Hours() > 7*24+1 {
+			t.Errorf("got created %v, expires %v; want now and in 7 days", snippet.Created, snippet.Expires)
+		}
+
+		snippet, err = s.Snippets.Get(anonymous)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snippet.UserID != 0 || snippet.Username != "" || len(snippet.Tags) != 0 {
+			t.Errorf("got snippet %+v; want one without an owner", snippet)
+		}
+
+		if snippet, err = s.Snippets.Get(hidden); err != nil || !snippet.Hidden {
+			t.Errorf("got snippet %+v, error %v; want a hidden snippet", snippet, err)
+		}
+		if _, err = s.Snippets.Get(9999); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v; want %v", err, models.ErrNoRecord)
+		}
+	})
+
+	t.Run("Lists", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			list  func() ([]*models.Snippet, error)
+			wants []int
+		}{
+			{"latest", s.Snippets.Latest, []int{anonymous, percent, pond}},
+			{"search", func() ([]*models.Snippet, error) { return s.Snippets.Search("pond", nil, 10, 0) }, []int{percent, pond}},
+			{"search content", func() ([]*models.Snippet, error) { return s.Snippets.Search("content of an old", nil, 10, 0) }, []int{pond}},
+			{"search pattern characters", func() ([]*models.Snippet, error) { return s.Snippets.Search("%", nil, 10, 0) }, []int{percent}},
+			{"search tags", func() ([]*models.Snippet, error) { return s.Snippets.Search("", []string{"haiku", "classic"}, 10, 0) }, []int{pond}},
+			{"search text and tag", func() ([]*models.Snippet, error) { return s.Snippets.Search("pond", []string{"go"}, 10, 0) }, []int{percent}},
+			{"search page", func() ([]*models.Snippet, error) { return s.Snippets.Search("pond", nil, 1, 1) }, []int{pond}},
+			{"by tag", func() ([]*models.Snippet, error) { return s.Snippets.ByTag("haiku", 10, 0) }, []int{pond}},
+			{"by missing tag", func() ([]*models.Snippet, error) { return s.Snippets.ByTag("missing", 10, 0) }, []int{}},
+			{"by user", func() ([]*models.Snippet, error) { return s.Snippets.ByUser(alice, false, 10, 0) }, []int{pond}},
+			{"by user with hidden", func() ([]*models.Snippet, error) { return s.Snippets.ByUser(alice, true, 10, 0) }, []int{unlisted, private, pond}},
+			{"by user page", func() ([]*models.Snippet, error) { return s.Snippets.ByUser(alice, true, 2, 1) }, []int{private, pond}},
+			{"hidden by user", func() ([]*models.Snippet, error) { return s.Snippets.ByUser(bob, true, 10, 0) }, []int{percent, hidden}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				snippets, err := tt.list()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := snippetIDs(snippets); !equalInts(got, tt.wants) {
+					t.Errorf("got snippets %v; want %v", got, tt.wants)
+				}
+			})
+		}
+	})
+
+	t.Run("InsertMany", func(t *testing.T) {
+		ids, err := s.Snippets.InsertMany([]models.SnippetInput{
+			{UserID: bob, Title: "First", Content: "1", Visibility: models.VisibilityPrivate, Expires: 1},
+			{UserID: bob, Title: "Second", Content: "2", Visibility: models.VisibilityPrivate, Expires: 1, Tags: []string{"go"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != 2 || ids[1] <= ids[0] {
+			t.Fatalf("got ids %v", ids)
+		}
+		if snippet, err := s.Snippets.Get(ids[1]); err != nil || snippet.Title != "Second" || !equalStrings(snippet.Tags, []string{"go"}) {
+			t.Errorf("got snippet %+v, error %v", snippet, err)
+		}
+
+		// the owner doesn't exist, so the batch fails as a whole
+		_, err = s.Snippets.InsertMany([]models.SnippetInput{
+			{UserID: bob, Title: "Saved?", Content: "1", Visibility: models.VisibilityPrivate, Expires: 1},
+			{UserID: 9999, Title: "Orphan", Content: "2", Visibility: models.VisibilityPrivate, Expires: 1},
+		})
+		if err == nil {
+			t.Fatal("got no error for a missing owner")
+		}
+		snippets, err := s.Snippets.ByUser(bob, true, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, snippet := range snippets {
+			if snippet.Title == "Saved?" {
+				t.Error("the batch was saved partially")
+			}
+		}
+	})
+
+	t.Run("Fork", func(t *testing.T) {
+		fork, err := s.Snippets.Fork(pond, bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snippet, err := s.Snippets.Get(fork)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snippet.UserID != bob || snippet.ForkedFromID != pond || snippet.Title != "An old silent pond" || !equalStrings(snippet.Tags, []string{"classic", "haiku"}) {
+			t.Errorf("got fork %+v", snippet)
+		}
+		if original, err := s.Snippets.Get(pond); err != nil || original.ForkCount != 1 {
+			t.Errorf("got original %+v, error %v; want a fork count of 1", original, err)
+		}
+		if _, err = s.Snippets.Fork(9999, bob); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v for a missing snippet; want %v", err, models.ErrNoRecord)
+		}
+
+		// deleting the original keeps the fork
+		if err = s.Snippets.Delete(pond); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = s.Snippets.Get(pond); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v for the deleted snippet; want %v", err, models.ErrNoRecord)
+		}
+		if snippet, err = s.Snippets.Get(fork); err != nil || snippet.ForkedFromID != 0 {
+			t.Errorf("got fork %+v, error %v; want one without an original", snippet, err)
+		}
+	})
+
+	t.Run("SetHidden", func(t *testing.T) {
+		if err := s.Snippets.SetHidden(hidden, false); err != nil {
+			t.Fatal(err)
+		}
+		if snippet, err := s.Snippets.Get(hidden); err != nil || snippet.Hidden {
+			t.Errorf("got snippet %+v, error %v; want it shown", snippet, err)
+		}
+		if err := s.Snippets.SetHidden(9999, true); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v; want %v", err, models.ErrNoRecord)
+		}
+		if err := s.Snippets.Delete(9999); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v; want %v", err, models.ErrNoRecord)
+		}
+	})
+}
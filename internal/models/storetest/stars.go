@@ -0,0 +1,88 @@
+package storetest
+
+import (
+	"snippetbox.labkita.my.id/internal/models"
+	"testing"
+)
+
+func testStars(t *testing.T, s *Stores) {
+	alice := insertUser(t, s, "alice")
+	bob := insertUser(t, s, "bob")
+	carol := insertUser(t, s, "carol")
+	one := insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "One"})
+	two := insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "Two"})
+	private := insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "Private", Visibility: models.VisibilityPrivate})
+
+	stars := []struct{ user, snippet int }{
+		{bob, one}, {bob, one}, {bob, two}, {bob, private}, {carol, two}, {alice, two},
+	}
+	for _, star := range stars {
+		// starring twice is not an error
+		if err := s.Stars.Add(star.user, star.snippet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("Exists", func(t *testing.T) {
+		tests := []struct {
+			user, snippet int
+			want          bool
+		}{
+			{bob, one, true},
+			{carol, one, false},
+			{carol, 9999, false},
+		}
+		for _, tt := range tests {
+			if got, err := s.Stars.Exists(tt.user, tt.snippet); err != nil || got != tt.want {
+				t.Errorf("user %d, snippet %d: got %t, error %v; want %t", tt.user, tt.snippet, got, err, tt.want)
+			}
+		}
+		if snippet, err := s.Snippets.Get(two); err != nil || snippet.StarCount != 3 {
+			t.Errorf("got snippet %+v, error %v; want 3 stars", snippet, err)
+		}
+	})
+
+	t.Run("StarredBy", func(t *testing.T) {
+		snippets, err := s.Stars.StarredBy(bob, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the stars were added in the same second, so only the set is certain
+		got := snippetIDs(snippets)
+		if len(got) != 2 || got[0]+got[1] != one+two {
+			t.Errorf("got snippets %v; want %d and %d without the private one", got, one, two)
+		}
+		if snippets, err = s.Stars.StarredBy(bob, 1, 0); err != nil || len(snippets) != 1 {
+			t.Errorf("got %d snippets, error %v; want 1", len(snippets), err)
+		}
+	})
+
+	t.Run("Popular", func(t *testing.T) {
+		snippets, err := s.Stars.Popular(7, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := snippetIDs(snippets); !equalInts(got, []int{two, one}) {
+			t.Fatalf("got snippets %v; want %v", got, []int{two, one})
+		}
+		if snippets[0].StarCount != 3 || snippets[1].StarCount != 1 {
+			t.Errorf("got star counts %d and %d; want 3 and 1", snippets[0].StarCount, snippets[1].StarCount)
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		if err := s.Stars.Remove(bob, one); err != nil {
+			t.Fatal(err)
+		}
+		// removing a missing star is not an error either
+		if err := s.Stars.Remove(bob, one); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.Stars.Exists(bob, one); err != nil || got {
+			t.Errorf("got %t, error %v; want the star removed", got, err)
+		}
+		if snippets, err := s.Stars.Popular(7, 10); err != nil || !equalInts(snippetIDs(snippets), []int{two}) {
+			t.Errorf("got snippets %v, error %v; want %v", snippetIDs(snippets), err, []int{two})
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package storetest
+
+import (
+	"snippetbox.labkita.my.id/internal/models"
+	"testing"
+	"time"
+)
+
+func testStats(t *testing.T, s *Stores) {
+	stats, err := s.Stats.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stats != (models.Stats{}) {
+		t.Errorf("got %+v for an empty database", stats)
+	}
+
+	alice := insertUser(t, s, "alice")
+	bob := insertUser(t, s, "bob")
+	insertUser(t, s, "carol")
+	one := insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "One"})
+	two := insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "Two"})
+	insertSnippet(t, s, models.SnippetInput{UserID: bob, Title: "Three", Visibility: models.VisibilityPrivate})
+
+	steps := []func() error{
+		func() error { return s.Users.SetSuspended(bob, true) },
+		func() error { return s.Snippets.SetHidden(two, true) },
+		func() error { return s.Stars.Add(bob, one) },
+		func() error { return s.Stars.Add(alice, one) },
+		func() error { _, err := s.Comments.Insert(one, bob, 0, "Nice"); return err },
+		func() error { _, err := s.Reports.Insert(two, bob, "spam", ""); return err },
+		func() error { return s.Session("active", time.Now().Add(time.Hour)) },
+		func() error { return s.Session("expired", time.Now().Add(-time.Hour)) },
+	}
+	for _, step := range steps {
+		if err = step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err = s.Stats.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.Stats{
+		Users:          3,
+		SuspendedUsers: 1,
+		Snippets:       3,
+		ActiveSnippets: 3,
+		HiddenSnippets: 1,
+		Comments:       1,
+		Stars:          2,
+		OpenReports:    1,
+		ActiveSessions: 1,
+	}
+	if *stats != want {
+		t.Errorf("got %+v; want %+v", *stats, want)
+	}
+}
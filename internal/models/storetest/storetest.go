@@ -0,0 +1,135 @@
+// Package storetest is a test suite shared by the implementations of the
+// model stores, so MySQL, PostgreSQL and SQLite are held to the same
+// behavior. The test files of every driver package call Run with stores on
+// a freshly migrated database.
+package storetest
+
+import (
+	"snippetbox.labkita.my.id/internal/models"
+	"testing"
+	"time"
+)
+
+// Stores are the model stores of one database.
+type Stores struct {
+	Snippets   models.SnippetStore
+	Users      models.UserStore
+	Tags       models.TagStore
+	Stars      models.StarStore
+	Comments   models.CommentStore
+	Reports    models.ReportStore
+	Sessions   models.SessionStore
+	Identities models.IdentityStore
+	Stats      models.StatsStore
+	AuditLog   models.AuditStore
+	// Session stores a session in the table of the scs store of the driver,
+	// the SessionStore only lists sessions that exist there.
+	Session func(token string, expiry time.Time) error
+}
+
+// Hasher hashes the passwords of the suite with cheap parameters, the
+// default ones take a noticeable time per user.
+var Hasher models.PasswordHasher = &models.Argon2idHasher{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Run runs the suite, open must return stores on an empty database migrated
+// to the latest version every time it is called.
+func Run(t *testing.T, open func(t *testing.T) *Stores) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s *Stores)
+	}{
+		{"Snippets", testSnippets},
+		{"Users", testUsers},
+		{"UserDeletion", testUserDeletion},
+		{"Tags", testTags},
+		{"Stars", testStars},
+		{"Comments", testComments},
+		{"Reports", testReports},
+		{"Sessions", testSessions},
+		{"Identities", testIdentities},
+		{"Stats", testStats},
+		{"AuditLog", testAuditLog},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+// Password is the password of every user created by insertUser.
+const Password = "pa$$word"
+
+func insertUser(t *testing.T, s *Stores, username string) int {
+	t.Helper()
+
+	id, err := s.Users.Insert(username, username, username+"@example.com", Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func insertSnippet(t *testing.T, s *Stores, input models.SnippetInput) int {
+	t.Helper()
+
+	if input.Content == "" {
+		input.Content = "Content of " + input.Title
+	}
+	if input.Visibility == "" {
+		input.Visibility = models.VisibilityPublic
+	}
+	if input.Expires == 0 {
+		input.Expires = 7
+	}
+	id, err := s.Snippets.Insert(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func snippetIDs(snippets []*models.Snippet) []int {
+	ids := []int{}
+	for _, s := range snippets {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// recent reports whether a timestamp of the database is close to now, the
+// columns are stored in UTC and some only to the second.
+func recent(t time.Time) bool {
+	return time.Since(t) < time.Minute && time.Until(t) < time.Minute
+}
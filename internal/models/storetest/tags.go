@@ -0,0 +1,41 @@
+package storetest
+
+import (
+	"snippetbox.labkita.my.id/internal/models"
+	"testing"
+)
+
+func testTags(t *testing.T, s *Stores) {
+	alice := insertUser(t, s, "alice")
+	insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "One", Tags: []string{"go", "sql"}})
+	insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "Two", Tags: []string{"go", "haiku"}})
+	insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "Three", Tags: []string{"go", "sql"}})
+	insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "Private", Visibility: models.VisibilityPrivate, Tags: []string{"secret", "secret-too"}})
+	hidden := insertSnippet(t, s, models.SnippetInput{UserID: alice, Title: "Hidden", Tags: []string{"hidden"}})
+	if err := s.Snippets.SetHidden(hidden, true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		limit int
+		want  []models.Tag
+	}{
+		{10, []models.Tag{{Name: "go", Count: 3}, {Name: "sql", Count: 2}, {Name: "haiku", Count: 1}}},
+		{2, []models.Tag{{Name: "go", Count: 3}, {Name: "sql", Count: 2}}},
+	}
+
+	for _, tt := range tests {
+		tags, err := s.Tags.Popular(tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != len(tt.want) {
+			t.Fatalf("got %d tags; want %d", len(tags), len(tt.want))
+		}
+		for i, tag := range tags {
+			if tag.ID == 0 || tag.Name != tt.want[i].Name || tag.Count != tt.want[i].Count {
+				t.Errorf("tag %d: got %+v; want %+v", i, tag, tt.want[i])
+			}
+		}
+	}
+}
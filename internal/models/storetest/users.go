@@ -0,0 +1,273 @@
+package storetest
+
+import (
+	"errors"
+	"snippetbox.labkita.my.id/internal/models"
+	"testing"
+	"time"
+)
+
+func testUsers(t *testing.T, s *Stores) {
+	alice := insertUser(t, s, "alice")
+	bob := insertUser(t, s, "bob")
+	underscore := insertUser(t, s, "under_score")
+
+	t.Run("Insert", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			username string
+			email    string
+			wantErr  error
+		}{
+			{"duplicate email", "carol", "alice@example.com", models.ErrDuplicateEmail},
+			{"duplicate username", "alice", "carol@example.com", models.ErrDuplicateUsername},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if _, err := s.Users.Insert("Carol", tt.username, tt.email, Password); !errors.Is(err, tt.wantErr) {
+					t.Errorf("got error %v; want %v", err, tt.wantErr)
+				}
+			})
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		tests := []struct {
+			name string
+			get  func() (*models.User, error)
+		}{
+			{"by id", func() (*models.User, error) { return s.Users.Get(alice) }},
+			{"by username", func() (*models.User, error) { return s.Users.GetByUsername("alice") }},
+			{"by email", func() (*models.User, error) { return s.Users.GetByEmail("alice@example.com") }},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				user, err := tt.get()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if user.ID != alice || user.Name != "alice" || user.Username != "alice" || user.Email != "alice@example.com" ||
+					user.Role != models.RoleUser || user.Suspended || user.DeleteAt != nil || !recent(user.Created) {
+					t.Errorf("got user %+v", user)
+				}
+			})
+		}
+
+		if _, err := s.Users.Get(9999); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v; want %v", err, models.ErrNoRecord)
+		}
+		if _, err := s.Users.GetByUsername("nobody"); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v; want %v", err, models.ErrNoRecord)
+		}
+		if _, err := s.Users.GetByEmail("nobody@example.com"); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v; want %v", err, models.ErrNoRecord)
+		}
+		if exists, err := s.Users.Exists(alice); err != nil || !exists {
+			t.Errorf("got %t, error %v; want alice to exist", exists, err)
+		}
+		if exists, err := s.Users.Exists(9999); err != nil || exists {
+			t.Errorf("got %t, error %v; want a missing user", exists, err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		tests := []struct {
+			query string
+			limit int
+			want  []int
+		}{
+			{"", 10, []int{underscore, bob, alice}},
+			{"", 1, []int{underscore}},
+			{"ALICE", 10, []int{alice}},
+			{"example.com", 10, []int{underscore, bob, alice}},
+			{"a_i", 10, []int{}},
+			{"r_s", 10, []int{underscore}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.query, func(t *testing.T) {
+				users, err := s.Users.List(tt.query, tt.limit, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := []int{}
+				for _, u := range users {
+					got = append(got, u.ID)
+				}
+				if !equalInts(got, tt.want) {
+					t.Errorf("got users %v; want %v", got, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("Authenticate", func(t *testing.T) {
+		if err := s.Users.SetSuspended(bob, true); err != nil {
+			t.Fatal(err)
+		}
+		defer s.Users.SetSuspended(bob, false)
+
+		tests := []struct {
+			name     string
+			email    string
+			password string
+			wantID   int
+			wantErr  error
+		}{
+			{"valid", "alice@example.com", Password, alice, nil},
+			{"wrong password", "alice@example.com", "wrong", 0, models.ErrInvalidCredentials},
+			{"unknown email", "nobody@example.com", Password, 0, models.ErrInvalidCredentials},
+			{"suspended", "bob@example.com", Password, 0, models.ErrAccountSuspended},
+			{"suspended wrong password", "bob@example.com", "wrong", 0, models.ErrInvalidCredentials},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				id, err := s.Users.Authenticate(tt.email, tt.password)
+				if id != tt.wantID || !errors.Is(err, tt.wantErr) {
+					t.Errorf("got %d, error %v; want %d, error %v", id, err, tt.wantID, tt.wantErr)
+				}
+			})
+		}
+	})
+
+	t.Run("UpdatePassword", func(t *testing.T) {
+		if err := s.Users.UpdatePassword(alice, "new password"); err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := s.Users.PasswordMatches(alice, "new password"); err != nil || !ok {
+			t.Errorf("got %t, error %v for the new password", ok, err)
+		}
+		if ok, err := s.Users.PasswordMatches(alice, Password); err != nil || ok {
+			t.Errorf("got %t, error %v for the old password", ok, err)
+		}
+		if _, err := s.Users.PasswordMatches(9999, Password); !errors.Is(err, models.ErrNoRecord) {
+			t.Errorf("got error %v; want %v", err, models.ErrNoRecord)
+		}
+		if id, err := s.Users.Authenticate("alice@example.com", "new password"); err != nil || id != alice {
+			t.Errorf("got %d, error %v; want %d", id, err, alice)
+		}
+	})
+
+	t.Run("SetRole", func(t *testing.T) {
+		if err := s.Users.SetRole(bob, models.RoleModerator); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Users.SetSuspended(bob, true); err != nil {
+			t.Fatal(err)
+		}
+		user, err := s.Users.Get(bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Role != models.RoleModerator || !user.Suspended {
+			t.Errorf("got user %+v; want a suspended moderator", user)
+		}
+	})
+
+	t.Run("ScheduleDeletion", func(t *testing.T) {
+		at := time.Now().Add(-time.Hour).Truncate(time.Second)
+		if err := s.Users.ScheduleDeletion(alice, at, models.DeletionPolicyAnonymize); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Users.ScheduleDeletion(bob, time.Now().Add(time.Hour), models.DeletionPolicyDelete); err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := s.Users.Get(alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.DeleteAt == nil || !user.DeleteAt.Equal(at) || user.DeletePolicy != models.DeletionPolicyAnonymize {
+			t.Errorf("got deletion at %v with policy %q; want %v with %q", user.DeleteAt, user.DeletePolicy, at, models.DeletionPolicyAnonymize)
+		}
+
+		due, err := s.Users.DueForDeletion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(due) != 1 || due[0].ID != alice {
+			t.Errorf("got %d users due; want alice only", len(due))
+		}
+
+		if err = s.Users.CancelDeletion(alice); err != nil {
+			t.Fatal(err)
+		}
+		if user, err = s.Users.Get(alice); err != nil || user.DeleteAt != nil || user.DeletePolicy != "" {
+			t.Errorf("got user %+v, error %v; want the deletion cancelled", user, err)
+		}
+		if due, err = s.Users.DueForDeletion(); err != nil || len(due) != 0 {
+			t.Errorf("got %d users due, error %v; want none", len(due), err)
+		}
+	})
+}
+
+func testUserDeletion(t *testing.T, s *Stores) {
+	tests := []struct {
+		policy   string
+		wantKept bool
+	}{
+		{models.DeletionPolicyDelete, false},
+		{models.DeletionPolicyAnonymize, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			user := insertUser(t, s, "leaving-"+tt.policy)
+			public := insertSnippet(t, s, models.SnippetInput{UserID: user, Title: "Public"})
+			private := insertSnippet(t, s, models.SnippetInput{UserID: user, Title: "Private", Visibility: models.VisibilityPrivate})
+			staying := insertUser(t, s, "staying-"+tt.policy)
+			commented := insertSnippet(t, s, models.SnippetInput{UserID: staying, Title: "Commented"})
+			comment, err := s.Comments.Insert(commented, user, 0, "Leaving soon")
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply, err := s.Comments.Insert(commented, staying, comment, "Bye")
+			if err != nil {
+				t.Fatal(err)
+			}
+			token := "token-" + tt.policy
+			if err := s.Session(token, time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Sessions.Track(token, user, "192.0.2.1", "test"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err = s.Users.Delete(user, tt.policy); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err = s.Users.Get(user); !errors.Is(err, models.ErrNoRecord) {
+				t.Errorf("got error %v for the user; want %v", err, models.ErrNoRecord)
+			}
+			if _, err = s.Snippets.Get(private); !errors.Is(err, models.ErrNoRecord) {
+				t.Errorf("got error %v for the private snippet; want %v", err, models.ErrNoRecord)
+			}
+			got, err := s.Comments.Get(comment)
+			if err != nil || got.UserID != 0 || got.Username != "" || got.Body != models.DeletedCommentBody {
+				t.Errorf("got comment %+v, error %v; want it kept blank without an author", got, err)
+			}
+			got, err = s.Comments.Get(reply)
+			if err != nil || got.UserID != staying || got.ParentID != comment || got.Body != "Bye" {
+				t.Errorf("got reply %+v, error %v; want the reply of the other user kept", got, err)
+			}
+			snippet, err := s.Snippets.Get(public)
+			if tt.wantKept {
+				if err != nil || snippet.UserID != 0 {
+					t.Errorf("got snippet %+v, error %v; want it kept without an owner", snippet, err)
+				}
+			} else if !errors.Is(err, models.ErrNoRecord) {
+				t.Errorf("got error %v for the public snippet; want %v", err, models.ErrNoRecord)
+			}
+			if sessions, err := s.Sessions.ForUser(user); err != nil || len(sessions) != 0 {
+				t.Errorf("got %d sessions, error %v; want none", len(sessions), err)
+			}
+			if err = s.Users.Delete(user, tt.policy); !errors.Is(err, models.ErrNoRecord) {
+				t.Errorf("got error %v deleting again; want %v", err, models.ErrNoRecord)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type Tag struct {
+	ID    int
+	Name  string
+	Count int
+}
+
+type TagModel struct {
+	DB      *sql.DB
+	Dialect *Dialect
+}
+
+// Popular returns the most used tags of public snippets that haven't expired yet.
+func (m *TagModel) Popular(limit int) ([]*Tag, error) {
+	stmt := `SELECT t.id, t.name, COUNT(*) AS total FROM tags t
+	JOIN snippet_tags st ON st.tag_id = t.id
+	JOIN snippets s ON s.id = st.snippet_id
+	WHERE ` + snippetPublic + `
+	GROUP BY t.id, t.name
+	ORDER BY total DESC, t.name
+	LIMIT ?`
+
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+	for rows.Next() {
+		t := &Tag{}
+		err = rows.Scan(&t.ID, &t.Name, &t.Count)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func snippetTags(db queryer, d *Dialect, snippetID int) ([]string, error) {
+	stmt := `SELECT t.name FROM tags t JOIN snippet_tags st ON st.tag_id = t.id WHERE st.snippet_id = ? ORDER BY t.name`
+	rows, err := db.Query(d.rebind(stmt), snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// insertSnippetTags creates the missing tags and links them to the snippet,
+// it must run in the same transaction as the snippet insert.
+func insertSnippetTags(tx *sql.Tx, d *Dialect, snippetID int, tags []string) error {
+	for _, name := range tags {
+		tagID, err := d.insert(tx, `INSERT INTO tags (name) VALUES(?) {onConflictTag}`, name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(d.rebind(`{insertIgnore} INTO snippet_tags (snippet_id, tag_id) VALUES(?, ?) {onConflictIgnore}`), snippetID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,49 +3,85 @@ package models
 import (
 	"database/sql"
 	"errors"
-	"github.com/go-sql-driver/mysql"
-	"golang.org/x/crypto/bcrypt"
-	"strings"
+	"fmt"
 	"time"
 )
 
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// What happens to the snippets of a deleted account, anonymized accounts keep
+// their public and unlisted snippets without an author.
+const (
+	DeletionPolicyDelete    = "delete"
+	DeletionPolicyAnonymize = "anonymize"
+)
+
 type User struct {
 	ID             int
 	Name           string
+	Username       string
 	Email          string
 	HashedPassword []byte
+	Role           string
+	Suspended      bool
 	Created        time.Time
+	DeleteAt       *time.Time
+	DeletePolicy   string
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect *Dialect
+	Hasher  PasswordHasher
+}
+
+func (m *UserModel) hasher() PasswordHasher {
+	if m.Hasher == nil {
+		return DefaultPasswordHasher
+	}
+	return m.Hasher
 }
 
-func (m *UserModel) Insert(name, email, password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+// HasRole reports whether the user has one of the given roles.
+func (u *User) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if u.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *UserModel) Insert(name, username, email, password string) (int, error) {
+	hashedPassword, err := m.hasher().Hash(password)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	stmt := `INSERT INTO users (name, email, hashed_password, created) VALUES(?, ?, ?, UTC_TIMESTAMP())`
-	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword))
+	stmt := `INSERT INTO users (name, username, email, hashed_password, created) VALUES(?, ?, ?, ?, {now})`
+	id, err := m.Dialect.insert(m.DB, stmt, name, username, email, hashedPassword)
 	if err != nil {
-		var mySQLError *mysql.MySQLError
-		if errors.As(err, &mySQLError) {
-			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
-				return ErrDuplicateEmail
-			}
+		switch {
+		case m.Dialect.uniqueViolation(err, "users_uc_email"):
+			return 0, ErrDuplicateEmail
+		case m.Dialect.uniqueViolation(err, "users_uc_username"):
+			return 0, ErrDuplicateUsername
 		}
-		return err
+		return 0, err
 	}
-	return nil
+	return id, nil
 }
 
 func (m *UserModel) Authenticate(email, password string) (int, error) {
 	var id int
 
-	var hashedPassword []byte
-	stmt := "SELECT id, hashed_password FROM users WHERE email = ?"
-	err := m.DB.QueryRow(stmt, email).Scan(&id, &hashedPassword)
+	var hashedPassword string
+	var suspended bool
+	stmt := "SELECT id, hashed_password, suspended FROM users WHERE email = ?"
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), email).Scan(&id, &hashedPassword, &suspended)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, ErrInvalidCredentials
@@ -54,18 +90,210 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 		}
 	}
 
-	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	ok, err := CheckPassword(password, hashedPassword)
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return 0, ErrInvalidCredentials
-		} else {
-			return 0, err
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrInvalidCredentials
+	}
+
+	// upgrade hashes of an old algorithm or cost while the password is known,
+	// a failed upgrade doesn't fail the login and is retried on the next one
+	var rehashErr error
+	if !m.hasher().Current(hashedPassword) {
+		if err = m.UpdatePassword(id, password); err != nil {
+			rehashErr = fmt.Errorf("%w: %v", ErrRehashFailed, err)
 		}
 	}
 
-	return id, nil
+	// only tell a suspended user about it once they proved who they are
+	if suspended {
+		return 0, ErrAccountSuspended
+	}
+
+	return id, rehashErr
+}
+
+const userColumns = `id, name, username, email, role, suspended, created, delete_at, delete_policy`
+
+// PasswordMatches checks the password of a user that is already logged in,
+// it is used to confirm sensitive actions.
+func (m *UserModel) PasswordMatches(id int, password string) (bool, error) {
+	var hashedPassword string
+	err := m.DB.QueryRow(m.Dialect.rebind("SELECT hashed_password FROM users WHERE id = ?"), id).Scan(&hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrNoRecord
+		}
+		return false, err
+	}
+	return CheckPassword(password, hashedPassword)
+}
+
+func (m *UserModel) UpdatePassword(id int, password string) error {
+	hashedPassword, err := m.hasher().Hash(password)
+	if err != nil {
+		return err
+	}
+	stmt := `UPDATE users SET hashed_password = ? WHERE id = ?`
+	_, err = m.DB.Exec(m.Dialect.rebind(stmt), hashedPassword, id)
+	return err
+}
+
+func userFields(u *User) []interface{} {
+	return []interface{}{&u.ID, &u.Name, &u.Username, &u.Email, &u.Role, &u.Suspended, &u.Created, &u.DeleteAt, &u.DeletePolicy}
+}
+
+func (m *UserModel) Get(id int) (*User, error) {
+	stmt := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+	return m.getUser(stmt, id)
+}
+
+func (m *UserModel) GetByUsername(username string) (*User, error) {
+	stmt := `SELECT ` + userColumns + ` FROM users WHERE username = ?`
+	return m.getUser(stmt, username)
+}
+
+func (m *UserModel) getUser(stmt string, arg interface{}) (*User, error) {
+	u := &User{}
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), arg).Scan(userFields(u)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+	return u, nil
 }
 
 func (m *UserModel) Exists(id int) (bool, error) {
-	return false, nil
+	var exists bool
+	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = ?)"
+	err := m.DB.QueryRow(m.Dialect.rebind(stmt), id).Scan(&exists)
+	return exists, err
+}
+
+func (m *UserModel) GetByEmail(email string) (*User, error) {
+	stmt := `SELECT ` + userColumns + ` FROM users WHERE email = ?`
+	return m.getUser(stmt, email)
+}
+
+// List returns users whose name, username or email contains the query,
+// newest first.
+func (m *UserModel) List(query string, limit, offset int) ([]*User, error) {
+	like := "%" + escapeLike(query) + "%"
+	stmt := `SELECT ` + userColumns + ` FROM users WHERE name {like} OR username {like} OR email {like} ORDER BY id DESC LIMIT ? OFFSET ?`
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt), like, like, like, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		u := &User{}
+		if err = rows.Scan(userFields(u)...); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (m *UserModel) SetSuspended(id int, suspended bool) error {
+	stmt := `UPDATE users SET suspended = ? WHERE id = ?`
+	_, err := m.DB.Exec(m.Dialect.rebind(stmt), suspended, id)
+	return err
+}
+
+func (m *UserModel) SetRole(id int, role string) error {
+	stmt := `UPDATE users SET role = ? WHERE id = ?`
+	_, err := m.DB.Exec(m.Dialect.rebind(stmt), role, id)
+	return err
+}
+
+// ScheduleDeletion marks the account to be deleted at the given time, until
+// then the deletion can be cancelled.
+func (m *UserModel) ScheduleDeletion(id int, at time.Time, policy string) error {
+	stmt := `UPDATE users SET delete_at = ?, delete_policy = ? WHERE id = ?`
+	_, err := m.DB.Exec(m.Dialect.rebind(stmt), m.Dialect.time(at), policy, id)
+	return err
+}
+
+func (m *UserModel) CancelDeletion(id int) error {
+	stmt := `UPDATE users SET delete_at = NULL, delete_policy = '' WHERE id = ?`
+	_, err := m.DB.Exec(m.Dialect.rebind(stmt), id)
+	return err
+}
+
+// DueForDeletion returns the accounts whose grace period is over.
+func (m *UserModel) DueForDeletion() ([]*User, error) {
+	stmt := `SELECT ` + userColumns + ` FROM users WHERE delete_at <= {now} ORDER BY delete_at`
+	rows, err := m.DB.Query(m.Dialect.rebind(stmt))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		u := &User{}
+		if err = rows.Scan(userFields(u)...); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// Delete removes the account and its sessions. Stars and linked identities go
+// with it through their foreign keys, comments are blanked and kept without an
+// author so the replies of others survive, snippets are deleted or left
+// without an author depending on the policy. The audit log has no
+// foreign key and keeps the username of the account.
+func (m *UserModel) Delete(id int, policy string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `DELETE FROM snippets WHERE user_id = ?`
+	if policy == DeletionPolicyAnonymize {
+		stmt += ` AND visibility = 'private'`
+	}
+	if _, err = tx.Exec(m.Dialect.rebind(stmt), id); err != nil {
+		return err
+	}
+
+	stmt = `UPDATE comments SET body = ?, updated = created WHERE user_id = ?`
+	if _, err = tx.Exec(m.Dialect.rebind(stmt), DeletedCommentBody, id); err != nil {
+		return err
+	}
+
+	stmt = `DELETE FROM sessions WHERE token IN (SELECT token FROM user_sessions WHERE user_id = ?)`
+	if _, err = tx.Exec(m.Dialect.rebind(stmt), id); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(m.Dialect.rebind(`DELETE FROM users WHERE id = ?`), id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+	return tx.Commit()
 }
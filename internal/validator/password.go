@@ -0,0 +1,179 @@
+package validator
+
+import (
+	"bufio"
+	"embed"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// MinPasswordEntropy is the minimum estimated strength of a password in bits.
+const MinPasswordEntropy = 40
+
+// data/common-passwords.txt is the password frequency list of zxcvbn-go
+// (MIT license, see data/LICENSE), lowercased and one password per line.
+//
+//go:embed data/common-passwords.txt
+var passwordData embed.FS
+
+var (
+	commonPasswordsOnce sync.Once
+	commonPasswords     *bloomFilter
+)
+
+// IsCommonPassword reports whether the password, ignoring case and trailing
+// digits or symbols, is on the list of common and breached passwords. The
+// list is kept in a bloom filter, so a small share of uncommon passwords is
+// rejected as well.
+func IsCommonPassword(password string) bool {
+	commonPasswordsOnce.Do(loadCommonPasswords)
+
+	password = strings.ToLower(password)
+	if commonPasswords.Contains(password) {
+		return true
+	}
+	stripped := strings.TrimRightFunc(password, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return len(stripped) >= 4 && stripped != password && commonPasswords.Contains(stripped)
+}
+
+func loadCommonPasswords() {
+	f, err := passwordData.Open("data/common-passwords.txt")
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		panic(err)
+	}
+
+	commonPasswords = newBloomFilter(len(lines), 0.001)
+	for _, line := range lines {
+		commonPasswords.Add(line)
+	}
+}
+
+// PasswordEntropy estimates the strength of a password in bits from the
+// character classes it uses. Repeated characters and runs like "abc" or
+// "4321" add nothing.
+func PasswordEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	runes := []rune(password)
+	length := 0
+	for i, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+		if i > 0 {
+			if d := r - runes[i-1]; d >= -1 && d <= 1 {
+				continue
+			}
+		}
+		length++
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(length) * math.Log2(float64(pool))
+}
+
+// ContainsUserInput reports whether the password contains one of the inputs,
+// like the name or email address of the user. Email addresses are checked by
+// their local part as well and names by each word, ignoring case and parts
+// shorter than 3 characters.
+func ContainsUserInput(password string, inputs ...string) bool {
+	password = strings.ToLower(password)
+	for _, input := range inputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		parts := []string{input}
+		if at := strings.LastIndex(input, "@"); at > 0 {
+			parts = append(parts, input[:at])
+		}
+		parts = append(parts, strings.FieldsFunc(input, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})...)
+
+		for _, part := range parts {
+			if len([]rune(part)) >= 3 && strings.Contains(password, part) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bloomFilter is a fixed size set that may report false positives but never
+// false negatives.
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+func newBloomFilter(n int, falsePositiveRate float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// locations uses double hashing to derive k bit positions from one 64 bit
+// FNV hash.
+func (b *bloomFilter) locations(value string, fn func(uint64) bool) bool {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	for i := uint64(0); i < b.k; i++ {
+		if !fn((h1 + i*h2) % b.m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bloomFilter) Add(value string) {
+	b.locations(value, func(bit uint64) bool {
+		b.bits[bit/64] |= 1 << (bit % 64)
+		return true
+	})
+}
+
+func (b *bloomFilter) Contains(value string) bool {
+	return b.locations(value, func(bit uint64) bool {
+		return b.bits[bit/64]&(1<<(bit%64)) != 0
+	})
+}
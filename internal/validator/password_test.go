@@ -0,0 +1,121 @@
+package validator
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestIsCommonPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{"on the list", "password", true},
+		{"upper case", "LetMeIn", true},
+		{"trailing digits", "dragon2024", true},
+		{"trailing symbols", "dragon!!", true},
+		{"short stem", "qzx!!", false},
+		{"uncommon", "Correct-Horse-77-Battery", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsCommonPassword(tt.password); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordEntropy(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     float64
+	}{
+		{"empty", "", 0},
+		{"repeated", "aaaaaaaa", math.Log2(26)},
+		{"run", "abcdefgh", math.Log2(26)},
+		{"descending digits", "87654321", math.Log2(10)},
+		{"lower case", "zxcvbnmq", 7 * math.Log2(26)},
+		{"mixed classes", "Tr0ub4dor&3", 11 * math.Log2(95)},
+		{"non ascii", "пароль", 6 * math.Log2(100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PasswordEntropy(tt.password); math.Abs(got-tt.want) > 0.001 {
+				t.Errorf("got %.3f; want %.3f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainsUserInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		inputs   []string
+		want     bool
+	}{
+		{"email", "alice@example.com1", []string{"alice@example.com"}, true},
+		{"email local part", "xxAlice99", []string{"alice@example.com"}, true},
+		{"name word", "SmithRocks", []string{"Jane Smith"}, true},
+		{"username", "go-zed_007!", []string{"zed_007"}, true},
+		{"short part", "al-xyz-1234", []string{"Al Bo"}, false},
+		{"blank input", "whatever", []string{"", "  "}, false},
+		{"unrelated", "Correct-Horse-77-Battery", []string{"Jane Smith", "jane", "jane@example.com"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ContainsUserInput(tt.password, tt.inputs...); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadCommonPasswords(t *testing.T) {
+	commonPasswordsOnce.Do(loadCommonPasswords)
+
+	f, err := passwordData.Open("data/common-passwords.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		n++
+		if !commonPasswords.Contains(line) {
+			t.Errorf("%q is missing from the filter", line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Fatal("the list is empty")
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if commonPasswords.Contains(fmt.Sprintf("uncommon-%d-password", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 50 {
+		t.Errorf("got %d false positives in 10000; want at most 50", falsePositives)
+	}
+}
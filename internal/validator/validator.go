@@ -32,6 +32,15 @@ func PermittedInt(value int, permittedValues ...int) bool {
 	return false
 }
 
+func PermittedValue(value string, permittedValues ...string) bool {
+	for i := range permittedValues {
+		if value == permittedValues[i] {
+			return true
+		}
+	}
+	return false
+}
+
 func (v *Validator) AddFieldError(key, message string) {
 	if v.FieldErrors == nil {
 		v.FieldErrors = make(map[string]string)
@@ -41,6 +50,18 @@ func (v *Validator) AddFieldError(key, message string) {
 	}
 }
 
+// AppendFieldError adds the message to the error of the field, after the
+// messages it already has.
+func (v *Validator) AppendFieldError(key, message string) {
+	if existing, exists := v.FieldErrors[key]; exists {
+		message = existing + "; " + message
+	}
+	if v.FieldErrors == nil {
+		v.FieldErrors = make(map[string]string)
+	}
+	v.FieldErrors[key] = message
+}
+
 func (v *Validator) CheckField(ok bool, key, message string) {
 	if !ok {
 		v.AddFieldError(key, message)
@@ -49,6 +70,10 @@ func (v *Validator) CheckField(ok bool, key, message string) {
 
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+var UsernameRX = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9_-]{1,28}[a-z0-9])$`)
+
+var TagRX = regexp.MustCompile(`^[a-z0-9][a-z0-9.+#_-]{0,29}$`)
+
 func MinChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) >= n
 }
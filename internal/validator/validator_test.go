@@ -0,0 +1,21 @@
+package validator
+
+import "testing"
+
+func TestFieldErrors(t *testing.T) {
+	var v Validator
+	v.AddFieldError("password", "first")
+	v.AddFieldError("password", "second")
+	v.AppendFieldError("password", "third")
+	v.AppendFieldError("email", "fourth")
+
+	if got, want := v.FieldErrors["password"], "first; third"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if got, want := v.FieldErrors["email"], "fourth"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if v.IsValid() {
+		t.Error("got valid; want invalid")
+	}
+}